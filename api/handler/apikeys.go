@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/token"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errInvalidAPIKey is returned for keys that are unknown, revoked or expired.
+var errInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyAuthenticator resolves the key of an "Authorization: ApiKey <key>"
+// header to the claims of the user it acts for, with the key's scopes as
+// permissions.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*token.UserClaims, error)
+}
+
+// RemoteAPIKeys checks API keys with the gRPC service, which keeps them.
+type RemoteAPIKeys struct {
+	client pb.GolangMicroserviceClient
+}
+
+func NewRemoteAPIKeys(client pb.GolangMicroserviceClient) *RemoteAPIKeys {
+	return &RemoteAPIKeys{client: client}
+}
+
+func (k *RemoteAPIKeys) AuthenticateAPIKey(ctx context.Context, key string) (*token.UserClaims, error) {
+	res, err := k.client.AuthenticateAPIKey(ctx, &pb.AuthenticateAPIKeyReq{Key: key})
+	if status.Code(err) == codes.Unauthenticated {
+		return nil, errInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error authenticating api key: %w", err)
+	}
+
+	return &token.UserClaims{
+		ID:           res.GetUserId(),
+		Email:        res.GetEmail(),
+		Permissions:  res.GetPermissions(),
+		APIKeyPrefix: res.GetPrefix(),
+	}, nil
+}
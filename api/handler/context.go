@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/abedsully/golang-microservice/logging"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	requestIDHeader       = "X-Request-Id"
+	maxRequestIDLength    = 128
+	defaultRequestTimeout = 10 * time.Second
+)
+
+// Timeouts configures the deadline of each request. The deadline is carried to
+// the gRPC service, which cancels its database queries once it has passed.
+type Timeouts struct {
+	// Default applies to routes without an entry in Routes.
+	Default time.Duration
+	// Routes is keyed by method and chi route pattern, e.g.
+	// "POST /orders/" or "GET /products/{id}/".
+	Routes map[string]time.Duration
+}
+
+// ParseRouteTimeouts parses a comma-separated list such as
+// "POST /orders/=15s,GET /products/=2s".
+func ParseRouteTimeouts(s string) (map[string]time.Duration, error) {
+	routes := make(map[string]time.Duration)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, value, ok := strings.Cut(entry, "=")
+		fields := strings.Fields(route)
+		if !ok || len(fields) != 2 {
+			return nil, fmt.Errorf("invalid route timeout %q, want \"METHOD /pattern=duration\"", entry)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration in route timeout %q", entry)
+		}
+
+		routes[strings.ToUpper(fields[0])+" "+fields[1]] = d
+	}
+
+	return routes, nil
+}
+
+// deadlineMiddleware puts a deadline on the request context. The route is
+// matched up front, as chi only records the pattern while routing.
+func deadlineMiddleware(mux *chi.Mux, timeouts Timeouts) func(http.Handler) http.Handler {
+	def := timeouts.Default
+	if def <= 0 {
+		def = defaultRequestTimeout
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout := def
+			if len(timeouts.Routes) > 0 {
+				rctx := chi.NewRouteContext()
+				if mux.Match(rctx, r.Method, r.URL.Path) {
+					if d, ok := timeouts.Routes[r.Method+" "+rctx.RoutePattern()]; ok {
+						timeout = d
+					}
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestIDMiddleware keeps the X-Request-Id sent by the client, or generates
+// one, and echoes it in the response.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// outgoingContext returns the context for gRPC calls made on behalf of r. It
+// carries the request's deadline, cancellation and trace, and forwards the
+// caller's token, so the service can authorize the call itself, together with
+// the request ID and the client's address and user agent.
+func (h *handler) outgoingContext(r *http.Request) context.Context {
+	ctx := r.Context()
+
+	kv := []string{
+		"x-request-id", logging.RequestID(ctx),
+		"x-client-ip", clientIP(r),
+		"x-client-user-agent", r.UserAgent(),
+	}
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		kv = append(kv, "authorization", authHeader)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// clientIP returns the address of the peer. Forwarding headers are not
+// trusted, as the gateway is not deployed behind a known proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
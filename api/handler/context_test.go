@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestParseRouteTimeouts(t *testing.T) {
+	routes, err := ParseRouteTimeouts(" post /orders/=15s, GET /products/{id}/=2s ,")
+	require.NoError(t, err)
+	require.Equal(t, map[string]time.Duration{
+		"POST /orders/":       15 * time.Second,
+		"GET /products/{id}/": 2 * time.Second,
+	}, routes)
+
+	for _, s := range []string{"/orders/=1s", "POST /orders/", "POST /orders/=soon", "POST /orders/=-1s"} {
+		_, err := ParseRouteTimeouts(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestDeadlineMiddleware(t *testing.T) {
+	var remaining time.Duration
+	record := func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok := r.Context().Deadline()
+		require.True(t, ok)
+		remaining = time.Until(deadline)
+	}
+
+	r := chi.NewRouter()
+	r.Use(deadlineMiddleware(r, Timeouts{
+		Default: time.Minute,
+		Routes:  map[string]time.Duration{"GET /products/{id}/": time.Second},
+	}))
+	r.Route("/products", func(r chi.Router) {
+		r.Get("/", record)
+		r.Get("/{id}/", record)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products/7/", nil))
+	require.InDelta(t, time.Second, remaining, float64(100*time.Millisecond))
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products/", nil))
+	require.InDelta(t, time.Minute, remaining, float64(100*time.Millisecond))
+}
+
+func TestOutgoingContext(t *testing.T) {
+	h := &handler{}
+	var md metadata.MD
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		md, _ = metadata.FromOutgoingContext(h.outgoingContext(r))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:4711"
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set(requestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	requestIDMiddleware(next).ServeHTTP(rec, req)
+
+	require.Equal(t, "req-1", rec.Header().Get(requestIDHeader))
+	require.Equal(t, []string{"req-1"}, md.Get("x-request-id"))
+	require.Equal(t, []string{"203.0.113.7"}, md.Get("x-client-ip"))
+	require.Equal(t, []string{"curl/8.0"}, md.Get("x-client-user-agent"))
+	require.Equal(t, []string{"Bearer abc"}, md.Get("authorization"))
+
+	// invalid IDs are replaced
+	req.Header.Set(requestIDHeader, "has spaces")
+	rec = httptest.NewRecorder()
+	requestIDMiddleware(next).ServeHTTP(rec, req)
+	require.NotEqual(t, "has spaces", rec.Header().Get(requestIDHeader))
+	require.Equal(t, []string{rec.Header().Get(requestIDHeader)}, md.Get("x-request-id"))
+}
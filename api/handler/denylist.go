@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RemoteDenylist is a denylist.Denylist kept by the gRPC service, so that a
+// token revoked through one gateway is rejected by all of them. Every
+// authenticated request costs a call to the service.
+type RemoteDenylist struct {
+	client pb.GolangMicroserviceClient
+}
+
+func NewRemoteDenylist(client pb.GolangMicroserviceClient) *RemoteDenylist {
+	return &RemoteDenylist{client: client}
+}
+
+func (d *RemoteDenylist) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := d.client.DenyToken(ctx, &pb.DeniedTokenReq{
+		Jti:       jti,
+		ExpiresAt: timestamppb.New(expiresAt),
+	})
+	if err != nil {
+		return fmt.Errorf("error denying token: %w", err)
+	}
+
+	return nil
+}
+
+func (d *RemoteDenylist) IsDenied(ctx context.Context, jti string) (bool, error) {
+	res, err := d.client.IsTokenDenied(ctx, &pb.DeniedTokenReq{Jti: jti})
+	if err != nil {
+		return false, fmt.Errorf("error checking token denylist: %w", err)
+	}
+
+	return res.GetDenied(), nil
+}
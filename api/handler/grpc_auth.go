@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type serviceCredentials struct {
+	token string
+}
+
+// NewServiceCredentials authenticates every call to the gRPC service as the
+// API gateway, which is required for internal-only methods.
+func NewServiceCredentials(token string) credentials.PerRPCCredentials {
+	return serviceCredentials{token: token}
+}
+
+func (c serviceCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"x-service-token": c.token}, nil
+}
+
+func (c serviceCredentials) RequireTransportSecurity() bool {
+	return false
+}
@@ -1,30 +1,63 @@
 package handler
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/abedsully/golang-microservice/denylist"
 	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/sso"
+	"github.com/abedsully/golang-microservice/throttle"
 	"github.com/abedsully/golang-microservice/token"
-	"github.com/abedsully/golang-microservice/util"
 	"github.com/go-chi/chi"
-	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type handler struct {
-	ctx        context.Context
-	client     pb.GolangMicroserviceClient
-	TokenMaker *token.JWTMaker
+	client        pb.GolangMicroserviceClient
+	auth          pb.AuthServiceClient
+	health        healthpb.HealthClient
+	TokenMaker    token.Maker
+	loginThrottle LoginThrottle
+	resendLimiter *throttle.Limiter
+	denylist      denylist.Denylist
+	apiKeys       APIKeyAuthenticator
+	draining      atomic.Bool
+
+	// MFARequiredRoles are the roles whose users must enable two-factor
+	// authentication. Until they do, their tokens grant no permissions.
+	MFARequiredRoles []string
+	// SSOProviders are the OpenID Connect providers users can log in with,
+	// by name.
+	SSOProviders map[string]*sso.Provider
 }
 
-func NewHandler(client pb.GolangMicroserviceClient, secretKey string) *handler {
+// NewHandler returns the gateway handler. Logins, token renewals and password
+// changes are made with auth. Tokens are issued and verified by tokenMaker.
+// Every verification mail resent for an email counts as an attempt of
+// resendLimiter. Tokens are rejected while their ID is in denied.
+// API keys are checked with the gRPC service.
+func NewHandler(client pb.GolangMicroserviceClient, auth pb.AuthServiceClient, health healthpb.HealthClient, tokenMaker token.Maker, loginThrottle LoginThrottle, resendLimiter *throttle.Limiter, denied denylist.Denylist) *handler {
 	return &handler{
-		ctx:        context.Background(),
-		client:     client,
-		TokenMaker: token.NewJWTMaker(secretKey),
+		client:        client,
+		auth:          auth,
+		health:        health,
+		TokenMaker:    tokenMaker,
+		loginThrottle: loginThrottle,
+		resendLimiter: resendLimiter,
+		denylist:      denied,
+		apiKeys:       NewRemoteAPIKeys(client),
 	}
 }
 
@@ -35,10 +68,10 @@ func (h *handler) createProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.client.CreateProduct(h.ctx, toPBProductReq(p))
+	product, err := h.client.CreateProduct(h.outgoingContext(r), toPBProductReq(p))
 
 	if err != nil {
-		http.Error(w, "error creating product", http.StatusInternalServerError)
+		internalError(w, r, "error creating product", err)
 		return
 	}
 
@@ -58,9 +91,9 @@ func (h *handler) getProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.client.GetProduct(h.ctx, &pb.ProductReq{Id: i})
+	product, err := h.client.GetProduct(h.outgoingContext(r), &pb.ProductReq{Id: i})
 	if err != nil {
-		http.Error(w, "error getting product", http.StatusInternalServerError)
+		internalError(w, r, "error getting product", err)
 		return
 	}
 
@@ -71,10 +104,10 @@ func (h *handler) getProduct(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) getAllProducts(w http.ResponseWriter, r *http.Request) {
-	lpr, err := h.client.GetAllProducts(h.ctx, &pb.ProductReq{})
+	lpr, err := h.client.GetAllProducts(h.outgoingContext(r), &pb.ProductReq{})
 
 	if err != nil {
-		http.Error(w, "error getting all products", http.StatusInternalServerError)
+		internalError(w, r, "error getting all products", err)
 		return
 	}
 
@@ -106,9 +139,9 @@ func (h *handler) updateProduct(w http.ResponseWriter, r *http.Request) {
 
 	p.ID = i
 
-	updated, err := h.client.UpdateProduct(h.ctx, toPBProductReq(p))
+	updated, err := h.client.UpdateProduct(h.outgoingContext(r), toPBProductReq(p))
 	if err != nil {
-		http.Error(w, "error updating product", http.StatusInternalServerError)
+		internalError(w, r, "error updating product", err)
 		return
 	}
 
@@ -127,10 +160,10 @@ func (h *handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.client.DeleteProduct(h.ctx, &pb.ProductReq{Id: i})
+	_, err = h.client.DeleteProduct(h.outgoingContext(r), &pb.ProductReq{Id: i})
 
 	if err != nil {
-		http.Error(w, "error deleting product", http.StatusInternalServerError)
+		internalError(w, r, "error deleting product", err)
 		return
 	}
 
@@ -149,13 +182,28 @@ func (h *handler) createOrder(w http.ResponseWriter, r *http.Request) {
 	po := toPBOrderReq(o)
 	po.UserId = claims.ID
 
-	created, err := h.client.CreateOrder(h.ctx, po)
+	ctx, err := withIdempotencyKey(h.outgoingContext(r), r)
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var header metadata.MD
+	created, err := h.client.CreateOrder(ctx, po, grpc.Header(&header))
+	if err != nil {
+		if writeIdempotencyError(w, err) {
+			return
+		}
+		if status.Code(err) == codes.FailedPrecondition {
+			http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+			return
+		}
+		internalError(w, r, "internal server error", err)
 		return
 	}
 
 	res := toOrderRes(created)
+	markReplayed(w, header)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(res)
@@ -164,11 +212,15 @@ func (h *handler) createOrder(w http.ResponseWriter, r *http.Request) {
 func (h *handler) getOrder(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value(authKey{}).(*token.UserClaims)
 
-	order, err := h.client.GetOrder(h.ctx, &pb.OrderReq{
+	order, err := h.client.GetOrder(h.outgoingContext(r), &pb.OrderReq{
 		UserId: claims.ID,
 	})
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		if status.Code(err) == codes.NotFound {
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+			return
+		}
+		internalError(w, r, "internal server error", err)
 		return
 	}
 
@@ -178,9 +230,9 @@ func (h *handler) getOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) listOrders(w http.ResponseWriter, r *http.Request) {
-	orders, err := h.client.GetAllOrders(h.ctx, &pb.OrderReq{})
+	orders, err := h.client.GetAllOrders(h.outgoingContext(r), &pb.OrderReq{})
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		internalError(w, r, "internal server error", err)
 		return
 	}
 
@@ -193,18 +245,62 @@ func (h *handler) listOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(res)
 }
 
+func (h *handler) updateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateOrderStatusReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	if !isValidOrderStatus(req.Status) {
+		http.Error(w, "invalid order status", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.client.UpdateOrderStatus(h.outgoingContext(r), &pb.OrderReq{
+		Id:     i,
+		Status: req.Status,
+	})
+	if err != nil {
+		internalError(w, r, "error updating order status", err)
+		return
+	}
+
+	res := toOrderRes(updated)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
 func (h *handler) deleteOrder(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	i, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
-		panic(err)
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
 	}
 
-	_, err = h.client.DeleteOrder(h.ctx, &pb.OrderReq{
+	// the service checks that the order belongs to the caller
+	_, err = h.client.DeleteOrder(h.outgoingContext(r), &pb.OrderReq{
 		Id: i,
 	})
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		switch status.Code(err) {
+		case codes.NotFound:
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+			return
+		case codes.PermissionDenied:
+			http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+			return
+		}
+		internalError(w, r, "internal server error", err)
 		return
 	}
 
@@ -218,30 +314,38 @@ func (h *handler) createUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashed, err := util.HashPassword(u.Password)
+	ctx, err := withIdempotencyKey(h.outgoingContext(r), r)
 	if err != nil {
-		http.Error(w, "error hashing password", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	u.Password = hashed
 
-	created, err := h.client.CreateUser(h.ctx, toPBUserReq(u))
+	var header metadata.MD
+	created, err := h.client.CreateUser(ctx, toPBUserReq(u), grpc.Header(&header))
 
 	if err != nil {
-		http.Error(w, "error creating user", http.StatusInternalServerError)
+		if writeIdempotencyError(w, err) {
+			return
+		}
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		internalError(w, r, "error creating user", err)
 		return
 	}
 
 	res := toUserRes(created)
+	markReplayed(w, header)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(res)
 }
 
 func (h *handler) listUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.client.GetAllUsers(h.ctx, &pb.UserReq{})
+	users, err := h.client.GetAllUsers(h.outgoingContext(r), &pb.UserReq{})
 	if err != nil {
-		http.Error(w, "error listing users", http.StatusInternalServerError)
+		internalError(w, r, "error listing users", err)
 		return
 	}
 
@@ -264,9 +368,17 @@ func (h *handler) updateUser(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value(authKey{}).(*token.UserClaims)
 	u.Email = claims.Email
 
-	updated, err := h.client.UpdateUser(h.ctx, toPBUserReq(u))
+	updated, err := h.client.UpdateUser(h.outgoingContext(r), toPBUserReq(u))
 	if err != nil {
-		http.Error(w, "error updating user", http.StatusInternalServerError)
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		case codes.PermissionDenied:
+			http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+			return
+		}
+		internalError(w, r, "error updating user", err)
 		return
 	}
 
@@ -276,7 +388,7 @@ func (h *handler) updateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(res)
 }
 
-func (h handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+func (h *handler) deleteUser(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	i, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
@@ -284,11 +396,11 @@ func (h handler) deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.client.DeleteUser(h.ctx, &pb.UserReq{
+	_, err = h.client.DeleteUser(h.outgoingContext(r), &pb.UserReq{
 		Id: i,
 	})
 	if err != nil {
-		http.Error(w, "error deleting user", http.StatusInternalServerError)
+		internalError(w, r, "error deleting user", err)
 		return
 	}
 
@@ -302,52 +414,145 @@ func (h *handler) loginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ur, err := h.client.GetUser(h.ctx, &pb.UserReq{
-		Email: u.Email,
-	})
+	ipKey, emailKey := loginThrottleKeys(r, u.Email)
+	wait, err := h.loginThrottle.reserve(r.Context(), ipKey, emailKey)
 	if err != nil {
-		http.Error(w, "error getting user", http.StatusInternalServerError)
+		internalError(w, r, "error checking login attempts", err)
+		return
+	}
+	if wait > 0 {
+		metrics.LoginFailed(metrics.LoginFailureThrottled)
+		setRetryAfter(w, wait)
+		http.Error(w, "too many login attempts", http.StatusTooManyRequests)
 		return
 	}
 
-	err = util.CheckPassword(u.Password, ur.GetPassword())
+	res, err := h.auth.Login(h.outgoingContext(r), &pb.LoginReq{
+		Email:    u.Email,
+		Password: u.Password,
+	})
 	if err != nil {
-		http.Error(w, "wrong password", http.StatusUnauthorized)
+		h.loginError(w, r, ipKey, emailKey, err)
 		return
 	}
 
-	// create a json web token (JWT) and return it as response
-	accessToken, accessClaims, err := h.TokenMaker.CreateToken(ur.GetId(), ur.GetEmail(), ur.GetIsAdmin(), 15*time.Minute)
-	if err != nil {
-		http.Error(w, "error creating token", http.StatusInternalServerError)
+	if res.GetMfaRequired() {
+		// the code is counted as another login attempt
+		if err := h.loginThrottle.release(r.Context(), ipKey, emailKey); err != nil {
+			internalError(w, r, "error releasing login attempt", err)
+			return
+		}
+		h.challengeMFA(w, r, res.GetUser())
 		return
 	}
 
-	refreshToken, refreshClaims, err := h.TokenMaker.CreateToken(ur.GetId(), ur.GetEmail(), ur.GetIsAdmin(), 24*time.Hour)
-	if err != nil {
-		http.Error(w, "error creating token", http.StatusInternalServerError)
+	if err := h.loginThrottle.ByIP.Release(r.Context(), ipKey); err != nil {
+		internalError(w, r, "error releasing login attempt", err)
 		return
 	}
 
-	session, err := h.client.CreateSession(h.ctx, &pb.SessionReq{
-		Id:           refreshClaims.RegisteredClaims.ID,
-		UserEmail:    ur.GetEmail(),
-		RefreshToken: refreshToken,
-		IsRevoked:    false,
-		ExpiresAt:    timestamppb.New(refreshClaims.RegisteredClaims.ExpiresAt.Time),
-	})
+	h.completeLogin(w, r, res, emailKey)
+}
+
+// completeLogin answers with the tokens of the session the gRPC service
+// started for the login.
+func (h *handler) completeLogin(w http.ResponseWriter, r *http.Request, lr *pb.LoginRes, emailKey string) {
+	if err := h.loginThrottle.ByEmail.Reset(r.Context(), emailKey); err != nil {
+		internalError(w, r, "error resetting login attempts", err)
+		return
+	}
+
+	ur := lr.GetUser()
+	permissions, enrollMFA := h.tokenPermissions(ur)
+	accessToken, accessClaims, err := h.TokenMaker.CreateToken(ur.GetId(), ur.GetEmail(), permissions, lr.GetSessionId(), 15*time.Minute)
 	if err != nil {
-		http.Error(w, "error creating session", http.StatusInternalServerError)
+		internalError(w, r, "error creating token", err)
 		return
 	}
 
 	res := LoginUserRes{
-		SessionID:             session.GetId(),
+		SessionID:             lr.GetSessionId(),
 		AccessToken:           accessToken,
-		RefreshToken:          refreshToken,
+		RefreshToken:          lr.GetRefreshToken(),
 		AccessTokenExpiresAt:  accessClaims.RegisteredClaims.ExpiresAt.Time,
-		RefreshTokenExpiresAt: refreshClaims.RegisteredClaims.ExpiresAt.Time,
+		RefreshTokenExpiresAt: lr.GetRefreshTokenExpiresAt().AsTime(),
 		User:                  toUserRes(ur),
+		MFAEnrollmentRequired: enrollMFA,
+	}
+	res.User.Permissions = permissions
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// loginError answers a login the gRPC service rejected. Only wrong
+// credentials count towards the login throttle.
+func (h *handler) loginError(w http.ResponseWriter, r *http.Request, ipKey, emailKey string, err error) {
+	if status.Code(err) != codes.Unauthenticated {
+		if err := h.loginThrottle.release(r.Context(), ipKey, emailKey); err != nil {
+			internalError(w, r, "error releasing login attempt", err)
+			return
+		}
+	}
+
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		h.rejectLogin(w, r, ipKey, emailKey, retryDelay(err), status.Convert(err).Message())
+	case codes.ResourceExhausted:
+		setRetryAfter(w, retryDelay(err))
+		http.Error(w, "account locked", http.StatusLocked)
+	case codes.FailedPrecondition:
+		http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+	default:
+		internalError(w, r, "error logging in", err)
+	}
+}
+
+// rejectLogin answers a login with a wrong email, password or code, which
+// reserve already counted, telling the client how long to wait if it is being
+// throttled or, if the failure locked the account, how long the lock lasts.
+func (h *handler) rejectLogin(w http.ResponseWriter, r *http.Request, ipKey, emailKey string, locked time.Duration, msg string) {
+	wait, err := h.loginThrottle.wait(r.Context(), ipKey, emailKey)
+	if err != nil {
+		internalError(w, r, "error checking login attempts", err)
+		return
+	}
+
+	if locked > 0 {
+		setRetryAfter(w, locked)
+		http.Error(w, "account locked", http.StatusLocked)
+		return
+	}
+
+	setRetryAfter(w, wait)
+	http.Error(w, msg, http.StatusUnauthorized)
+}
+
+// retryDelay returns how long the gRPC service asks to wait before trying
+// again, which is how long an account stays locked.
+func retryDelay(err error) time.Duration {
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			return ri.GetRetryDelay().AsDuration()
+		}
+	}
+	return 0
+}
+
+// challengeMFA answers the login of a user with two-factor authentication,
+// whose password was right, with a token to complete the login with.
+func (h *handler) challengeMFA(w http.ResponseWriter, r *http.Request, ur *pb.UserRes) {
+	mfaToken, claims, err := h.TokenMaker.CreateMFAToken(ur.GetId(), ur.GetEmail(), 5*time.Minute)
+	if err != nil {
+		internalError(w, r, "error creating token", err)
+		return
+	}
+
+	res := MFAChallengeRes{
+		MFARequired:       true,
+		MFAToken:          mfaToken,
+		MFATokenExpiresAt: claims.RegisteredClaims.ExpiresAt.Time,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -355,20 +560,348 @@ func (h *handler) loginUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(res)
 }
 
+// loginMFA completes a login challenged by challengeMFA. Wrong codes count as
+// failed logins, so they are throttled and lock the account like wrong
+// passwords. The MFA token can only be exchanged once.
+func (h *handler) loginMFA(w http.ResponseWriter, r *http.Request) {
+	var req LoginMFAReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.TokenMaker.VerifyToken(req.MFAToken)
+	if err != nil || claims.Purpose != token.PurposeMFA {
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return
+	}
+	isDenied, err := h.denylist.IsDenied(r.Context(), claims.RegisteredClaims.ID)
+	if err != nil {
+		internalError(w, r, "error checking token", err)
+		return
+	}
+	if isDenied {
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return
+	}
+
+	ipKey, emailKey := loginThrottleKeys(r, claims.Email)
+	wait, err := h.loginThrottle.reserve(r.Context(), ipKey, emailKey)
+	if err != nil {
+		internalError(w, r, "error checking login attempts", err)
+		return
+	}
+	if wait > 0 {
+		metrics.LoginFailed(metrics.LoginFailureThrottled)
+		setRetryAfter(w, wait)
+		http.Error(w, "too many login attempts", http.StatusTooManyRequests)
+		return
+	}
+
+	res, err := h.auth.LoginMFA(h.outgoingContext(r), &pb.TOTPReq{
+		UserId: claims.ID,
+		Code:   req.Code,
+	})
+	if status.Code(err) == codes.NotFound {
+		// the user was deleted or turned two-factor authentication off
+		// since the challenge, so it has to log in again
+		if err := h.loginThrottle.release(r.Context(), ipKey, emailKey); err != nil {
+			internalError(w, r, "error releasing login attempt", err)
+			return
+		}
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.loginError(w, r, ipKey, emailKey, err)
+		return
+	}
+
+	err = h.denylist.Deny(r.Context(), claims.RegisteredClaims.ID, claims.RegisteredClaims.ExpiresAt.Time)
+	if err != nil {
+		internalError(w, r, "error revoking token", err)
+		return
+	}
+
+	if err := h.loginThrottle.ByIP.Release(r.Context(), ipKey); err != nil {
+		internalError(w, r, "error releasing login attempt", err)
+		return
+	}
+
+	h.completeLogin(w, r, res, emailKey)
+}
+
+// tokenPermissions returns the permissions to put into the access tokens of
+// the user ur describes. They are withheld from users who hold one of
+// MFARequiredRoles but have not enabled two-factor authentication, which the
+// second return value reports.
+func (h *handler) tokenPermissions(ur *pb.UserRes) ([]string, bool) {
+	if ur.GetTotpEnabled() {
+		return ur.GetPermissions(), false
+	}
+
+	for _, role := range ur.GetRoles() {
+		if slices.Contains(h.MFARequiredRoles, role) {
+			return nil, true
+		}
+	}
+
+	return ur.GetPermissions(), false
+}
+
+func (h *handler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	ur, err := h.client.UnlockUser(h.outgoingContext(r), &pb.UserReq{Id: i})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+			return
+		}
+		internalError(w, r, "error unlocking user", err)
+		return
+	}
+
+	if err := h.loginThrottle.ByEmail.Reset(r.Context(), emailThrottleKey(ur.GetEmail())); err != nil {
+		internalError(w, r, "error resetting login attempts", err)
+		return
+	}
+
+	res := toUserRes(ur)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) setUserRoles(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UserRolesReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	ur, err := h.client.SetUserRoles(h.outgoingContext(r), &pb.UserRolesReq{
+		UserId: i,
+		Roles:  req.Roles,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		case codes.NotFound:
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+		default:
+			internalError(w, r, "error setting user roles", err)
+		}
+		return
+	}
+
+	res := toUserRes(ur)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listRoles(w http.ResponseWriter, r *http.Request) {
+	lr, err := h.client.ListRoles(h.outgoingContext(r), &pb.ListRolesReq{})
+	if err != nil {
+		internalError(w, r, "error listing roles", err)
+		return
+	}
+
+	res := ListRolesRes{Roles: []RoleRes{}}
+	for _, role := range lr.GetRoles() {
+		res.Roles = append(res.Roles, toRoleRes(role))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// forgotPassword mails a reset link if the email is registered. The response
+// is the same either way.
+func (h *handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	// registered or not, every email and client IP is throttled the same
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	wait, err := h.reserveMail(r.Context(), "reset:"+email, "reset-ip:"+clientIP(r))
+	if err != nil {
+		internalError(w, r, "error checking password reset attempts", err)
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		http.Error(w, "password reset was requested recently", http.StatusTooManyRequests)
+		return
+	}
+
+	_, err = h.client.RequestPasswordReset(h.outgoingContext(r), &pb.PasswordResetReq{
+		Email: req.Email,
+	})
+	if err != nil {
+		internalError(w, r, "error requesting password reset", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.client.ResetPassword(h.outgoingContext(r), &pb.PasswordResetReq{
+		Token:    req.Token,
+		Password: req.Password,
+	})
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		internalError(w, r, "error resetting password", err)
+		return
+	}
+
+	if err := h.loginThrottle.ByEmail.Reset(r.Context(), emailThrottleKey(res.GetEmail())); err != nil {
+		internalError(w, r, "error resetting login attempts", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changePassword sets a new password for the caller, who has to know the
+// current one. Every other session of the caller is logged out.
+func (h *handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.auth.ChangePassword(h.outgoingContext(r), &pb.ChangePasswordReq{
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		case codes.PermissionDenied:
+			setRetryAfter(w, retryDelay(err))
+			http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+		case codes.ResourceExhausted:
+			setRetryAfter(w, retryDelay(err))
+			http.Error(w, "account locked", http.StatusLocked)
+		case codes.Aborted:
+			http.Error(w, status.Convert(err).Message(), http.StatusConflict)
+		default:
+			internalError(w, r, "error changing password", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	tok := r.URL.Query().Get("token")
+	if tok == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+
+	ur, err := h.client.VerifyEmail(h.outgoingContext(r), &pb.EmailVerificationReq{Token: tok})
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		internalError(w, r, "error verifying email", err)
+		return
+	}
+
+	res := toUserRes(ur)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// resendVerification mails a new verification link if the email is registered
+// and not verified yet. The response is the same either way, except that
+// repeated requests for the same email are throttled.
+func (h *handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	wait, err := h.reserveMail(r.Context(), "resend:"+strings.ToLower(strings.TrimSpace(req.Email)))
+	if err != nil {
+		internalError(w, r, "error checking resend attempts", err)
+		return
+	}
+	if wait > 0 {
+		setRetryAfter(w, wait)
+		http.Error(w, "verification email was sent recently", http.StatusTooManyRequests)
+		return
+	}
+
+	_, err = h.client.ResendVerificationEmail(h.outgoingContext(r), &pb.EmailVerificationReq{Email: req.Email})
+	if err != nil {
+		internalError(w, r, "error resending verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// logoutUser revokes the session the request is made from, so that it can
+// no longer be renewed, and denies the access token the request is made with.
 func (h *handler) logoutUser(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value(authKey{}).(*token.UserClaims)
 
-	_, err := h.client.DeleteSession(h.ctx, &pb.SessionReq{
-		Id: claims.RegisteredClaims.ID,
-	})
+	_, err := h.auth.Logout(h.outgoingContext(r), &pb.LogoutReq{})
 	if err != nil {
-		http.Error(w, "error deleting session", http.StatusInternalServerError)
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		internalError(w, r, "error revoking session", err)
+		return
+	}
+
+	err = h.denylist.Deny(r.Context(), claims.RegisteredClaims.ID, claims.RegisteredClaims.ExpiresAt.Time)
+	if err != nil {
+		internalError(w, r, "error revoking token", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// renewAccessToken exchanges a refresh token for a new access token and a
+// new refresh token. The presented refresh token is used up; reusing it
+// revokes every session of the login it belongs to.
 func (h *handler) renewAccessToken(w http.ResponseWriter, r *http.Request) {
 	var req RenewAccessTokenReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -376,56 +909,406 @@ func (h *handler) renewAccessToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	refreshClaims, err := h.TokenMaker.VerifyToken(req.RefreshToken)
+	lr, err := h.auth.RenewToken(h.outgoingContext(r), &pb.RenewTokenReq{
+		RefreshToken: req.RefreshToken,
+	})
 	if err != nil {
-		http.Error(w, "error verifying token", http.StatusUnauthorized)
+		if status.Code(err) == codes.Unauthenticated {
+			http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+			return
+		}
+		internalError(w, r, "error renewing token", err)
 		return
 	}
 
-	session, err := h.client.GetSession(h.ctx, &pb.SessionReq{
-		Id: refreshClaims.RegisteredClaims.ID,
+	// permissions are looked up again, so that role changes apply from the
+	// next renewal on
+	ur := lr.GetUser()
+	permissions, _ := h.tokenPermissions(ur)
+	accessToken, accessClaims, err := h.TokenMaker.CreateToken(ur.GetId(), ur.GetEmail(), permissions, lr.GetSessionId(), 15*time.Minute)
+	if err != nil {
+		internalError(w, r, "error creating token", err)
+		return
+	}
+
+	res := RenewAccessTokenRes{
+		SessionID:             lr.GetSessionId(),
+		AccessToken:           accessToken,
+		RefreshToken:          lr.GetRefreshToken(),
+		AccessTokenExpiresAt:  accessClaims.RegisteredClaims.ExpiresAt.Time,
+		RefreshTokenExpiresAt: lr.GetRefreshTokenExpiresAt().AsTime(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listMySessions(w http.ResponseWriter, r *http.Request) {
+	sr, err := h.client.ListSessions(h.outgoingContext(r), &pb.ListSessionsReq{})
+	if err != nil {
+		internalError(w, r, "error listing sessions", err)
+		return
+	}
+
+	res := ListSessionsRes{Sessions: []SessionRes{}}
+	for _, s := range sr.GetSessions() {
+		res.Sessions = append(res.Sessions, toSessionRes(s))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) deleteMySession(w http.ResponseWriter, r *http.Request) {
+	h.revokeMySession(w, r, chi.URLParam(r, "id"))
+}
+
+func (h *handler) revokeMySession(w http.ResponseWriter, r *http.Request, sessionID string) {
+	_, err := h.client.RevokeMySession(h.outgoingContext(r), &pb.RevokeSessionsReq{
+		SessionId: sessionID,
 	})
 	if err != nil {
-		http.Error(w, "error getting session", http.StatusInternalServerError)
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		case codes.NotFound:
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+		default:
+			internalError(w, r, "error revoking session", err)
+		}
 		return
 	}
 
-	if session.IsRevoked {
-		http.Error(w, "session revoked", http.StatusUnauthorized)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteMyOtherSessions logs the user out everywhere but in the session the
+// request is made from.
+func (h *handler) deleteMyOtherSessions(w http.ResponseWriter, r *http.Request) {
+	res, err := h.client.RevokeMyOtherSessions(h.outgoingContext(r), &pb.RevokeSessionsReq{})
+	if err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+			return
+		}
+		internalError(w, r, "error revoking sessions", err)
 		return
 	}
 
-	if session.GetUserEmail() != refreshClaims.Email {
-		http.Error(w, "invalid session", http.StatusUnauthorized)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevokeSessionsRes{Revoked: res.GetRevoked()})
+}
+
+func (h *handler) deleteUserSessions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
 		return
 	}
 
-	accessToken, accessClaims, err := h.TokenMaker.CreateToken(refreshClaims.ID, refreshClaims.Email, refreshClaims.IsAdmin, 15*time.Minute)
+	res, err := h.client.RevokeUserSessions(h.outgoingContext(r), &pb.RevokeSessionsReq{UserId: i})
 	if err != nil {
-		http.Error(w, "error creating token", http.StatusInternalServerError)
+		if status.Code(err) == codes.NotFound {
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+			return
+		}
+		internalError(w, r, "error revoking sessions", err)
 		return
 	}
 
-	res := RenewAccessTokenRes{
-		AccessToken:          accessToken,
-		AccessTokenExpiresAt: accessClaims.RegisteredClaims.ExpiresAt.Time,
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RevokeSessionsRes{Revoked: res.GetRevoked()})
+}
+
+func (h *handler) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	res, err := h.client.EnrollTOTP(h.outgoingContext(r), &pb.TOTPReq{})
+	if err != nil {
+		writeTOTPError(w, r, "error enrolling totp", err)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TOTPEnrollmentRes{
+		Secret: res.GetSecret(),
+		URI:    res.GetUri(),
+	})
+}
+
+func (h *handler) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req TOTPReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.client.ConfirmTOTP(h.outgoingContext(r), &pb.TOTPReq{Code: req.Code})
+	if err != nil {
+		writeTOTPError(w, r, "error confirming totp", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TOTPRecoveryCodesRes{RecoveryCodes: res.GetRecoveryCodes()})
+}
+
+func (h *handler) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req TOTPReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.client.DisableTOTP(h.outgoingContext(r), &pb.TOTPReq{Code: req.Code})
+	if err != nil {
+		writeTOTPError(w, r, "error disabling totp", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTOTPError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+	case codes.FailedPrecondition:
+		http.Error(w, status.Convert(err).Message(), http.StatusConflict)
+	case codes.PermissionDenied:
+		http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+	case codes.NotFound:
+		http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+	default:
+		internalError(w, r, msg, err)
+	}
+}
+
+func (h *handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req APIKeyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.client.CreateAPIKey(h.outgoingContext(r), toPBAPIKeyReq(req))
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		case codes.PermissionDenied:
+			http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+		case codes.NotFound:
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+		default:
+			internalError(w, r, "error creating api key", err)
+		}
+		return
+	}
+
+	res := toAPIKeyRes(created)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.client.ListAPIKeys(h.outgoingContext(r), &pb.ListAPIKeysReq{})
+	if err != nil {
+		internalError(w, r, "error listing api keys", err)
+		return
+	}
+
+	res := []APIKeyRes{}
+	for _, k := range keys.GetKeys() {
+		res = append(res, toAPIKeyRes(k))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.client.RevokeAPIKey(h.outgoingContext(r), &pb.APIKeyReq{Id: i})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			http.Error(w, status.Convert(err).Message(), http.StatusNotFound)
+			return
+		}
+		internalError(w, r, "error revoking api key", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req WebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.client.CreateWebhook(h.outgoingContext(r), toPBWebhookReq(req))
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		internalError(w, r, "error creating webhook", err)
+		return
+	}
+
+	res := toWebhookRes(created)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.client.GetAllWebhooks(h.outgoingContext(r), &pb.WebhookReq{})
+	if err != nil {
+		internalError(w, r, "error listing webhooks", err)
+		return
+	}
+
+	res := []WebhookRes{}
+	for _, wh := range webhooks.GetWebhooks() {
+		res = append(res, toWebhookRes(wh))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := h.client.GetWebhook(h.outgoingContext(r), &pb.WebhookReq{Id: i})
+	if err != nil {
+		internalError(w, r, "error getting webhook", err)
+		return
+	}
+
+	res := toWebhookRes(webhook)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	var req WebhookReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		return
+	}
+
+	pw := toPBWebhookReq(req)
+	pw.Id = i
+
+	updated, err := h.client.UpdateWebhook(h.outgoingContext(r), pw)
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+			return
+		}
+		internalError(w, r, "error updating webhook", err)
+		return
+	}
+
+	res := toWebhookRes(updated)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
 }
 
-func (h *handler) revokeSession(w http.ResponseWriter, r *http.Request) {
-	claims := r.Context().Value(authKey{}).(*token.UserClaims)
+func (h *handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
 
-	_, err := h.client.RevokeSession(h.ctx, &pb.SessionReq{
-		Id: claims.RegisteredClaims.ID,
-	})
+	_, err = h.client.DeleteWebhook(h.outgoingContext(r), &pb.WebhookReq{Id: i})
 	if err != nil {
-		http.Error(w, "error revoking session", http.StatusInternalServerError)
+		internalError(w, r, "error deleting webhook", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+func (h *handler) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.client.GetAllWebhookDeliveries(h.outgoingContext(r), &pb.WebhookDeliveryReq{WebhookId: i})
+	if err != nil {
+		internalError(w, r, "error listing webhook deliveries", err)
+		return
+	}
+
+	res := []WebhookDeliveryRes{}
+	for _, d := range deliveries.GetDeliveries() {
+		res = append(res, toWebhookDeliveryRes(d))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing ID", http.StatusBadRequest)
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		http.Error(w, "error parsing delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.client.RedeliverWebhook(h.outgoingContext(r), &pb.WebhookDeliveryReq{
+		Id:        deliveryID,
+		WebhookId: webhookID,
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			http.Error(w, "webhook delivery not found", http.StatusNotFound)
+			return
+		}
+		internalError(w, r, "error redelivering webhook", err)
+		return
+	}
+
+	res := toWebhookDeliveryRes(delivery)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(res)
+}
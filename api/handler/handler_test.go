@@ -0,0 +1,556 @@
+package handler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/denylist"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/password"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/throttle"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// rotateClient fakes RenewToken, rejecting refresh tokens that were already
+// renewed.
+type rotateClient struct {
+	pb.AuthServiceClient
+	used    map[string]bool
+	renewed int
+}
+
+func (c *rotateClient) RenewToken(ctx context.Context, in *pb.RenewTokenReq, opts ...grpc.CallOption) (*pb.LoginRes, error) {
+	if c.used[in.GetRefreshToken()] {
+		return nil, status.Error(codes.Unauthenticated, "refresh token reused")
+	}
+	c.used[in.GetRefreshToken()] = true
+	c.renewed++
+
+	return &pb.LoginRes{
+		User:                  &pb.UserRes{Id: 1, Email: "john@example.com", Permissions: []string{rbac.OrdersReadAll}},
+		SessionId:             "session",
+		RefreshToken:          fmt.Sprintf("refresh-token-%d", c.renewed),
+		RefreshTokenExpiresAt: timestamppb.New(time.Now().Add(24 * time.Hour)),
+	}, nil
+}
+
+func TestRenewAccessTokenRotatesRefreshToken(t *testing.T) {
+	h := NewHandler(nil, &rotateClient{used: map[string]bool{}}, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, nil)
+
+	renew := func(refreshToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tokens/renew", strings.NewReader(`{"refresh_token":"`+refreshToken+`"}`))
+		w := httptest.NewRecorder()
+		h.renewAccessToken(w, req)
+		return w
+	}
+
+	w := renew("refresh-token-0")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var res RenewAccessTokenRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	require.NotEmpty(t, res.AccessToken)
+	require.Equal(t, "refresh-token-1", res.RefreshToken)
+	require.True(t, res.RefreshTokenExpiresAt.After(time.Now()))
+	require.Equal(t, "session", res.SessionID)
+
+	accessClaims, err := h.TokenMaker.VerifyToken(res.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "session", accessClaims.SessionID)
+	require.Equal(t, []string{rbac.OrdersReadAll}, accessClaims.Permissions)
+
+	require.Equal(t, http.StatusOK, renew(res.RefreshToken).Code)
+
+	w = renew("refresh-token-0")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), "refresh token reused")
+}
+
+// sessionsClient fakes the session management RPCs and Logout, recording
+// which one was called.
+type sessionsClient struct {
+	pb.GolangMicroserviceClient
+	pb.AuthServiceClient
+	called string
+}
+
+func (c *sessionsClient) Logout(ctx context.Context, in *pb.LogoutReq, opts ...grpc.CallOption) (*pb.RevokeSessionsRes, error) {
+	c.called = "Logout"
+	return &pb.RevokeSessionsRes{Revoked: 1}, nil
+}
+
+func (c *sessionsClient) ListSessions(ctx context.Context, in *pb.ListSessionsReq, opts ...grpc.CallOption) (*pb.ListSessionsRes, error) {
+	c.called = "ListSessions"
+	return &pb.ListSessionsRes{}, nil
+}
+
+func (c *sessionsClient) RevokeMySession(ctx context.Context, in *pb.RevokeSessionsReq, opts ...grpc.CallOption) (*pb.RevokeSessionsRes, error) {
+	c.called = "RevokeMySession " + in.GetSessionId()
+	return &pb.RevokeSessionsRes{Revoked: 1}, nil
+}
+
+func (c *sessionsClient) RevokeMyOtherSessions(ctx context.Context, in *pb.RevokeSessionsReq, opts ...grpc.CallOption) (*pb.RevokeSessionsRes, error) {
+	c.called = "RevokeMyOtherSessions"
+	return &pb.RevokeSessionsRes{Revoked: 2}, nil
+}
+
+func (c *sessionsClient) RevokeUserSessions(ctx context.Context, in *pb.RevokeSessionsReq, opts ...grpc.CallOption) (*pb.RevokeSessionsRes, error) {
+	c.called = "RevokeUserSessions"
+	return &pb.RevokeSessionsRes{Revoked: 3}, nil
+}
+
+func TestSessionRoutes(t *testing.T) {
+	client := &sessionsClient{}
+	h := NewHandler(client, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	userToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", nil, "f1", time.Minute)
+	require.NoError(t, err)
+	adminToken, _, err := h.TokenMaker.CreateToken(2, "admin@example.com", []string{rbac.UsersRevokeSessions}, "f2", time.Minute)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		method, path, token string
+		code                int
+		called              string
+	}{
+		{http.MethodGet, "/users/me/sessions", userToken, http.StatusOK, "ListSessions"},
+		{http.MethodDelete, "/users/me/sessions", userToken, http.StatusOK, "RevokeMyOtherSessions"},
+		{http.MethodDelete, "/users/me/sessions/f9", userToken, http.StatusNoContent, "RevokeMySession f9"},
+		{http.MethodDelete, "/users/7/sessions", userToken, http.StatusForbidden, ""},
+		{http.MethodDelete, "/users/7/sessions", adminToken, http.StatusOK, "RevokeUserSessions"},
+		// revokes userToken, so it goes last
+		{http.MethodPost, "/tokens/revoke", userToken, http.StatusNoContent, "Logout"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			client.called = ""
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.code, w.Code, w.Body.String())
+			require.Equal(t, tc.called, client.called)
+		})
+	}
+}
+
+func TestLogoutRevokesToken(t *testing.T) {
+	client := &sessionsClient{}
+	h := NewHandler(client, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	accessToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", nil, "f1", time.Minute)
+	require.NoError(t, err)
+	otherToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", nil, "f2", time.Minute)
+	require.NoError(t, err)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusNoContent, do(http.MethodPost, "/users/logout", accessToken).Code)
+	require.Equal(t, "Logout", client.called)
+
+	w := do(http.MethodGet, "/users/me/sessions", accessToken)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Contains(t, w.Body.String(), "token has been revoked")
+
+	require.Equal(t, http.StatusOK, do(http.MethodGet, "/users/me/sessions", otherToken).Code)
+}
+
+// passwordClient fakes ChangePassword for a user whose password is secret,
+// locking the account on the current password "locked".
+type passwordClient struct {
+	pb.AuthServiceClient
+	changed string
+}
+
+func (c *passwordClient) ChangePassword(ctx context.Context, in *pb.ChangePasswordReq, opts ...grpc.CallOption) (*pb.RevokeSessionsRes, error) {
+	if in.GetCurrentPassword() == "locked" {
+		return nil, status.Error(codes.ResourceExhausted, "account locked")
+	}
+	if in.GetCurrentPassword() != "secret" {
+		return nil, status.Error(codes.PermissionDenied, "current password is wrong")
+	}
+	if len(in.GetNewPassword()) < 8 {
+		return nil, status.Error(codes.InvalidArgument, "password must be at least 8 characters long")
+	}
+	c.changed = in.GetNewPassword()
+	return &pb.RevokeSessionsRes{Revoked: 2}, nil
+}
+
+func TestChangePassword(t *testing.T) {
+	client := &passwordClient{}
+	h := NewHandler(nil, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	userToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", nil, "f1", time.Minute)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name, auth, body string
+		code             int
+	}{
+		{"without token", "", `{"current_password":"secret","new_password":"battery staple"}`, http.StatusUnauthorized},
+		{"wrong current password", "Bearer " + userToken, `{"current_password":"guess","new_password":"battery staple"}`, http.StatusForbidden},
+		{"locked account", "Bearer " + userToken, `{"current_password":"locked","new_password":"battery staple"}`, http.StatusLocked},
+		{"policy", "Bearer " + userToken, `{"current_password":"secret","new_password":"short"}`, http.StatusBadRequest},
+		{"success", "Bearer " + userToken, `{"current_password":"secret","new_password":"battery staple"}`, http.StatusNoContent},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/me/password", strings.NewReader(tc.body))
+			req.Header.Set("Authorization", tc.auth)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.code, w.Code, w.Body.String())
+		})
+	}
+	require.Equal(t, "battery staple", client.changed)
+}
+
+// ordersClient fakes DeleteOrder for orders 1 of user 1 and 2 of user 2.
+type ordersClient struct {
+	pb.GolangMicroserviceClient
+}
+
+func (c *ordersClient) DeleteOrder(ctx context.Context, in *pb.OrderReq, opts ...grpc.CallOption) (*pb.OrderRes, error) {
+	switch in.GetId() {
+	case 1:
+		return &pb.OrderRes{}, nil
+	case 2:
+		return nil, status.Error(codes.PermissionDenied, "order 2 belongs to another user")
+	}
+	return nil, status.Errorf(codes.NotFound, "order %d not found", in.GetId())
+}
+
+func TestDeleteOrder(t *testing.T) {
+	h := NewHandler(&ordersClient{}, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	userToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", nil, "f1", time.Minute)
+	require.NoError(t, err)
+
+	for path, code := range map[string]int{
+		"/orders/1/":   http.StatusNoContent,
+		"/orders/2/":   http.StatusForbidden,
+		"/orders/3/":   http.StatusNotFound,
+		"/orders/abc/": http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, code, w.Code, path)
+	}
+}
+
+// checkoutClient fakes CreateOrder for a user whose email address is not
+// verified, rejecting idempotency key "k1" as reused for another request.
+type checkoutClient struct {
+	pb.GolangMicroserviceClient
+}
+
+func (c *checkoutClient) CreateOrder(ctx context.Context, in *pb.OrderReq, opts ...grpc.CallOption) (*pb.OrderRes, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if keys := md.Get("idempotency-key"); len(keys) > 0 && keys[0] == "k1" {
+		st, err := status.New(codes.FailedPrecondition, "idempotency key was already used for a different request").
+			WithDetails(&errdetails.ErrorInfo{Reason: "IDEMPOTENCY_KEY_REUSED", Domain: "golang-microservice"})
+		if err != nil {
+			return nil, err
+		}
+		return nil, st.Err()
+	}
+	return nil, status.Error(codes.FailedPrecondition, "email address is not verified")
+}
+
+func TestCreateOrderUnverifiedEmail(t *testing.T) {
+	h := NewHandler(&checkoutClient{}, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	userToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", nil, "f1", time.Minute)
+	require.NoError(t, err)
+
+	for key, code := range map[string]int{
+		"":   http.StatusForbidden,
+		"k2": http.StatusForbidden,
+		"k1": http.StatusUnprocessableEntity,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/orders/", strings.NewReader(`{"items":[],"total_price":10}`))
+		req.Header.Set("Authorization", "Bearer "+userToken)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, code, w.Code, key)
+	}
+}
+
+// rolesClient fakes the role RPCs.
+type rolesClient struct {
+	pb.GolangMicroserviceClient
+}
+
+func (c *rolesClient) SetUserRoles(ctx context.Context, in *pb.UserRolesReq, opts ...grpc.CallOption) (*pb.UserRes, error) {
+	for _, role := range in.GetRoles() {
+		if role != rbac.RoleWarehouse {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown role %q", role)
+		}
+	}
+	return &pb.UserRes{Id: in.GetUserId(), Roles: in.GetRoles(), Permissions: []string{rbac.OrdersReadAll, rbac.OrdersUpdateStatus}}, nil
+}
+
+func (c *rolesClient) ListRoles(ctx context.Context, in *pb.ListRolesReq, opts ...grpc.CallOption) (*pb.ListRolesRes, error) {
+	return &pb.ListRolesRes{Roles: []*pb.RoleRes{{Name: rbac.RoleWarehouse, Permissions: []string{rbac.OrdersReadAll}}}}, nil
+}
+
+func TestRoleRoutes(t *testing.T) {
+	h := NewHandler(&rolesClient{}, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	userToken, _, err := h.TokenMaker.CreateToken(1, "john@example.com", []string{rbac.OrdersReadAll}, "f1", time.Minute)
+	require.NoError(t, err)
+	managerToken, _, err := h.TokenMaker.CreateToken(2, "admin@example.com", []string{rbac.RolesManage}, "f2", time.Minute)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		method, path, token, body string
+		code                      int
+	}{
+		{http.MethodGet, "/roles", userToken, "", http.StatusForbidden},
+		{http.MethodGet, "/roles", managerToken, "", http.StatusOK},
+		{http.MethodPut, "/users/7/roles", userToken, `{"roles":["warehouse"]}`, http.StatusForbidden},
+		{http.MethodPut, "/users/7/roles", managerToken, `{"roles":["warehouse"]}`, http.StatusOK},
+		{http.MethodPut, "/users/7/roles", managerToken, `{"roles":["pirate"]}`, http.StatusBadRequest},
+		{http.MethodGet, "/orders", managerToken, "", http.StatusForbidden},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.method+" "+tc.path+" "+tc.body, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.code, w.Code, w.Body.String())
+		})
+	}
+}
+
+// apiKeysClient fakes the API key RPCs and accepts a single key. It records
+// the authorization metadata orders were listed with.
+type apiKeysClient struct {
+	pb.GolangMicroserviceClient
+	pb.AuthServiceClient
+	authorization string
+}
+
+func (c *apiKeysClient) Logout(ctx context.Context, in *pb.LogoutReq, opts ...grpc.CallOption) (*pb.RevokeSessionsRes, error) {
+	return nil, status.Error(codes.InvalidArgument, "api keys have no session, revoke the key instead")
+}
+
+func (c *apiKeysClient) AuthenticateAPIKey(ctx context.Context, in *pb.AuthenticateAPIKeyReq, opts ...grpc.CallOption) (*pb.AuthenticateAPIKeyRes, error) {
+	if in.GetKey() != "partner-key" {
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	return &pb.AuthenticateAPIKeyRes{UserId: 3, Email: "partner@example.com", Permissions: []string{rbac.OrdersReadAll}, Prefix: "gmk_partner"}, nil
+}
+
+func (c *apiKeysClient) GetAllOrders(ctx context.Context, in *pb.OrderReq, opts ...grpc.CallOption) (*pb.ListOrderRes, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	c.authorization = strings.Join(md.Get("authorization"), ",")
+	return &pb.ListOrderRes{}, nil
+}
+
+func (c *apiKeysClient) CreateAPIKey(ctx context.Context, in *pb.APIKeyReq, opts ...grpc.CallOption) (*pb.APIKeyRes, error) {
+	return &pb.APIKeyRes{Id: 1, Name: in.GetName(), Prefix: "gmk_partner", Scopes: in.GetScopes(), Key: "partner-key"}, nil
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	client := &apiKeysClient{}
+	h := NewHandler(client, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	managerToken, _, err := h.TokenMaker.CreateToken(2, "admin@example.com", []string{rbac.APIKeysManage, rbac.OrdersReadAll}, "f2", time.Minute)
+	require.NoError(t, err)
+
+	tcs := []struct {
+		method, path, auth, body string
+		code                     int
+	}{
+		{http.MethodGet, "/orders", "ApiKey partner-key", "", http.StatusOK},
+		{http.MethodGet, "/orders", "ApiKey stolen-key", "", http.StatusUnauthorized},
+		{http.MethodGet, "/orders", "Basic partner-key", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/users/7", "ApiKey partner-key", "", http.StatusForbidden},
+		{http.MethodPost, "/users/logout", "ApiKey partner-key", "", http.StatusBadRequest},
+		{http.MethodPost, "/api-keys", "ApiKey partner-key", `{"name":"again","scopes":["orders:read_all"]}`, http.StatusForbidden},
+		{http.MethodPost, "/api-keys", "Bearer " + managerToken, `{"name":"partner","user_id":3,"scopes":["orders:read_all"]}`, http.StatusCreated},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.method+" "+tc.path+" "+tc.auth, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", tc.auth)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.code, w.Code, w.Body.String())
+		})
+	}
+
+	// the key is passed on, so that the gRPC service checks it too
+	require.Equal(t, "ApiKey partner-key", client.authorization)
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	signing, err := token.ParsePEMKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	h := NewHandler(nil, nil, nil, token.NewJWTMakerWithKeys(token.NewKeySet(time.Hour, signing), token.Options{}), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var jwks token.JWKS
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&jwks))
+	require.Len(t, jwks.Keys, 1)
+	require.Equal(t, signing.ID, jwks.Keys[0].KeyID)
+	require.Equal(t, "EC", jwks.Keys[0].KeyType)
+	require.Empty(t, jwks.Keys[0].N)
+}
+
+// mfaLoginClient fakes LoginMFA on top of loginClient, accepting a single
+// code.
+type mfaLoginClient struct {
+	*loginClient
+	code string
+}
+
+func (c *mfaLoginClient) LoginMFA(ctx context.Context, in *pb.TOTPReq, opts ...grpc.CallOption) (*pb.LoginRes, error) {
+	if in.GetCode() != c.code {
+		return nil, c.fail("invalid code")
+	}
+	return c.startSession(), nil
+}
+
+func TestLoginMFA(t *testing.T) {
+	hashed, err := password.DefaultBcrypt().Hash("secret")
+	require.NoError(t, err)
+
+	client := &mfaLoginClient{
+		loginClient: &loginClient{
+			user:      &pb.UserRes{Id: 1, Email: "john@example.com", TotpEnabled: true, Permissions: []string{rbac.OrdersReadAll}},
+			hashed:    hashed,
+			lockAfter: 10,
+		},
+		code: "123456",
+	}
+	store := throttle.NewMemoryStore()
+	cfg := throttle.Config{FreeAttempts: 100, Window: time.Hour}
+	h := NewHandler(nil, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{
+		ByIP:    throttle.NewLimiter(store, cfg),
+		ByEmail: throttle.NewLimiter(store, cfg),
+	}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/users/login", `{"email":"john@example.com","password":"secret"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var challenge MFAChallengeRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&challenge))
+	require.True(t, challenge.MFARequired)
+	require.NotEmpty(t, challenge.MFAToken)
+
+	// the mfa token is no access token
+	req := httptest.NewRequest(http.MethodGet, "/users/me/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+challenge.MFAToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = post("/users/login/mfa", `{"mfa_token":"`+challenge.MFAToken+`","code":"654321"}`)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, int64(1), client.user.FailedLoginAttempts)
+
+	w = post("/users/login/mfa", `{"mfa_token":"`+challenge.MFAToken+`","code":"123456"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res LoginUserRes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	require.NotEmpty(t, res.AccessToken)
+	require.Equal(t, []string{rbac.OrdersReadAll}, res.User.Permissions)
+	require.Equal(t, 1, client.successes)
+
+	// the mfa token is used up
+	w = post("/users/login/mfa", `{"mfa_token":"`+challenge.MFAToken+`","code":"123456"}`)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokenPermissionsRequireMFA(t *testing.T) {
+	h := NewHandler(nil, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	h.MFARequiredRoles = []string{rbac.RoleSuperuser}
+
+	permissions, enroll := h.tokenPermissions(&pb.UserRes{Roles: []string{rbac.RoleSuperuser}, Permissions: []string{rbac.UsersRead}})
+	require.Nil(t, permissions)
+	require.True(t, enroll)
+
+	permissions, enroll = h.tokenPermissions(&pb.UserRes{Roles: []string{rbac.RoleSuperuser}, Permissions: []string{rbac.UsersRead}, TotpEnabled: true})
+	require.Equal(t, []string{rbac.UsersRead}, permissions)
+	require.False(t, enroll)
+
+	permissions, enroll = h.tokenPermissions(&pb.UserRes{Roles: []string{rbac.RoleWarehouse}, Permissions: []string{rbac.OrdersReadAll}})
+	require.Equal(t, []string{rbac.OrdersReadAll}, permissions)
+	require.False(t, enroll)
+}
+
+func TestMetricsNotPublic(t *testing.T) {
+	h := NewHandler(nil, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, nil, denylist.NewMemory())
+	router := RegisterRoutes(h, Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type healthRes struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthz reports that the gateway process is up. It does not look at any
+// dependency, so that a slow database does not get the gateway restarted.
+func (h *handler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthRes{Status: "ok"})
+}
+
+// readyz reports whether the gateway can serve traffic, which requires the
+// gRPC service to report itself as serving.
+func (h *handler) readyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthRes{Status: "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	res, err := h.health.Check(ctx, &healthpb.HealthCheckRequest{
+		Service: pb.GolangMicroservice_ServiceDesc.ServiceName,
+	})
+	if err != nil {
+		writeHealth(w, http.StatusServiceUnavailable, healthRes{Status: "unavailable", Error: "grpc service health check failed"})
+		return
+	}
+
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		writeHealth(w, http.StatusServiceUnavailable, healthRes{Status: "unavailable", Error: "grpc service is " + res.GetStatus().String()})
+		return
+	}
+
+	writeHealth(w, http.StatusOK, healthRes{Status: "ok"})
+}
+
+// Drain makes readiness fail from now on, so that the load balancer stops
+// sending new requests while the server shuts down.
+func (h *handler) Drain() {
+	h.draining.Store(true)
+}
+
+func writeHealth(w http.ResponseWriter, code int, res healthRes) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
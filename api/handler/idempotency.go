@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// withIdempotencyKey forwards the request's Idempotency-Key header to the gRPC
+// service, which scopes it to the caller and tells requests apart by itself.
+func withIdempotencyKey(ctx context.Context, r *http.Request) (context.Context, error) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		return ctx, nil
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, fmt.Errorf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "idempotency-key", key), nil
+}
+
+// writeIdempotencyError writes the response for errors raised by the
+// idempotency interceptor and reports whether err was one of them. They are
+// told apart from errors of the method with the same code by the reason of
+// their ErrorInfo detail.
+func writeIdempotencyError(w http.ResponseWriter, err error) bool {
+	switch idempotencyErrorReason(err) {
+	case "IDEMPOTENCY_KEY_REUSED":
+		http.Error(w, "idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+		return true
+	case "IDEMPOTENCY_KEY_IN_FLIGHT":
+		http.Error(w, "a request with this idempotency key is still being processed", http.StatusConflict)
+		return true
+	}
+
+	return false
+}
+
+func idempotencyErrorReason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if ei, ok := d.(*errdetails.ErrorInfo); ok && ei.GetDomain() == "golang-microservice" {
+			return ei.GetReason()
+		}
+	}
+	return ""
+}
+
+// markReplayed sets the Idempotent-Replayed header if the gRPC response was a
+// replay of a stored one.
+func markReplayed(w http.ResponseWriter, header metadata.MD) {
+	if vals := header.Get("idempotent-replayed"); len(vals) > 0 && vals[0] == "true" {
+		w.Header().Set(idempotentReplayedHeader, "true")
+	}
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/abedsully/golang-microservice/token"
+)
+
+// jwks publishes the public keys tokens are verified with, so that other
+// services can verify tokens without holding a signing key. Keys are ordered
+// by ID; retired keys stay listed for their grace period. Token formats that
+// publish no keys, such as PASETO, serve an empty set.
+func (h *handler) jwks(w http.ResponseWriter, r *http.Request) {
+	set := token.JWKS{Keys: []token.JWK{}}
+	if p, ok := h.TokenMaker.(interface{ JWKS() token.JWKS }); ok {
+		set = p.JWKS()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(set)
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/abedsully/golang-microservice/logging"
+	"github.com/go-chi/chi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// requestLog collects what handlers and middlewares further down learn about
+// a request, such as the authenticated user, for the request's log line.
+type requestLog struct {
+	userID int64
+	err    error
+}
+
+type requestLogKey struct{}
+
+// quietRoutes are polled by infrastructure and only logged at debug level
+// unless they fail.
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+func requestLogFromContext(ctx context.Context) *requestLog {
+	rl, _ := ctx.Value(requestLogKey{}).(*requestLog)
+	if rl == nil {
+		return &requestLog{}
+	}
+	return rl
+}
+
+// loggingMiddleware writes one log line per request and turns panics into a
+// 500 response. It must run after requestIDMiddleware.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rl := &requestLog{}
+		ctx := context.WithValue(r.Context(), requestLogKey{}, rl)
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				rl.err = fmt.Errorf("panic: %v", p)
+				if !sw.wroteHeader {
+					writeInternalError(sw, ctx, "internal server error", http.StatusInternalServerError)
+				}
+			}
+
+			route := "unmatched"
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case sw.code >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case quietRoutes[route]:
+				level = slog.LevelDebug
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sw.code),
+				slog.Duration("latency", time.Since(start)),
+			}
+			if rl.userID != 0 {
+				attrs = append(attrs, slog.Int64("user_id", rl.userID))
+			}
+			if rl.err != nil {
+				attrs = append(attrs, slog.String("error", rl.err.Error()))
+			}
+
+			slog.LogAttrs(ctx, level, "http request", attrs...)
+		}()
+
+		next.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
+
+// logUser records the authenticated user in the request's log line.
+func logUser(ctx context.Context, userID int64) {
+	requestLogFromContext(ctx).userID = userID
+}
+
+// internalError answers with msg and the request ID only, while the full
+// cause is logged with the request. Deadlines that passed and an unavailable
+// gRPC service are answered with 504 and 503 respectively, credentials the
+// gRPC service rejected with 401.
+func internalError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	requestLogFromContext(r.Context()).err = err
+
+	code := http.StatusInternalServerError
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		// the gRPC service rejects tokens of sessions revoked since the
+		// auth middleware let them through
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	writeInternalError(w, r.Context(), msg, code)
+}
+
+func writeInternalError(w http.ResponseWriter, ctx context.Context, msg string, code int) {
+	http.Error(w, fmt.Sprintf("%s (request id: %s)", msg, logging.RequestID(ctx)), code)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/abedsully/golang-microservice/logging"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(logging.ContextHandler{Handler: slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})}))
+	return &buf
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	tcs := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantCode   int
+		wantLevel  string
+		wantUserID float64
+		wantError  string
+	}{
+		{
+			name: "success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				logUser(r.Context(), 7)
+				w.WriteHeader(http.StatusCreated)
+			},
+			wantCode:   http.StatusCreated,
+			wantLevel:  "INFO",
+			wantUserID: 7,
+		},
+		{
+			name: "deadline exceeded",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				internalError(w, r, "error getting order", status.Error(codes.DeadlineExceeded, "context deadline exceeded"))
+			},
+			wantCode:  http.StatusGatewayTimeout,
+			wantLevel: "ERROR",
+			wantError: "rpc error: code = DeadlineExceeded desc = context deadline exceeded",
+		},
+		{
+			name: "revoked token",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				internalError(w, r, "error getting order", status.Error(codes.Unauthenticated, "token revoked"))
+			},
+			wantCode:  http.StatusUnauthorized,
+			wantLevel: "INFO",
+			wantError: "rpc error: code = Unauthenticated desc = token revoked",
+		},
+		{
+			name: "storage failure",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				internalError(w, r, "error getting order", errors.New("connection refused"))
+			},
+			wantCode:  http.StatusInternalServerError,
+			wantLevel: "ERROR",
+			wantError: "connection refused",
+		},
+		{
+			name: "panic",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			},
+			wantCode:  http.StatusInternalServerError,
+			wantLevel: "ERROR",
+			wantError: "panic: boom",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := captureLogs(t)
+
+			r := chi.NewRouter()
+			r.Use(requestIDMiddleware, loggingMiddleware)
+			r.Get("/orders/{id}", tc.handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/orders/3", nil)
+			req.Header.Set("X-Request-Id", "req-1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, tc.wantCode, w.Code)
+			if tc.wantCode >= http.StatusInternalServerError {
+				require.Contains(t, w.Body.String(), "(request id: req-1)")
+				require.NotContains(t, w.Body.String(), tc.wantError)
+			}
+
+			var rec map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+			require.Equal(t, "http request", rec["msg"])
+			require.Equal(t, tc.wantLevel, rec["level"])
+			require.Equal(t, "/orders/{id}", rec["route"])
+			require.Equal(t, "req-1", rec["request_id"])
+			require.Equal(t, float64(tc.wantCode), rec["status"])
+			if tc.wantUserID != 0 {
+				require.Equal(t, tc.wantUserID, rec["user_id"])
+			} else {
+				require.NotContains(t, rec, "user_id")
+			}
+			if tc.wantError != "" {
+				require.Equal(t, tc.wantError, rec["error"])
+			} else {
+				require.NotContains(t, rec, "error")
+			}
+		})
+	}
+}
+
+func TestLoggingMiddlewareQuietRoutes(t *testing.T) {
+	buf := captureLogs(t)
+
+	r := chi.NewRouter()
+	r.Use(loggingMiddleware)
+	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, "DEBUG", rec["level"])
+}
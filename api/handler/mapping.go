@@ -1,6 +1,11 @@
 package handler
 
-import "github.com/abedsully/golang-microservice/grpc/pb"
+import (
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
 
 
 func toPBProductReq(p ProductReq) *pb.ProductReq {
@@ -61,6 +66,7 @@ func toOrderRes(o *pb.OrderRes) OrderRes {
 		TaxPrice:      o.TaxPrice,
 		ShippingPrice: o.ShippingPrice,
 		TotalPrice:    o.TotalPrice,
+		Status:        o.Status,
 		Items:         toOrderItems(o.Items),
 	}
 }
@@ -84,14 +90,113 @@ func toPBUserReq(u UserReq) *pb.UserReq {
 		Name:     u.Name,
 		Email:    u.Email,
 		Password: u.Password,
-		IsAdmin:  u.IsAdmin,
 	}
 }
 
 func toUserRes(u *pb.UserRes) UserRes {
 	return UserRes{
-		Name:    u.Name,
-		Email:   u.Email,
-		IsAdmin: u.IsAdmin,
+		ID:                  u.Id,
+		Name:                u.Name,
+		Email:               u.Email,
+		Roles:               u.Roles,
+		Permissions:         u.Permissions,
+		FailedLoginAttempts: u.FailedLoginAttempts,
+		LockedUntil:         toTimePtr(u.LockedUntil),
+		EmailVerifiedAt:     toTimePtr(u.EmailVerifiedAt),
+		TOTPEnabled:         u.TotpEnabled,
+	}
+}
+
+func toRoleRes(r *pb.RoleRes) RoleRes {
+	return RoleRes{
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.Permissions,
+	}
+}
+
+func toSessionRes(s *pb.SessionInfo) SessionRes {
+	return SessionRes{
+		ID:         s.Id,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IpAddress,
+		CreatedAt:  s.CreatedAt.AsTime(),
+		LastUsedAt: toTimePtr(s.LastUsedAt),
+		ExpiresAt:  s.ExpiresAt.AsTime(),
+		Current:    s.Current,
+	}
+}
+
+func toPBWebhookReq(w WebhookReq) *pb.WebhookReq {
+	return &pb.WebhookReq{
+		Url:        w.URL,
+		EventTypes: w.EventTypes,
+		IsActive:   w.IsActive,
+	}
+}
+
+func toPBAPIKeyReq(k APIKeyReq) *pb.APIKeyReq {
+	req := &pb.APIKeyReq{
+		Name:   k.Name,
+		UserId: k.UserID,
+		Scopes: k.Scopes,
+	}
+	if k.ExpiresAt != nil {
+		req.ExpiresAt = timestamppb.New(*k.ExpiresAt)
 	}
-}
\ No newline at end of file
+
+	return req
+}
+
+func toAPIKeyRes(k *pb.APIKeyRes) APIKeyRes {
+	return APIKeyRes{
+		ID:         k.Id,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		UserID:     k.UserId,
+		Scopes:     k.Scopes,
+		Key:        k.Key,
+		CreatedAt:  k.CreatedAt.AsTime(),
+		ExpiresAt:  toTimePtr(k.ExpiresAt),
+		LastUsedAt: toTimePtr(k.LastUsedAt),
+		RevokedAt:  toTimePtr(k.RevokedAt),
+	}
+}
+
+func toWebhookRes(w *pb.WebhookRes) WebhookRes {
+	return WebhookRes{
+		ID:                  w.Id,
+		URL:                 w.Url,
+		EventTypes:          w.EventTypes,
+		Secret:              w.Secret,
+		IsActive:            w.IsActive,
+		ConsecutiveFailures: w.ConsecutiveFailures,
+		DisabledAt:          toTimePtr(w.DisabledAt),
+		CreatedAt:           w.CreatedAt.AsTime(),
+		UpdatedAt:           toTimePtr(w.UpdatedAt),
+	}
+}
+
+func toWebhookDeliveryRes(d *pb.WebhookDeliveryRes) WebhookDeliveryRes {
+	return WebhookDeliveryRes{
+		ID:            d.Id,
+		WebhookID:     d.WebhookId,
+		EventID:       d.EventId,
+		EventType:     d.EventType,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		ResponseCode:  d.ResponseCode,
+		LastError:     d.LastError,
+		NextAttemptAt: d.NextAttemptAt.AsTime(),
+		CreatedAt:     d.CreatedAt.AsTime(),
+		DeliveredAt:   toTimePtr(d.DeliveredAt),
+	}
+}
+
+func toTimePtr(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
@@ -2,70 +2,110 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/abedsully/golang-microservice/denylist"
 	"github.com/abedsully/golang-microservice/token"
 )
 
 type authKey struct{}
 
-func GetAuthMiddlewareFunc(tokenMaker *token.JWTMaker) func(http.Handler) http.Handler {
+func GetAuthMiddlewareFunc(tokenMaker token.Maker, denied denylist.Denylist, apiKeys APIKeyAuthenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			claims, err := verifyClaimsFromAuthHeader(r, tokenMaker)
-
-			if err != nil {
-				http.Error(w, fmt.Sprintf("error verifying token: %v", err), http.StatusUnauthorized)
+			claims, ok := authenticate(w, r, tokenMaker, denied, apiKeys)
+			if !ok {
 				return
 			}
 
+			logUser(r.Context(), claims.ID)
 			ctx := context.WithValue(r.Context(), authKey{}, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func GetAdminMiddlewareFunc(tokenMaker *token.JWTMaker) func(http.Handler) http.Handler {
+// GetPermissionMiddlewareFunc only lets through requests with a token or API
+// key granting permission, one of the names in the rbac package.
+func GetPermissionMiddlewareFunc(tokenMaker token.Maker, denied denylist.Denylist, apiKeys APIKeyAuthenticator, permission string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			claims, err := verifyClaimsFromAuthHeader(r, tokenMaker)
-
-			if err != nil {
-				http.Error(w, fmt.Sprintf("error verifying token: %v", err), http.StatusUnauthorized)
+			claims, ok := authenticate(w, r, tokenMaker, denied, apiKeys)
+			if !ok {
 				return
 			}
 
-			if !claims.IsAdmin {
-				http.Error(w, "user is not an admin", http.StatusForbidden)
+			if !claims.HasPermission(permission) {
+				http.Error(w, fmt.Sprintf("missing permission %s", permission), http.StatusForbidden)
 				return
 			}
 
+			logUser(r.Context(), claims.ID)
 			ctx := context.WithValue(r.Context(), authKey{}, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func verifyClaimsFromAuthHeader(r *http.Request, tokenMaker *token.JWTMaker) (*token.UserClaims, error) {
-	authHeader := r.Header.Get("Authorization")
-
-	if authHeader == "" {
-		return nil, fmt.Errorf("authorization header is missing")
+// authenticate verifies the bearer token of r and checks that it was not
+// revoked, or resolves the API key of r. If it fails, the error has been
+// written to w.
+func authenticate(w http.ResponseWriter, r *http.Request, tokenMaker token.Maker, denied denylist.Denylist, apiKeys APIKeyAuthenticator) (*token.UserClaims, bool) {
+	scheme, credential, err := parseAuthHeader(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error verifying token: %v", err), http.StatusUnauthorized)
+		return nil, false
 	}
 
-	fields := strings.Fields(authHeader)
-	if len(fields) != 2 || fields[0] != "Bearer" {
-		return nil, fmt.Errorf("invalid authorization heaeder")
+	if scheme == "ApiKey" {
+		claims, err := apiKeys.AuthenticateAPIKey(r.Context(), credential)
+		if errors.Is(err, errInvalidAPIKey) {
+			http.Error(w, "invalid api key", http.StatusUnauthorized)
+			return nil, false
+		}
+		if err != nil {
+			internalError(w, r, "error checking api key", err)
+			return nil, false
+		}
+
+		return claims, true
 	}
 
-	token := fields[1]
-	claims, err := tokenMaker.VerifyToken(token)
+	claims, err := tokenMaker.VerifyToken(credential)
+	if err != nil || claims.Purpose != "" {
+		http.Error(w, "error verifying token: error verifying token", http.StatusUnauthorized)
+		return nil, false
+	}
 
+	isDenied, err := denied.IsDenied(r.Context(), claims.RegisteredClaims.ID)
 	if err != nil {
-		return nil, fmt.Errorf("error verifying token")
+		internalError(w, r, "error checking token", err)
+		return nil, false
+	}
+	if isDenied {
+		http.Error(w, "token has been revoked", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return claims, true
+}
+
+// parseAuthHeader splits the Authorization header of r into its scheme,
+// either Bearer or ApiKey, and the credential.
+func parseAuthHeader(r *http.Request) (scheme, credential string, err error) {
+	authHeader := r.Header.Get("Authorization")
+
+	if authHeader == "" {
+		return "", "", fmt.Errorf("authorization header is missing")
+	}
+
+	fields := strings.Fields(authHeader)
+	if len(fields) != 2 || (fields[0] != "Bearer" && fields[0] != "ApiKey") {
+		return "", "", fmt.Errorf("invalid authorization heaeder")
 	}
 
-	return claims, err
+	return fields[0], fields[1], nil
 }
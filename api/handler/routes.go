@@ -3,23 +3,38 @@ package handler
 import (
 	"net/http"
 
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/tracing"
 	"github.com/go-chi/chi"
 )
 
-var r *chi.Mux
-
-func RegisterRoutes(handler *handler) *chi.Mux {
-	r = chi.NewRouter()
+func RegisterRoutes(handler *handler, timeouts Timeouts) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(tracing.HTTPMiddleware)
+	r.Use(metrics.HTTPMiddleware)
+	r.Use(requestIDMiddleware)
+	r.Use(loggingMiddleware)
+	r.Use(deadlineMiddleware(r, timeouts))
 	tokenMaker := handler.TokenMaker
+	denied := handler.denylist
+	apiKeys := handler.apiKeys
+	can := func(permission string) func(http.Handler) http.Handler {
+		return GetPermissionMiddlewareFunc(tokenMaker, denied, apiKeys, permission)
+	}
+
+	r.Get("/healthz", handler.healthz)
+	r.Get("/readyz", handler.readyz)
+	r.Get("/.well-known/jwks.json", handler.jwks)
 
 	r.Route("/products", func(r chi.Router) {
-		r.With(GetAdminMiddlewareFunc(tokenMaker)).Post("/", handler.createProduct)
+		r.With(can(rbac.ProductsWrite)).Post("/", handler.createProduct)
 		r.Get("/", handler.getAllProducts)
 
 		r.Route("/{id}", func(r chi.Router) {
 			r.Get("/", handler.getProduct)
 			r.Group(func(r chi.Router) {
-				r.Use(GetAdminMiddlewareFunc(tokenMaker))
+				r.Use(can(rbac.ProductsWrite))
 				r.Patch("/", handler.updateProduct)
 				r.Delete("/", handler.deleteProduct)
 			})
@@ -27,15 +42,16 @@ func RegisterRoutes(handler *handler) *chi.Mux {
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(GetAuthMiddlewareFunc(tokenMaker))
+		r.Use(GetAuthMiddlewareFunc(tokenMaker, denied, apiKeys))
 		r.Get("/myorder", handler.getOrder)
 
 		r.Route("/orders", func(r chi.Router) {
 			r.Post("/", handler.createOrder)
-			r.With(GetAdminMiddlewareFunc(tokenMaker)).Get("/", handler.listOrders)
+			r.With(can(rbac.OrdersReadAll)).Get("/", handler.listOrders)
 
 			r.Route("/{id}", func(r chi.Router) {
 				r.Delete("/", handler.deleteOrder)
+				r.With(can(rbac.OrdersUpdateStatus)).Patch("/status", handler.updateOrderStatus)
 			})
 		})
 	})
@@ -43,34 +59,73 @@ func RegisterRoutes(handler *handler) *chi.Mux {
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", handler.createUser)
 		r.Post("/login", handler.loginUser)
-
-		r.Group(func(r chi.Router) {
-			r.Use(GetAdminMiddlewareFunc(tokenMaker))
-			r.Get("/", handler.listUsers)
-			r.Route("/{id}", func(r chi.Router) {
-				r.Delete("/", handler.deleteUser)
-			})
+		r.Post("/login/mfa", handler.loginMFA)
+		r.Get("/login/sso/{provider}", handler.startSSOLogin)
+		r.Get("/login/sso/{provider}/callback", handler.ssoCallback)
+		r.Post("/password/forgot", handler.forgotPassword)
+		r.Post("/password/reset", handler.resetPassword)
+		r.Get("/verify", handler.verifyEmail)
+		r.Post("/verify/resend", handler.resendVerification)
+
+		r.With(can(rbac.UsersRead)).Get("/", handler.listUsers)
+		r.Route("/{id}", func(r chi.Router) {
+			r.With(can(rbac.UsersDelete)).Delete("/", handler.deleteUser)
+			r.With(can(rbac.UsersUnlock)).Post("/unlock", handler.unlockUser)
+			r.With(can(rbac.UsersRevokeSessions)).Delete("/sessions", handler.deleteUserSessions)
+			r.With(can(rbac.RolesManage)).Put("/roles", handler.setUserRoles)
 		})
 		r.Group(func(r chi.Router) {
-			r.Use(GetAuthMiddlewareFunc(tokenMaker))
+			r.Use(GetAuthMiddlewareFunc(tokenMaker, denied, apiKeys))
 
 			r.Patch("/", handler.updateUser)
 			r.Post("/logout", handler.logoutUser)
+			r.Post("/me/password", handler.changePassword)
+
+			r.Route("/me/totp", func(r chi.Router) {
+				r.Post("/", handler.enrollTOTP)
+				r.Post("/confirm", handler.confirmTOTP)
+				r.Delete("/", handler.disableTOTP)
+			})
+
+			r.Route("/me/sessions", func(r chi.Router) {
+				r.Get("/", handler.listMySessions)
+				r.Delete("/", handler.deleteMyOtherSessions)
+				r.Delete("/{id}", handler.deleteMySession)
+			})
 		})
 
 	})
 
+	r.With(can(rbac.RolesManage)).Get("/roles", handler.listRoles)
+
+	r.Route("/api-keys", func(r chi.Router) {
+		r.Use(can(rbac.APIKeysManage))
+		r.Post("/", handler.createAPIKey)
+		r.Get("/", handler.listAPIKeys)
+		r.Delete("/{id}", handler.revokeAPIKey)
+	})
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Use(can(rbac.WebhooksManage))
+		r.Post("/", handler.createWebhook)
+		r.Get("/", handler.listWebhooks)
+
+		r.Route("/{id}", func(r chi.Router) {
+			r.Get("/", handler.getWebhook)
+			r.Patch("/", handler.updateWebhook)
+			r.Delete("/", handler.deleteWebhook)
+			r.Get("/deliveries", handler.listWebhookDeliveries)
+			r.Post("/deliveries/{deliveryID}/redeliver", handler.redeliverWebhook)
+		})
+	})
+
 	r.Route("/tokens", func(r chi.Router) {
 
 		r.Group(func(r chi.Router) {
-			r.Use(GetAuthMiddlewareFunc(tokenMaker))
+			r.Use(GetAuthMiddlewareFunc(tokenMaker, denied, apiKeys))
 			r.Post("/renew", handler.renewAccessToken)
-			r.Post("/revoke", handler.revokeSession)
+			r.Post("/revoke", handler.logoutUser)
 		})
 	})
 	return r
 }
-
-func Start(addr string) error {
-	return http.ListenAndServe(addr, r)
-}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/sso"
+	"github.com/go-chi/chi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ssoCookie keeps the state, nonce and PKCE verifier of a login while the
+// user is at the provider, so that any gateway can complete it.
+const (
+	ssoCookie       = "sso_login"
+	ssoCookieMaxAge = 10 * 60
+)
+
+// startSSOLogin sends the user to the provider to log in.
+func (h *handler) startSSOLogin(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.ssoProvider(w, r)
+	if !ok {
+		return
+	}
+
+	l, err := sso.NewLogin()
+	if err != nil {
+		internalError(w, r, "error starting login", err)
+		return
+	}
+
+	http.SetCookie(w, ssoLoginCookie(r, p, l.String(), ssoCookieMaxAge))
+	http.Redirect(w, r, p.AuthCodeURL(l), http.StatusFound)
+}
+
+// ssoCallback completes a login started by startSSOLogin once the provider
+// redirects back. The user is logged in like with a password, including the
+// second factor if enabled.
+func (h *handler) ssoCallback(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.ssoProvider(w, r)
+	if !ok {
+		return
+	}
+
+	// a login can only be completed once
+	c, err := r.Cookie(ssoCookie)
+	http.SetCookie(w, ssoLoginCookie(r, p, "", -1))
+	if err != nil {
+		http.Error(w, "login expired, start again", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	l, err := sso.ParseLogin(c.Value)
+	if err != nil || !l.CheckState(q.Get("state")) {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		metrics.LoginFailed(metrics.LoginFailureSSO)
+		http.Error(w, fmt.Sprintf("login failed at provider: %s", e), http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := p.Exchange(r.Context(), l, q.Get("code"))
+	if err != nil {
+		metrics.LoginFailed(metrics.LoginFailureSSO)
+		requestLogFromContext(r.Context()).err = err
+		http.Error(w, "invalid login", http.StatusUnauthorized)
+		return
+	}
+	if !identity.EmailVerified {
+		metrics.LoginFailed(metrics.LoginFailureSSO)
+		http.Error(w, "email address is not verified by the provider", http.StatusForbidden)
+		return
+	}
+
+	res, err := h.auth.LoginWithIdentity(h.outgoingContext(r), &pb.IdentityReq{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		Name:     identity.Name,
+	})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			http.Error(w, status.Convert(err).Message(), http.StatusBadRequest)
+		case codes.FailedPrecondition:
+			http.Error(w, status.Convert(err).Message(), http.StatusConflict)
+		case codes.ResourceExhausted:
+			setRetryAfter(w, retryDelay(err))
+			http.Error(w, "account locked", http.StatusLocked)
+		default:
+			internalError(w, r, "error logging in", err)
+		}
+		return
+	}
+
+	if res.GetMfaRequired() {
+		h.challengeMFA(w, r, res.GetUser())
+		return
+	}
+
+	h.completeLogin(w, r, res, emailThrottleKey(res.GetUser().GetEmail()))
+}
+
+func (h *handler) ssoProvider(w http.ResponseWriter, r *http.Request) (*sso.Provider, bool) {
+	p, ok := h.SSOProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+	}
+	return p, ok
+}
+
+// ssoLoginCookie is only sent back to the provider's callback. SameSite=Lax
+// lets it through the redirect from the provider.
+func ssoLoginCookie(r *http.Request, p *sso.Provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     ssoCookie,
+		Value:    value,
+		Path:     "/users/login/sso/" + p.Name(),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
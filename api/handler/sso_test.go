@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/denylist"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/sso"
+	"github.com/abedsully/golang-microservice/sso/ssotest"
+	"github.com/abedsully/golang-microservice/throttle"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// identityClient fakes LoginWithIdentity, refusing to link to the
+// unverified email address.
+type identityClient struct {
+	pb.AuthServiceClient
+	identities []*pb.IdentityReq
+	unverified string
+}
+
+func (c *identityClient) LoginWithIdentity(ctx context.Context, in *pb.IdentityReq, opts ...grpc.CallOption) (*pb.LoginRes, error) {
+	c.identities = append(c.identities, in)
+	if in.GetEmail() == c.unverified {
+		return nil, status.Error(codes.FailedPrecondition, "an account with this email address exists, verify its email address to link it")
+	}
+	return &pb.LoginRes{
+		User:                  &pb.UserRes{Id: 1, Name: in.GetName(), Email: in.GetEmail()},
+		SessionId:             "f1",
+		RefreshToken:          "refresh-token",
+		RefreshTokenExpiresAt: timestamppb.New(time.Now().Add(24 * time.Hour)),
+	}, nil
+}
+
+func TestSSOLogin(t *testing.T) {
+	idp := ssotest.NewProvider(t)
+	provider, err := sso.NewProvider(context.Background(), sso.Config{
+		Name:         "test",
+		Issuer:       idp.URL,
+		ClientID:     ssotest.ClientID,
+		ClientSecret: ssotest.ClientSecret,
+		RedirectURL:  "http://gateway/users/login/sso/test/callback",
+	})
+	require.NoError(t, err)
+
+	client := &identityClient{unverified: "jane@example.com"}
+	cfg := throttle.Config{FreeAttempts: 100, Window: time.Hour}
+	store := throttle.NewMemoryStore()
+	h := NewHandler(nil, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{
+		ByIP:    throttle.NewLimiter(store, cfg),
+		ByEmail: throttle.NewLimiter(store, cfg),
+	}, nil, denylist.NewMemory())
+	h.SSOProviders = map[string]*sso.Provider{"test": provider}
+	router := RegisterRoutes(h, Timeouts{})
+
+	// login goes through the provider and returns the callback request
+	login := func(t *testing.T) (*http.Request, *http.Cookie) {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/login/sso/test", nil))
+		require.Equal(t, http.StatusFound, w.Code)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		require.True(t, cookies[0].HttpOnly)
+		require.Equal(t, "/users/login/sso/test", cookies[0].Path)
+
+		callback, err := idp.Authorize(w.Header().Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, "/users/login/sso/test/callback", callback.Path)
+
+		return httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil), cookies[0]
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("success", func(t *testing.T) {
+		req, cookie := login(t)
+		req.AddCookie(cookie)
+		w := serve(req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var res LoginUserRes
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		require.NotEmpty(t, res.AccessToken)
+		require.Equal(t, "john@example.com", res.User.Email)
+		require.Equal(t, &pb.IdentityReq{Provider: "test", Subject: "1234567890", Email: "john@example.com", Name: "John"}, client.identities[len(client.identities)-1])
+
+		// the cookie is cleared, and a replayed callback fails anyway as the
+		// code is used up
+		require.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+		replay := httptest.NewRequest(http.MethodGet, req.URL.RequestURI(), nil)
+		replay.AddCookie(cookie)
+		require.Equal(t, http.StatusUnauthorized, serve(replay).Code)
+	})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		req, _ := login(t)
+		require.Equal(t, http.StatusBadRequest, serve(req).Code)
+	})
+
+	t.Run("wrong state", func(t *testing.T) {
+		req, cookie := login(t)
+		q := req.URL.Query()
+		q.Set("state", "forged")
+		req.URL.RawQuery = q.Encode()
+		req.AddCookie(cookie)
+		require.Equal(t, http.StatusBadRequest, serve(req).Code)
+	})
+
+	t.Run("unverified at provider", func(t *testing.T) {
+		idp.SetClaims(jwt.MapClaims{"sub": "42", "email": "john@example.com", "email_verified": false})
+		t.Cleanup(func() {
+			idp.SetClaims(jwt.MapClaims{"sub": "1234567890", "email": "john@example.com", "email_verified": true, "name": "John"})
+		})
+
+		req, cookie := login(t)
+		req.AddCookie(cookie)
+		require.Equal(t, http.StatusForbidden, serve(req).Code)
+	})
+
+	t.Run("unverified account", func(t *testing.T) {
+		idp.SetClaims(jwt.MapClaims{"sub": "43", "email": "jane@example.com", "email_verified": true})
+		t.Cleanup(func() {
+			idp.SetClaims(jwt.MapClaims{"sub": "1234567890", "email": "john@example.com", "email_verified": true, "name": "John"})
+		})
+
+		req, cookie := login(t)
+		req.AddCookie(cookie)
+		require.Equal(t, http.StatusConflict, serve(req).Code)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, serve(httptest.NewRequest(http.MethodGet, "/users/login/sso/other", nil)).Code)
+	})
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abedsully/golang-microservice/throttle"
+)
+
+// LoginThrottle slows down repeated failed logins, both from the same client
+// IP and against the same email address.
+type LoginThrottle struct {
+	ByIP    *throttle.Limiter
+	ByEmail *throttle.Limiter
+}
+
+func loginThrottleKeys(r *http.Request, email string) (ipKey, emailKey string) {
+	return "ip:" + clientIP(r), emailThrottleKey(email)
+}
+
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// wait returns how long the client has to wait before it may try to log in
+// again, which is the longer of the IP and the email delay.
+func (t LoginThrottle) wait(ctx context.Context, ipKey, emailKey string) (time.Duration, error) {
+	byIP, err := t.ByIP.Wait(ctx, ipKey)
+	if err != nil {
+		return 0, err
+	}
+
+	byEmail, err := t.ByEmail.Wait(ctx, emailKey)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(byIP, byEmail), nil
+}
+
+// reserve counts a login as failed before it is made, so that concurrent
+// logins cannot all pass the throttle. It returns how long the client has to
+// wait instead if it is throttled, in which case nothing is counted. Logins
+// that turn out not to fail on wrong credentials are taken back with release.
+func (t LoginThrottle) reserve(ctx context.Context, ipKey, emailKey string) (time.Duration, error) {
+	byIP, err := t.ByIP.Reserve(ctx, ipKey)
+	if err != nil || byIP > 0 {
+		return byIP, err
+	}
+
+	byEmail, err := t.ByEmail.Reserve(ctx, emailKey)
+	if err != nil || byEmail > 0 {
+		if err := t.ByIP.Release(ctx, ipKey); err != nil {
+			return 0, err
+		}
+		return byEmail, err
+	}
+
+	return 0, nil
+}
+
+// release takes back a login counted by reserve.
+func (t LoginThrottle) release(ctx context.Context, ipKey, emailKey string) error {
+	if err := t.ByIP.Release(ctx, ipKey); err != nil {
+		return err
+	}
+
+	return t.ByEmail.Release(ctx, emailKey)
+}
+
+// reserveMail counts a request for a mail against every key with the resend
+// limiter. It returns how long the client has to wait instead if any key is
+// throttled, in which case nothing is counted.
+func (h *handler) reserveMail(ctx context.Context, keys ...string) (time.Duration, error) {
+	for i, key := range keys {
+		wait, err := h.resendLimiter.Reserve(ctx, key)
+		if err == nil && wait == 0 {
+			continue
+		}
+
+		for _, reserved := range keys[:i] {
+			if err := h.resendLimiter.Release(ctx, reserved); err != nil {
+				return 0, err
+			}
+		}
+		return wait, err
+	}
+
+	return 0, nil
+}
+
+// setRetryAfter tells the client how many seconds to wait, rounded up.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	secs := int64((d + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+}
@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/password"
+	"github.com/abedsully/golang-microservice/throttle"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// loginClient fakes the login RPCs for a single user with the password
+// hashed, locking the account for an hour after lockAfter failures.
+type loginClient struct {
+	pb.AuthServiceClient
+	user      *pb.UserRes
+	hashed    string
+	lockAfter int64
+	successes int
+}
+
+func (c *loginClient) Login(ctx context.Context, in *pb.LoginReq, opts ...grpc.CallOption) (*pb.LoginRes, error) {
+	if in.GetEmail() != c.user.GetEmail() {
+		return nil, status.Error(codes.Unauthenticated, "invalid email or password")
+	}
+	if c.user.GetLockedUntil() != nil && c.user.GetLockedUntil().AsTime().After(time.Now()) {
+		return nil, lockedError(codes.ResourceExhausted, "account locked")
+	}
+	if err := password.Verify(in.GetPassword(), c.hashed); err != nil {
+		return nil, c.fail("invalid email or password")
+	}
+	if c.user.GetTotpEnabled() {
+		return &pb.LoginRes{User: c.user, MfaRequired: true}, nil
+	}
+	return c.startSession(), nil
+}
+
+func (c *loginClient) fail(msg string) error {
+	c.user.FailedLoginAttempts++
+	if c.user.FailedLoginAttempts%c.lockAfter == 0 {
+		c.user.LockedUntil = timestamppb.New(time.Now().Add(time.Hour))
+		return lockedError(codes.Unauthenticated, msg)
+	}
+	return status.Error(codes.Unauthenticated, msg)
+}
+
+func (c *loginClient) startSession() *pb.LoginRes {
+	c.successes++
+	c.user.FailedLoginAttempts = 0
+	return &pb.LoginRes{User: c.user, SessionId: "f1", RefreshToken: "refresh-token", RefreshTokenExpiresAt: timestamppb.New(time.Now().Add(24 * time.Hour))}
+}
+
+func lockedError(code codes.Code, msg string) error {
+	st, _ := status.New(code, msg).WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Hour)})
+	return st.Err()
+}
+
+func TestLoginThrottling(t *testing.T) {
+	hashed, err := password.DefaultBcrypt().Hash("secret")
+	require.NoError(t, err)
+
+	client := &loginClient{
+		user:      &pb.UserRes{Id: 1, Email: "john@example.com"},
+		hashed:    hashed,
+		lockAfter: 4,
+	}
+	cfg := throttle.Config{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	store := throttle.NewMemoryStore()
+	h := NewHandler(nil, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{
+		ByIP:    throttle.NewLimiter(store, throttle.Config{FreeAttempts: 100, Window: time.Hour}),
+		ByEmail: throttle.NewLimiter(store, cfg),
+	}, throttle.NewLimiter(store, cfg), nil)
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+		w := httptest.NewRecorder()
+		h.loginUser(w, req)
+		return w
+	}
+
+	// the first failure is free
+	w := login("john@example.com", "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Empty(t, w.Header().Get("Retry-After"))
+
+	w = login("john@example.com", "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// even the right password is rejected while throttled
+	w = login("JOHN@example.com ", "secret")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+	require.Equal(t, int64(2), client.user.FailedLoginAttempts)
+
+	// unknown emails are throttled the same way
+	w = login("jane@example.com", "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Empty(t, w.Header().Get("Retry-After"))
+
+	// once the delay is over the right password logs in and clears the count
+	require.NoError(t, h.loginThrottle.ByEmail.Reset(context.Background(), emailThrottleKey("john@example.com")))
+	w = login("john@example.com", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, 1, client.successes)
+	require.Zero(t, client.user.FailedLoginAttempts)
+
+	// the account is locked after lockAfter failures, regardless of delays
+	for i := 0; i < 3; i++ {
+		require.NoError(t, h.loginThrottle.ByEmail.Reset(context.Background(), emailThrottleKey("john@example.com")))
+		w = login("john@example.com", "wrong")
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	require.NoError(t, h.loginThrottle.ByEmail.Reset(context.Background(), emailThrottleKey("john@example.com")))
+	w = login("john@example.com", "wrong")
+	require.Equal(t, http.StatusLocked, w.Code)
+	require.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+	require.NoError(t, h.loginThrottle.ByEmail.Reset(context.Background(), emailThrottleKey("john@example.com")))
+	w = login("john@example.com", "secret")
+	require.Equal(t, http.StatusLocked, w.Code)
+}
+
+// slowLoginClient rejects every login once release is closed.
+type slowLoginClient struct {
+	pb.AuthServiceClient
+	calls   atomic.Int64
+	release chan struct{}
+}
+
+func (c *slowLoginClient) Login(ctx context.Context, in *pb.LoginReq, opts ...grpc.CallOption) (*pb.LoginRes, error) {
+	c.calls.Add(1)
+	<-c.release
+	return nil, status.Error(codes.Unauthenticated, "invalid email or password")
+}
+
+func TestLoginThrottlingConcurrent(t *testing.T) {
+	client := &slowLoginClient{release: make(chan struct{})}
+	cfg := throttle.Config{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	store := throttle.NewMemoryStore()
+	h := NewHandler(nil, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{
+		ByIP:    throttle.NewLimiter(store, throttle.Config{FreeAttempts: 100, Window: time.Hour}),
+		ByEmail: throttle.NewLimiter(store, cfg),
+	}, throttle.NewLimiter(store, cfg), nil)
+
+	results := make(chan int, 5)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(`{"email":"john@example.com","password":"wrong"}`))
+			w := httptest.NewRecorder()
+			h.loginUser(w, req)
+			results <- w.Code
+		}()
+	}
+
+	// logins still waiting for the gRPC service count towards the throttle
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusTooManyRequests, <-results)
+	}
+	require.Equal(t, int64(2), client.calls.Load())
+
+	close(client.release)
+	require.Equal(t, http.StatusUnauthorized, <-results)
+	require.Equal(t, http.StatusUnauthorized, <-results)
+}
+
+func TestLoginThrottlingSuccess(t *testing.T) {
+	hashed, err := password.DefaultBcrypt().Hash("secret")
+	require.NoError(t, err)
+
+	client := &loginClient{user: &pb.UserRes{Id: 1, Email: "john@example.com"}, hashed: hashed, lockAfter: 10}
+	store := throttle.NewMemoryStore()
+	cfg := throttle.Config{BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	h := NewHandler(nil, client, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{
+		ByIP:    throttle.NewLimiter(store, cfg),
+		ByEmail: throttle.NewLimiter(store, cfg),
+	}, throttle.NewLimiter(store, cfg), nil)
+
+	// successful logins do not count, even though every failure is delayed
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(`{"email":"john@example.com","password":"secret"}`))
+		w := httptest.NewRecorder()
+		h.loginUser(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+type resendClient struct {
+	pb.GolangMicroserviceClient
+	sent atomic.Int64
+}
+
+func (c *resendClient) ResendVerificationEmail(ctx context.Context, in *pb.EmailVerificationReq, opts ...grpc.CallOption) (*pb.UserRes, error) {
+	c.sent.Add(1)
+	return &pb.UserRes{}, nil
+}
+
+func TestResendVerificationThrottling(t *testing.T) {
+	client := &resendClient{}
+	store := throttle.NewMemoryStore()
+	h := NewHandler(client, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, throttle.NewLimiter(store, throttle.Config{
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}), nil)
+
+	resend := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users/verify/resend", strings.NewReader(`{"email":"`+email+`"}`))
+		w := httptest.NewRecorder()
+		h.resendVerification(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusAccepted, resend("john@example.com").Code)
+
+	w := resend("John@Example.com")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	require.Equal(t, http.StatusAccepted, resend("jane@example.com").Code)
+	require.Equal(t, int64(2), client.sent.Load())
+
+	// concurrent requests send a single mail
+	results := make(chan int, 5)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			results <- resend("joe@example.com").Code
+		}()
+	}
+
+	accepted := 0
+	for i := 0; i < cap(results); i++ {
+		if <-results == http.StatusAccepted {
+			accepted++
+		}
+	}
+	require.Equal(t, 1, accepted)
+	require.Equal(t, int64(3), client.sent.Load())
+}
+
+type resetClient struct {
+	pb.GolangMicroserviceClient
+	requested int
+}
+
+func (c *resetClient) RequestPasswordReset(ctx context.Context, in *pb.PasswordResetReq, opts ...grpc.CallOption) (*pb.PasswordResetRes, error) {
+	c.requested++
+	return &pb.PasswordResetRes{}, nil
+}
+
+func TestForgotPasswordThrottling(t *testing.T) {
+	client := &resetClient{}
+	store := throttle.NewMemoryStore()
+	h := NewHandler(client, nil, nil, token.NewJWTMaker("01234567890123456789012345678901"), LoginThrottle{}, throttle.NewLimiter(store, throttle.Config{
+		BaseDelay: time.Minute,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	}), nil)
+
+	forgot := func(email, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		h.forgotPassword(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusAccepted, forgot("john@example.com", "192.0.2.1").Code)
+
+	// throttled by email
+	w := forgot("John@Example.com", "192.0.2.2")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// throttled by client IP
+	require.Equal(t, http.StatusTooManyRequests, forgot("jane@example.com", "192.0.2.1").Code)
+
+	// the email counted nothing while the IP was throttled
+	require.Equal(t, http.StatusAccepted, forgot("jane@example.com", "192.0.2.3").Code)
+	require.Equal(t, 2, client.requested)
+}
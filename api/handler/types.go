@@ -51,21 +51,53 @@ type OrderRes struct {
 	TaxPrice      float32      `json:"tax_price"`
 	ShippingPrice float32      `json:"shipping_price"`
 	TotalPrice    float32      `json:"total_price"`
+	Status        string       `json:"status"`
 	CreatedAt     time.Time    `json:"created_at"`
 	UpdatedAt     *time.Time   `json:"updated_at"`
 }
 
+type UpdateOrderStatusReq struct {
+	Status string `json:"status"`
+}
+
+func isValidOrderStatus(status string) bool {
+	switch status {
+	case "pending", "shipped", "delivered":
+		return true
+	}
+	return false
+}
+
 type UserReq struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
-	IsAdmin  bool   `json:"is_admin"`
 }
 
 type UserRes struct {
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	IsAdmin bool   `json:"is_admin"`
+	ID                  int64      `json:"id"`
+	Name                string     `json:"name"`
+	Email               string     `json:"email"`
+	Roles               []string   `json:"roles,omitempty"`
+	Permissions         []string   `json:"permissions,omitempty"`
+	FailedLoginAttempts int64      `json:"failed_login_attempts,omitempty"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	EmailVerifiedAt     *time.Time `json:"email_verified_at"`
+	TOTPEnabled         bool       `json:"totp_enabled"`
+}
+
+type UserRolesReq struct {
+	Roles []string `json:"roles"`
+}
+
+type RoleRes struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type ListRolesRes struct {
+	Roles []RoleRes `json:"roles"`
 }
 
 type AllUsers struct {
@@ -84,6 +116,56 @@ type LoginUserRes struct {
 	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
 	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
 	User                  UserRes   `json:"user"`
+	// MFAEnrollmentRequired is set when the user's roles require two-factor
+	// authentication, which is not enabled yet. The tokens grant no
+	// permissions until it is.
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+// MFAChallengeRes answers the login of a user with two-factor
+// authentication. The MFA token is exchanged for the real tokens along with a
+// code at POST /users/login/mfa.
+type MFAChallengeRes struct {
+	MFARequired       bool      `json:"mfa_required"`
+	MFAToken          string    `json:"mfa_token"`
+	MFATokenExpiresAt time.Time `json:"mfa_token_expires_at"`
+}
+
+type LoginMFAReq struct {
+	MFAToken string `json:"mfa_token"`
+	// Code is a code of the user's authenticator app or a recovery code.
+	Code string `json:"code"`
+}
+
+type TOTPReq struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollmentRes struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPRecoveryCodesRes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type ResendVerificationReq struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 type RenewAccessTokenReq struct {
@@ -91,6 +173,79 @@ type RenewAccessTokenReq struct {
 }
 
 type RenewAccessTokenRes struct {
-	AccessToken          string    `json:"access_token"`
-	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	SessionID             string    `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+type SessionRes struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+type ListSessionsRes struct {
+	Sessions []SessionRes `json:"sessions"`
+}
+
+type RevokeSessionsRes struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type APIKeyReq struct {
+	Name      string     `json:"name"`
+	UserID    int64      `json:"user_id"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyRes struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	UserID     int64      `json:"user_id"`
+	Scopes     []string   `json:"scopes"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type WebhookReq struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	IsActive   *bool    `json:"is_active"`
+}
+
+type WebhookRes struct {
+	ID                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Secret              string     `json:"secret,omitempty"`
+	IsActive            bool       `json:"is_active"`
+	ConsecutiveFailures int64      `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           *time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryRes struct {
+	ID            int64      `json:"id"`
+	WebhookID     int64      `json:"webhook_id"`
+	EventID       int64      `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int64      `json:"attempts"`
+	ResponseCode  int64      `json:"response_code"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
 }
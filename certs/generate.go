@@ -0,0 +1,157 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File names written by GenerateDev.
+const (
+	CAFile         = "ca.pem"
+	CAKeyFile      = "ca-key.pem"
+	ServerCertFile = "server.pem"
+	ServerKeyFile  = "server-key.pem"
+	ClientCertFile = "client.pem"
+	ClientKeyFile  = "client-key.pem"
+)
+
+// GenerateDev writes a self-signed CA, a server certificate valid for hosts
+// and a client certificate to dir. The result is meant for local development
+// and tests only.
+func GenerateDev(dir string, hosts []string, validFor time.Duration) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating ca key: %w", err)
+	}
+	caTmpl := &x509.Certificate{
+		Subject:               pkix.Name{Organization: []string{"golang-microservice"}, CommonName: "golang-microservice dev CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := createCertificate(caTmpl, caTmpl, caKey, caKey)
+	if err != nil {
+		return err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return fmt.Errorf("error parsing ca certificate: %w", err)
+	}
+
+	serverTmpl := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"golang-microservice"}, CommonName: "grpc"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(validFor),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			serverTmpl.IPAddresses = append(serverTmpl.IPAddresses, ip)
+		} else {
+			serverTmpl.DNSNames = append(serverTmpl.DNSNames, h)
+		}
+	}
+
+	clientTmpl := &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"golang-microservice"}, CommonName: "api-gateway"},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(validFor),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if err := writeKey(filepath.Join(dir, CAKeyFile), caKey); err != nil {
+		return err
+	}
+	if err := writeCert(filepath.Join(dir, CAFile), caDER); err != nil {
+		return err
+	}
+
+	leaves := []struct {
+		tmpl     *x509.Certificate
+		certFile string
+		keyFile  string
+	}{
+		{serverTmpl, ServerCertFile, ServerKeyFile},
+		{clientTmpl, ClientCertFile, ClientKeyFile},
+	}
+	for _, l := range leaves {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return fmt.Errorf("error generating key: %w", err)
+		}
+		der, err := createCertificate(l.tmpl, caCert, key, caKey)
+		if err != nil {
+			return err
+		}
+		if err := writeKey(filepath.Join(dir, l.keyFile), key); err != nil {
+			return err
+		}
+		if err := writeCert(filepath.Join(dir, l.certFile), der); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createCertificate(tmpl, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+	tmpl.SerialNumber = serial
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate %q: %w", tmpl.Subject.CommonName, err)
+	}
+
+	return der, nil
+}
+
+func writeCert(path string, der []byte) error {
+	return writePEM(path, &pem.Block{Type: "CERTIFICATE", Bytes: der}, 0o644)
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("error marshalling key: %w", err)
+	}
+
+	return writePEM(path, &pem.Block{Type: "PRIVATE KEY", Bytes: der}, 0o600)
+}
+
+// writePEM writes to a temporary file and renames it into place, so that a
+// Reloader never observes a half-written file.
+func writePEM(path string, block *pem.Block, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(block), perm); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader keeps a certificate/key pair and an optional CA bundle in memory
+// and reloads them when the files change on disk, so that certificates can be
+// rotated without restarting the process.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	caPool *x509.CertPool
+	raw    []byte
+}
+
+// NewReloader loads the given files. certFile/keyFile and caFile are each
+// optional, but at least one of them should be set to be useful.
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again and reports whether anything changed. On error
+// the previously loaded material is kept.
+func (r *Reloader) Reload() (bool, error) {
+	var raw [][]byte
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f == "" {
+			raw = append(raw, nil)
+			continue
+		}
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return false, fmt.Errorf("error reading %s: %w", f, err)
+		}
+		raw = append(raw, b)
+	}
+
+	joined := bytes.Join(raw, []byte{0})
+
+	r.mu.RLock()
+	unchanged := r.raw != nil && bytes.Equal(joined, r.raw)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		c, err := tls.X509KeyPair(raw[0], raw[1])
+		if err != nil {
+			return false, fmt.Errorf("error parsing key pair: %w", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw[2]) {
+			return false, fmt.Errorf("no certificates found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.caPool = pool
+	r.raw = joined
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch reloads the files every interval until ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if err != nil {
+				slog.ErrorContext(ctx, "error reloading certificates, keeping the current ones", "error", err)
+				continue
+			}
+			if changed {
+				slog.InfoContext(ctx, "reloaded certificates", "file", r.describe())
+			}
+		}
+	}
+}
+
+func (r *Reloader) describe() string {
+	if r.certFile != "" {
+		return r.certFile
+	}
+	return r.caFile
+}
+
+func (r *Reloader) certificate() (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.cert == nil {
+		return nil, fmt.Errorf("no certificate configured")
+	}
+	return r.cert, nil
+}
+
+func (r *Reloader) pool() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.caPool
+}
+
+// ServerConfig returns a TLS config for a server presenting the reloaded
+// certificate. If a CA file was given, clients must present a certificate
+// signed by it (mutual TLS).
+func (r *Reloader) ServerConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		},
+	}
+
+	if r.caFile != "" {
+		// ClientCAs is fixed once the config is in use, so the chain is
+		// verified by hand against the current pool.
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return r.verify(cs, "", x509.ExtKeyUsageClientAuth)
+		}
+	}
+
+	return cfg
+}
+
+// ClientConfig returns a TLS config for a client verifying the server against
+// the reloaded CA bundle (or the system roots if none was given) and, if a
+// certificate was given, presenting it for mutual TLS. The server certificate
+// must be valid for serverName, a host name or IP address.
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if r.certFile != "" {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		}
+	}
+
+	if r.caFile != "" {
+		// RootCAs is fixed once the config is in use, so verification is done
+		// by hand against the current pool. InsecureSkipVerify only turns off
+		// the built-in check; VerifyConnection below replaces it.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			// cs.ServerName is the SNI sent, which is empty for IP
+			// addresses, so the name is checked as it was given
+			if serverName == "" {
+				return fmt.Errorf("no server name to verify the peer certificate for")
+			}
+			return r.verify(cs, serverName, x509.ExtKeyUsageServerAuth)
+		}
+	}
+
+	return cfg
+}
+
+func (r *Reloader) verify(cs tls.ConnectionState, dnsName string, usage x509.ExtKeyUsage) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("peer presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         r.pool(),
+		DNSName:       dnsName,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}
+	for _, c := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("error verifying peer certificate: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package certs
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// handshake connects clientCfg to a listener using serverCfg and returns the
+// serial number of the certificate the server presented.
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) (string, error) {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// reading drives the server side of the handshake
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	// with TLS 1.3 the client learns that its certificate was rejected on
+	// the first read after the handshake
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			return "", err
+		}
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.String(), nil
+}
+
+func TestReloaderMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, GenerateDev(dir, []string{"localhost", "127.0.0.1"}, time.Hour))
+
+	server, err := NewReloader(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile), filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		caFile   string
+		ok       bool
+	}{
+		{name: "client certificate", certFile: ClientCertFile, keyFile: ClientKeyFile, caFile: CAFile, ok: true},
+		{name: "no client certificate", caFile: CAFile, ok: false},
+		{name: "server certificate used as client certificate", certFile: ServerCertFile, keyFile: ServerKeyFile, caFile: CAFile, ok: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var certFile, keyFile string
+			if tc.certFile != "" {
+				certFile, keyFile = filepath.Join(dir, tc.certFile), filepath.Join(dir, tc.keyFile)
+			}
+			client, err := NewReloader(certFile, keyFile, filepath.Join(dir, tc.caFile))
+			require.NoError(t, err)
+
+			_, err = handshake(t, server.ServerConfig(), client.ClientConfig("localhost"))
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestReloaderRejectsWrongServerName(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, GenerateDev(dir, []string{"localhost"}, time.Hour))
+
+	server, err := NewReloader(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile), "")
+	require.NoError(t, err)
+	client, err := NewReloader("", "", filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+
+	_, err = handshake(t, server.ServerConfig(), client.ClientConfig("grpc.example.com"))
+	require.Error(t, err)
+}
+
+func TestReloaderVerifiesIPAddresses(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, GenerateDev(dir, []string{"localhost", "127.0.0.1"}, time.Hour))
+
+	server, err := NewReloader(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile), "")
+	require.NoError(t, err)
+	client, err := NewReloader("", "", filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+
+	// no SNI is sent for IP addresses, they are verified all the same
+	_, err = handshake(t, server.ServerConfig(), client.ClientConfig("127.0.0.1"))
+	require.NoError(t, err)
+	_, err = handshake(t, server.ServerConfig(), client.ClientConfig("10.0.0.1"))
+	require.Error(t, err)
+	_, err = handshake(t, server.ServerConfig(), client.ClientConfig(""))
+	require.Error(t, err)
+}
+
+func TestReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, GenerateDev(dir, []string{"localhost"}, time.Hour))
+
+	server, err := NewReloader(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile), filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+	client, err := NewReloader(filepath.Join(dir, ClientCertFile), filepath.Join(dir, ClientKeyFile), filepath.Join(dir, CAFile))
+	require.NoError(t, err)
+
+	serverCfg, clientCfg := server.ServerConfig(), client.ClientConfig("localhost")
+
+	before, err := handshake(t, serverCfg, clientCfg)
+	require.NoError(t, err)
+
+	changed, err := server.Reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// rotate everything, including the CA
+	require.NoError(t, GenerateDev(dir, []string{"localhost"}, time.Hour))
+
+	// the server picked up the new CA but the client did not yet
+	changed, err = server.Reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, err = handshake(t, serverCfg, clientCfg)
+	require.Error(t, err)
+
+	changed, err = client.Reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	after, err := handshake(t, serverCfg, clientCfg)
+	require.NoError(t, err)
+	require.NotEqual(t, before, after)
+}
+
+func TestReloaderKeepsCertificatesOnError(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, GenerateDev(dir, []string{"localhost"}, time.Hour))
+
+	r, err := NewReloader(filepath.Join(dir, ServerCertFile), filepath.Join(dir, ServerKeyFile), "")
+	require.NoError(t, err)
+	before, err := r.certificate()
+	require.NoError(t, err)
+
+	require.NoError(t, writeCert(filepath.Join(dir, ServerCertFile), []byte("garbage")))
+
+	_, err = r.Reload()
+	require.Error(t, err)
+
+	after, err := r.certificate()
+	require.NoError(t, err)
+	require.Same(t, before, after)
+}
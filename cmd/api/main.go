@@ -1,42 +1,305 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/abedsully/golang-microservice/api/handler"
+	"github.com/abedsully/golang-microservice/certs"
+	"github.com/abedsully/golang-microservice/denylist"
 	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/logging"
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/sso"
+	"github.com/abedsully/golang-microservice/throttle"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/abedsully/golang-microservice/tracing"
 	"github.com/ianschenck/envflag"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 const minSecretKeySize = 32
 
 func main() {
 	var (
-		secretKey = envflag.String("SECRET_KEY", "01234567890123456789012345678901", "secret key for jwt signing")
-		svcAddr = envflag.String("GRPC_SVC_ADDR", "0.0.0.0:9091", "address where grpc service is listening on")
+		secretKey        = envflag.String("SECRET_KEY", "", "secret key for HS256 jwt signing, at least 32 characters, unused if JWT_SIGNING_KEY_FILE is set")
+		jwtSigningKey    = envflag.String("JWT_SIGNING_KEY_FILE", "", "PEM private key tokens are signed with instead of SECRET_KEY: RSA (RS256), P-256 (ES256) or Ed25519 (EdDSA)")
+		jwtKeysDir       = envflag.String("JWT_VERIFICATION_KEYS_DIR", "", "directory of further PEM keys tokens are verified with and published in /.well-known/jwks.json")
+		jwtKeyGrace      = envflag.Duration("JWT_KEY_ROTATION_GRACE", 24*time.Hour, "how long a replaced or removed key is still accepted and published")
+		jwtKeyReload     = envflag.Duration("JWT_KEY_RELOAD_INTERVAL", 30*time.Second, "how often the jwt key files are checked for changes")
+		tokenFormat      = envflag.String("TOKEN_FORMAT", token.FormatJWT, "format of issued tokens: jwt, paseto-local or paseto-public")
+		pasetoLocalKey   = envflag.String("PASETO_LOCAL_KEY", "", "hex encoded 32 byte key v4.local tokens are encrypted with")
+		pasetoKeyFile    = envflag.String("PASETO_KEY_FILE", "", "PEM Ed25519 private key v4.public tokens are signed with")
+		tokenIssuer      = envflag.String("TOKEN_ISSUER", "golang-microservice", "iss claim of issued tokens, required of verified ones if set")
+		tokenAudience    = envflag.String("TOKEN_AUDIENCE", "golang-microservice", "aud claim of issued tokens, required of verified ones if set")
+		tokenLeeway      = envflag.Duration("TOKEN_LEEWAY", 30*time.Second, "clock skew tolerated when checking token expiry and issue times")
+		svcAddr          = envflag.String("GRPC_SVC_ADDR", "0.0.0.0:9091", "address where grpc service is listening on")
+		serviceToken     = envflag.String("SERVICE_TOKEN", "", "credential the gateway presents to the grpc service, required")
+		tlsCAFile        = envflag.String("GRPC_TLS_CA_FILE", "", "CA the grpc service certificate is verified against, dials plaintext if unset")
+		tlsCertFile      = envflag.String("GRPC_TLS_CERT_FILE", "", "client certificate presented to the grpc service for mutual TLS")
+		tlsKeyFile       = envflag.String("GRPC_TLS_KEY_FILE", "", "client private key")
+		tlsServer        = envflag.String("GRPC_TLS_SERVER_NAME", "", "host name or IP address the grpc service certificate is verified for, the host of GRPC_SVC_ADDR if unset")
+		tlsReload        = envflag.Duration("GRPC_TLS_RELOAD_INTERVAL", 30*time.Second, "how often certificate files are checked for changes")
+		httpAddr         = envflag.String("HTTP_ADDR", ":8080", "address the http server listens on")
+		metricsAddr      = envflag.String("METRICS_ADDR", "0.0.0.0:9093", "address the prometheus /metrics endpoint listens on, kept off HTTP_ADDR so that it is not public, empty to disable")
+		drainDelay       = envflag.Duration("DRAIN_DELAY", 0, "how long /readyz fails before the server stops accepting connections on shutdown")
+		traceExporter    = envflag.String("TRACE_EXPORTER", tracing.ExporterNone, "where spans are exported to: none, stdout, file or otlp (configured by the OTEL_EXPORTER_OTLP_* variables)")
+		traceFile        = envflag.String("TRACE_FILE", "traces.jsonl", "file spans are appended to with the file exporter")
+		traceSampleRatio = envflag.Float64("TRACE_SAMPLE_RATIO", 1, "fraction of new traces that are recorded")
+		requestTimeout   = envflag.Duration("REQUEST_TIMEOUT", 10*time.Second, "deadline of requests, carried to the grpc service")
+		routeTimeouts    = envflag.String("ROUTE_TIMEOUTS", "", "per-route deadlines overriding REQUEST_TIMEOUT, e.g. \"POST /orders/=15s,GET /products/=2s\"")
+		loginFree        = envflag.Int("LOGIN_FREE_ATTEMPTS", 3, "failed logins per email before progressive delays start")
+		loginIPFree      = envflag.Int("LOGIN_IP_FREE_ATTEMPTS", 20, "failed logins per client IP before progressive delays start")
+		loginBaseDelay   = envflag.Duration("LOGIN_BASE_DELAY", time.Second, "delay after the first throttled failed login, doubling with each further one")
+		loginMaxDelay    = envflag.Duration("LOGIN_MAX_DELAY", 15*time.Minute, "longest delay between failed logins")
+		loginWindow      = envflag.Duration("LOGIN_ATTEMPT_WINDOW", time.Hour, "how long failed logins are remembered")
+		resendDelay      = envflag.Duration("VERIFICATION_RESEND_DELAY", time.Minute, "delay before a verification email can be resent a second time, doubling with each further resend")
+		mfaRequiredRoles = envflag.String("MFA_REQUIRED_ROLES", rbac.RoleSuperuser, "comma separated roles whose users get no permissions until they enable two-factor authentication")
+		ssoProvidersFile = envflag.String("SSO_PROVIDERS_FILE", "", "JSON file of the OpenID Connect providers users can log in with")
+		tokenDenylist    = envflag.String("TOKEN_DENYLIST", "memory", "where revoked access tokens are kept: memory (this gateway only) or shared (the grpc service's database, for several gateways)")
+		logFormat        = envflag.String("LOG_FORMAT", "json", "log format: json or text")
+		logLevel         = envflag.String("LOG_LEVEL", "info", "minimum log level: debug, info, warn or error")
+		shutdownWait     = envflag.Duration("SHUTDOWN_TIMEOUT", 30*time.Second, "how long in-flight requests may run on shutdown before they are cut off")
 	)
+	envflag.Parse()
 
-	if len(*secretKey) < minSecretKeySize {
-		log.Fatalf("SECRET_KEY must be at least %d characters, now: %d", minSecretKeySize, len(*secretKey))
+	if _, err := logging.Setup(os.Stderr, *logFormat, *logLevel); err != nil {
+		fatal("invalid logging configuration", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		ServiceName: "golang-microservice-api",
+		Exporter:    *traceExporter,
+		File:        *traceFile,
+		SampleRatio: *traceSampleRatio,
+	})
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
+	tokenOpts := token.Options{Issuer: *tokenIssuer, Audience: *tokenAudience, Leeway: *tokenLeeway}
+	var tokenMaker token.Maker
+	switch *tokenFormat {
+	case token.FormatJWT:
+		if *jwtSigningKey != "" {
+			keyFiles, err := token.NewKeyFiles(*jwtSigningKey, *jwtKeysDir, *jwtKeyGrace)
+			if err != nil {
+				fatal("error loading jwt keys", err)
+			}
+			go keyFiles.Watch(ctx, *jwtKeyReload)
+			tokenMaker = token.NewJWTMakerWithKeys(keyFiles.KeySet(), tokenOpts)
+		} else {
+			if len(*secretKey) < minSecretKeySize {
+				fatal("invalid SECRET_KEY", fmt.Errorf("must be set to at least %d characters, now: %d", minSecretKeySize, len(*secretKey)))
+			}
+			if *jwtKeysDir != "" {
+				fatal("invalid jwt configuration", fmt.Errorf("JWT_VERIFICATION_KEYS_DIR requires JWT_SIGNING_KEY_FILE"))
+			}
+			tokenMaker = token.NewJWTMakerWithKeys(token.NewKeySet(0, token.NewHMACKey("", []byte(*secretKey))), tokenOpts)
+		}
+	case token.FormatPasetoLocal:
+		key, err := hex.DecodeString(*pasetoLocalKey)
+		if err != nil {
+			fatal("invalid PASETO_LOCAL_KEY", err)
+		}
+		if tokenMaker, err = token.NewPasetoLocalMaker(key, tokenOpts); err != nil {
+			fatal("invalid PASETO_LOCAL_KEY", err)
+		}
+	case token.FormatPasetoPublic:
+		key, err := token.LoadPEMKey(*pasetoKeyFile)
+		if err != nil {
+			fatal("invalid PASETO_KEY_FILE", err)
+		}
+		if !key.CanSign() {
+			fatal("invalid PASETO_KEY_FILE", fmt.Errorf("%s holds no private key", *pasetoKeyFile))
+		}
+		if tokenMaker, err = token.NewPasetoPublicMaker(key, tokenOpts); err != nil {
+			fatal("invalid PASETO_KEY_FILE", err)
+		}
+	default:
+		fatal("invalid TOKEN_FORMAT", fmt.Errorf("unknown format %q", *tokenFormat))
+	}
+
+	routes, err := handler.ParseRouteTimeouts(*routeTimeouts)
+	if err != nil {
+		fatal("invalid ROUTE_TIMEOUTS", err)
+	}
+
+	if len(*serviceToken) < minSecretKeySize {
+		fatal("invalid SERVICE_TOKEN", fmt.Errorf("must be set to at least %d characters, now: %d", minSecretKeySize, len(*serviceToken)))
+	}
+
+	creds := insecure.NewCredentials()
+	if *tlsCAFile != "" {
+		reloader, err := certs.NewReloader(*tlsCertFile, *tlsKeyFile, *tlsCAFile)
+		if err != nil {
+			fatal("failed to load certificates", err)
+		}
+		go reloader.Watch(ctx, *tlsReload)
+
+		serverName := *tlsServer
+		if serverName == "" {
+			// the host of the target, without a resolver scheme such as dns:///
+			target := (*svcAddr)[strings.LastIndex(*svcAddr, "/")+1:]
+			if serverName, _, err = net.SplitHostPort(target); err != nil {
+				fatal("invalid GRPC_SVC_ADDR, set GRPC_TLS_SERVER_NAME instead", err)
+			}
+		}
+		creds = credentials.NewTLS(reloader.ClientConfig(serverName))
+	} else {
+		slog.Warn("GRPC_TLS_CA_FILE is not set, dialing the grpc service in plaintext")
 	}
 
 	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithPerRPCCredentials(handler.NewServiceCredentials(*serviceToken)),
+		grpc.WithChainUnaryInterceptor(metrics.UnaryClientInterceptor()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)),
 	}
 
 	conn, err := grpc.NewClient(*svcAddr, opts...)
 
 	if err != nil {
-		log.Fatalf("failed to connect to server: %v", err)
+		fatal("failed to connect to server", err)
 	}
 
 	defer conn.Close()
 
 	client := pb.NewGolangMicroserviceClient(conn)
 
-	hdl := handler.NewHandler(client, *secretKey)
-	handler.RegisterRoutes(hdl)
-	handler.Start(":8080")
-}
\ No newline at end of file
+	// both limiters share one store, their keys are prefixed with what they
+	// are counting
+	attempts := throttle.NewMemoryStore()
+	emailCfg := throttle.DefaultConfig()
+	emailCfg.FreeAttempts = *loginFree
+	emailCfg.BaseDelay = *loginBaseDelay
+	emailCfg.MaxDelay = *loginMaxDelay
+	emailCfg.Window = *loginWindow
+	ipCfg := emailCfg
+	ipCfg.FreeAttempts = *loginIPFree
+
+	// the first resend is immediate, later ones wait progressively longer
+	resendCfg := throttle.Config{
+		FreeAttempts: 0,
+		BaseDelay:    *resendDelay,
+		MaxDelay:     24 * time.Hour,
+		Window:       24 * time.Hour,
+	}
+
+	var denied denylist.Denylist
+	switch *tokenDenylist {
+	case "memory":
+		denied = denylist.NewMemory()
+	case "shared":
+		denied = handler.NewRemoteDenylist(client)
+	default:
+		fatal("invalid TOKEN_DENYLIST", fmt.Errorf("unknown denylist %q", *tokenDenylist))
+	}
+
+	hdl := handler.NewHandler(client, pb.NewAuthServiceClient(conn), healthpb.NewHealthClient(conn), tokenMaker, handler.LoginThrottle{
+		ByIP:    throttle.NewLimiter(attempts, ipCfg),
+		ByEmail: throttle.NewLimiter(attempts, emailCfg),
+	}, throttle.NewLimiter(attempts, resendCfg), denied)
+	for _, role := range strings.Split(*mfaRequiredRoles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			hdl.MFARequiredRoles = append(hdl.MFARequiredRoles, role)
+		}
+	}
+
+	if *ssoProvidersFile != "" {
+		cfgs, err := sso.LoadConfig(*ssoProvidersFile)
+		if err != nil {
+			fatal("invalid SSO_PROVIDERS_FILE", err)
+		}
+		hdl.SSOProviders = make(map[string]*sso.Provider, len(cfgs))
+		for _, cfg := range cfgs {
+			p, err := sso.NewProvider(ctx, cfg)
+			if err != nil {
+				fatal("failed to set up sso provider", err)
+			}
+			hdl.SSOProviders[cfg.Name] = p
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              *httpAddr,
+		Handler:           handler.RegisterRoutes(hdl, handler.Timeouts{Default: *requestTimeout, Routes: routes}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("http server is listening", "addr", *httpAddr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	var metricsSrv *http.Server
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			slog.Info("metrics are served", "addr", *metricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serveErr <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("failed to serve", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutting down, failing readiness before draining", "drain_delay", *drainDelay)
+	hdl.Drain()
+	time.Sleep(*drainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownWait)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("requests still running, closing connections", "timeout", *shutdownWait, "error", err)
+		srv.Close()
+	}
+
+	// metrics stay available while draining and are the last thing to go
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush spans", "error", err)
+	}
+
+	// the deferred conn.Close runs once all handlers have returned
+	slog.Info("http server stopped")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abedsully/golang-microservice/certs"
+)
+
+// certgen writes a development CA together with a server certificate for the
+// gRPC service and a client certificate for the API gateway.
+func main() {
+	var (
+		out      = flag.String("out", "dev-certs", "directory the certificates are written to")
+		hosts    = flag.String("hosts", "localhost,127.0.0.1", "comma-separated host names and IPs of the grpc service")
+		validFor = flag.Duration("valid-for", 365*24*time.Hour, "how long the certificates are valid")
+	)
+	flag.Parse()
+
+	if err := certs.GenerateDev(*out, strings.Split(*hosts, ","), *validFor); err != nil {
+		log.Fatalf("failed to generate certificates: %v", err)
+	}
+
+	log.Printf("certificates written to %s", *out)
+}
@@ -1,49 +1,404 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/abedsully/golang-microservice/certs"
 	"github.com/abedsully/golang-microservice/db"
+	"github.com/abedsully/golang-microservice/grpc/outbox"
 	"github.com/abedsully/golang-microservice/grpc/pb"
 	"github.com/abedsully/golang-microservice/grpc/server"
 	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/grpc/webhook"
+	"github.com/abedsully/golang-microservice/logging"
+	"github.com/abedsully/golang-microservice/mail"
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/password"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/abedsully/golang-microservice/tracing"
 	"github.com/ianschenck/envflag"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
+const minSecretSize = 32
+
 func main() {
 
 	var (
-		svcAddr = envflag.String("SVC_ADDR", "0.0.0.0:9091", "address where grpc service is listening on")
+		svcAddr             = envflag.String("SVC_ADDR", "0.0.0.0:9091", "address where grpc service is listening on")
+		secretKey           = envflag.String("SECRET_KEY", "", "secret key for HS256 jwt verification, at least 32 characters, unused if JWT_VERIFICATION_KEYS_DIR is set")
+		jwtKeysDir          = envflag.String("JWT_VERIFICATION_KEYS_DIR", "", "directory of PEM public keys tokens are verified with (RS256, ES256 or EdDSA), picked by the kid header")
+		jwtKeyGrace         = envflag.Duration("JWT_KEY_ROTATION_GRACE", 24*time.Hour, "how long a key removed from JWT_VERIFICATION_KEYS_DIR is still accepted")
+		jwtKeyReload        = envflag.Duration("JWT_KEY_RELOAD_INTERVAL", 30*time.Second, "how often JWT_VERIFICATION_KEYS_DIR is checked for changes")
+		tokenFormat         = envflag.String("TOKEN_FORMAT", token.FormatJWT, "format of verified tokens: jwt, paseto-local or paseto-public")
+		pasetoLocalKey      = envflag.String("PASETO_LOCAL_KEY", "", "hex encoded 32 byte key v4.local tokens are decrypted with")
+		pasetoKeyFile       = envflag.String("PASETO_KEY_FILE", "", "PEM Ed25519 public key v4.public tokens are verified with")
+		tokenIssuer         = envflag.String("TOKEN_ISSUER", "golang-microservice", "iss claim required of tokens, unchecked if empty")
+		tokenAudience       = envflag.String("TOKEN_AUDIENCE", "golang-microservice", "aud claim required of tokens, unchecked if empty")
+		tokenLeeway         = envflag.Duration("TOKEN_LEEWAY", 30*time.Second, "clock skew tolerated when checking token expiry and issue times")
+		serviceToken        = envflag.String("SERVICE_TOKEN", "", "credential internal services present to call internal-only methods, required")
+		outboxFile          = envflag.String("OUTBOX_FILE", "", "if set, outbox events are also appended to this file as JSON lines")
+		outboxPollInterval  = envflag.Duration("OUTBOX_POLL_INTERVAL", time.Second, "how often the outbox relay polls for new events")
+		outboxMaxAttempts   = envflag.Int64("OUTBOX_MAX_ATTEMPTS", 10, "publish attempts before an outbox event is dead-lettered")
+		webhookMaxAttempts  = envflag.Int64("WEBHOOK_MAX_ATTEMPTS", 8, "delivery attempts before a webhook delivery is marked as failed")
+		webhookDisableAfter = envflag.Int64("WEBHOOK_DISABLE_AFTER", 25, "consecutive failed deliveries after which a webhook is disabled, 0 to never disable")
+		lockoutAttempts     = envflag.Int64("LOGIN_LOCKOUT_ATTEMPTS", 10, "consecutive failed logins after which an account is locked, 0 to never lock")
+		lockoutDuration     = envflag.Duration("LOGIN_LOCKOUT_DURATION", 15*time.Minute, "how long an account stays locked")
+		refreshTokenTTL     = envflag.Duration("REFRESH_TOKEN_TTL", 24*time.Hour, "how long a refresh token can be used, every renewal hands out a new one")
+		passwordHash        = envflag.String("PASSWORD_HASH", password.AlgorithmArgon2id, "algorithm new passwords are hashed with: argon2id or bcrypt, other hashes are upgraded on login")
+		argon2Memory        = envflag.Uint("ARGON2_MEMORY", uint(password.DefaultArgon2id().Memory), "memory per argon2id hash in KiB")
+		argon2Iterations    = envflag.Uint("ARGON2_ITERATIONS", uint(password.DefaultArgon2id().Iterations), "argon2id passes over the memory")
+		argon2Parallelism   = envflag.Uint("ARGON2_PARALLELISM", uint(password.DefaultArgon2id().Parallelism), "argon2id lanes")
+		argon2MemoryLimit   = envflag.Uint("ARGON2_MEMORY_LIMIT", password.DefaultArgon2MemoryLimit, "memory in KiB that concurrent argon2id hashes may use together, 0 for no limit")
+		bcryptCost          = envflag.Int("BCRYPT_COST", password.DefaultBcrypt().Cost, "bcrypt cost")
+		passwordMinLength   = envflag.Int("PASSWORD_MIN_LENGTH", password.DefaultPolicy().MinLength, "fewest characters a password may have")
+		passwordMaxLength   = envflag.Int("PASSWORD_MAX_LENGTH", password.DefaultPolicy().MaxLength, "most characters a password may have, 0 for no limit")
+		breachedPasswords   = envflag.String("PASSWORD_BREACHED_LIST", "", "file of breached passwords, one per line, rejected in addition to the built-in common passwords")
+		passwordResetURL    = envflag.String("PASSWORD_RESET_URL", "http://localhost:8080/reset-password", "page password reset links point to, the token is added as the token query parameter")
+		passwordResetTTL    = envflag.Duration("PASSWORD_RESET_TTL", time.Hour, "how long password reset links can be used")
+		verificationURL     = envflag.String("EMAIL_VERIFICATION_URL", "http://localhost:8080/users/verify", "page email verification links point to, the token is added as the token query parameter")
+		verificationTTL     = envflag.Duration("EMAIL_VERIFICATION_TTL", 48*time.Hour, "how long email verification links can be used")
+		totpIssuer          = envflag.String("TOTP_ISSUER", "golang-microservice", "name of the service shown in authenticator apps")
+		requireVerified     = envflag.String("REQUIRE_VERIFIED_EMAIL", string(server.VerificationOptional), "what unverified users cannot do: none, checkout (place orders) or login")
+		mailSender          = envflag.String("MAIL_SENDER", mail.SenderLog, "how mails to users are delivered: log or file")
+		mailFile            = envflag.String("MAIL_FILE", "mail.jsonl", "file mails are appended to with the file sender")
+		mailQueueSize       = envflag.Int("MAIL_QUEUE_SIZE", 1000, "mails waiting to be delivered in the background before further ones fail")
+		idempotencyKeyTTL   = envflag.Duration("IDEMPOTENCY_KEY_TTL", 24*time.Hour, "how long idempotency keys are remembered")
+		idempotencySecret   = envflag.String("IDEMPOTENCY_SECRET", "", "key of the HMAC requests with an idempotency key are fingerprinted with, required")
+		tlsCertFile         = envflag.String("TLS_CERT_FILE", "", "server certificate, serves plaintext if unset")
+		tlsKeyFile          = envflag.String("TLS_KEY_FILE", "", "server private key")
+		tlsClientCAFile     = envflag.String("TLS_CLIENT_CA_FILE", "", "if set, clients must present a certificate signed by this CA")
+		tlsReloadInterval   = envflag.Duration("TLS_RELOAD_INTERVAL", 30*time.Second, "how often certificate files are checked for changes")
+		healthCheckInterval = envflag.Duration("HEALTH_CHECK_INTERVAL", 5*time.Second, "how often the database is pinged to report health")
+		enableReflection    = envflag.Bool("GRPC_REFLECTION", false, "register the gRPC server reflection service, limited to internal callers")
+		metricsAddr         = envflag.String("METRICS_ADDR", "0.0.0.0:9092", "address the prometheus /metrics endpoint listens on, empty to disable")
+		traceExporter       = envflag.String("TRACE_EXPORTER", tracing.ExporterNone, "where spans are exported to: none, stdout, file or otlp (configured by the OTEL_EXPORTER_OTLP_* variables)")
+		traceFile           = envflag.String("TRACE_FILE", "traces.jsonl", "file spans are appended to with the file exporter")
+		traceSampleRatio    = envflag.Float64("TRACE_SAMPLE_RATIO", 1, "fraction of new traces that are recorded")
+		logFormat           = envflag.String("LOG_FORMAT", "json", "log format: json or text")
+		logLevel            = envflag.String("LOG_LEVEL", "info", "minimum log level: debug, info, warn or error")
+		shutdownTimeout     = envflag.Duration("SHUTDOWN_TIMEOUT", 30*time.Second, "how long in-flight calls may run after SIGTERM before they are cancelled")
 	)
+	envflag.Parse()
+
+	if _, err := logging.Setup(os.Stderr, *logFormat, *logLevel); err != nil {
+		fatal("invalid logging configuration", err)
+	}
+
+	if len(*serviceToken) < minSecretSize {
+		fatal("invalid SERVICE_TOKEN", fmt.Errorf("must be set to at least %d characters, now: %d", minSecretSize, len(*serviceToken)))
+	}
+	if len(*idempotencySecret) < minSecretSize {
+		fatal("invalid IDEMPOTENCY_SECRET", fmt.Errorf("must be set to at least %d characters, now: %d", minSecretSize, len(*idempotencySecret)))
+	}
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(signalCtx, tracing.Config{
+		ServiceName: "golang-microservice-grpc",
+		Exporter:    *traceExporter,
+		File:        *traceFile,
+		SampleRatio: *traceSampleRatio,
+	})
+	if err != nil {
+		fatal("error setting up tracing", err)
+	}
 
 	// instantiate db
 	db, err := db.NewDatabase()
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		fatal("error opening database", err)
 	}
 	defer db.Close()
-	log.Println("Successfully connected to database")
+	slog.Info("successfully connected to database")
+
+	if err := metrics.RegisterDBStats(db.GetDB().DB, "golang_microservice"); err != nil {
+		fatal("error registering database metrics", err)
+	}
 
 	// instantiate server
 	st := storer.NewMySqlStorer(db.GetDB())
-	srv := server.NewServer(st)
+	mailer, err := mail.NewSender(*mailSender, *mailFile)
+	if err != nil {
+		fatal("error setting up mail sender", err)
+	}
+	if c, ok := mailer.(io.Closer); ok {
+		defer c.Close()
+	}
+	// mails are delivered in the background, so that answers do not wait
+	// for them and their timing does not tell whether one was sent
+	asyncMailer := mail.NewAsyncSender(mailer, *mailQueueSize)
+	defer asyncMailer.Close()
+
+	srvCfg := server.DefaultConfig()
+	srvCfg.Lockout.MaxAttempts = *lockoutAttempts
+	srvCfg.Lockout.Duration = *lockoutDuration
+	srvCfg.Sessions.RefreshTokenTTL = *refreshTokenTTL
+	switch *passwordHash {
+	case password.AlgorithmArgon2id:
+		if *argon2Memory == 0 || *argon2Iterations == 0 || *argon2Parallelism == 0 || *argon2Parallelism > 255 {
+			fatal("invalid argon2id parameters", errors.New("ARGON2_MEMORY and ARGON2_ITERATIONS must be positive, ARGON2_PARALLELISM between 1 and 255"))
+		}
+		srvCfg.Passwords.Hasher = password.Argon2id{
+			Memory:      uint32(*argon2Memory),
+			Iterations:  uint32(*argon2Iterations),
+			Parallelism: uint8(*argon2Parallelism),
+			SaltLength:  password.DefaultArgon2id().SaltLength,
+			KeyLength:   password.DefaultArgon2id().KeyLength,
+		}
+	case password.AlgorithmBcrypt:
+		srvCfg.Passwords.Hasher = password.Bcrypt{Cost: *bcryptCost}
+	default:
+		fatal("invalid PASSWORD_HASH", fmt.Errorf("unknown algorithm %q", *passwordHash))
+	}
+	// argon2id hashes are also checked when bcrypt is configured
+	password.SetArgon2MemoryLimit(uint64(*argon2MemoryLimit))
+	srvCfg.Passwords.Policy.MinLength = *passwordMinLength
+	srvCfg.Passwords.Policy.MaxLength = *passwordMaxLength
+	if *breachedPasswords != "" {
+		if err := srvCfg.Passwords.Policy.LoadBreached(*breachedPasswords); err != nil {
+			fatal("invalid PASSWORD_BREACHED_LIST", err)
+		}
+	}
+	srvCfg.PasswordReset.URL = *passwordResetURL
+	srvCfg.PasswordReset.TTL = *passwordResetTTL
+	srvCfg.EmailVerification.URL = *verificationURL
+	srvCfg.EmailVerification.TTL = *verificationTTL
+	srvCfg.EmailVerification.Require, err = server.ParseVerificationPolicy(*requireVerified)
+	if err != nil {
+		fatal("invalid REQUIRE_VERIFIED_EMAIL", err)
+	}
+	srvCfg.MFA.Issuer = *totpIssuer
+	srv := server.NewServer(st, asyncMailer, srvCfg)
+
+	// start outbox relay
+	inProcess := outbox.NewInProcessPublisher()
+	inProcess.Subscribe(func(ctx context.Context, e *storer.OutboxEvent) error {
+		slog.InfoContext(ctx, "event published", "event_type", e.EventType, "aggregate_type", e.AggregateType, "aggregate_id", e.AggregateID)
+		return nil
+	})
+
+	webhookCfg := webhook.DefaultConfig()
+	webhookCfg.MaxAttempts = *webhookMaxAttempts
+	webhookCfg.DisableAfter = *webhookDisableAfter
+	dispatcher := webhook.NewDispatcher(st, webhookCfg)
+	inProcess.Subscribe(dispatcher.Enqueue)
+
+	publishers := outbox.MultiPublisher{inProcess}
+
+	if *outboxFile != "" {
+		fp, err := outbox.NewFilePublisher(*outboxFile)
+		if err != nil {
+			fatal("error opening outbox file", err)
+		}
+		defer fp.Close()
+		publishers = append(publishers, fp)
+	}
+
+	relayCfg := outbox.DefaultConfig()
+	relayCfg.PollInterval = *outboxPollInterval
+	relayCfg.MaxAttempts = *outboxMaxAttempts
+
+	// background workers keep running until the server has drained, so that
+	// events written by the last calls are still relayed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var workers sync.WaitGroup
+	workers.Add(4)
+	go func() {
+		defer workers.Done()
+		outbox.NewRelay(st, publishers, relayCfg).Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		server.SweepIdempotencyKeys(ctx, st, time.Hour)
+	}()
+	go func() {
+		defer workers.Done()
+		server.SweepSessions(ctx, st, time.Hour)
+	}()
 
 	// register server with gRPC server
-	grpcSrv := grpc.NewServer()
+	var srvOpts []grpc.ServerOption
+	if *tlsCertFile != "" {
+		reloader, err := certs.NewReloader(*tlsCertFile, *tlsKeyFile, *tlsClientCAFile)
+		if err != nil {
+			fatal("error loading certificates", err)
+		}
+		go reloader.Watch(ctx, *tlsReloadInterval)
+		srvOpts = append(srvOpts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+	} else {
+		if *tlsClientCAFile != "" {
+			fatal("invalid TLS configuration", errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE"))
+		}
+		slog.Warn("TLS_CERT_FILE is not set, serving plaintext")
+	}
+
+	tokenOpts := token.Options{Issuer: *tokenIssuer, Audience: *tokenAudience, Leeway: *tokenLeeway}
+	var tokenMaker token.Maker
+	switch *tokenFormat {
+	case token.FormatJWT:
+		var keys *token.KeySet
+		if *jwtKeysDir != "" {
+			keyFiles, err := token.NewKeyFiles("", *jwtKeysDir, *jwtKeyGrace)
+			if err != nil {
+				fatal("error loading jwt keys", err)
+			}
+			go keyFiles.Watch(ctx, *jwtKeyReload)
+			keys = keyFiles.KeySet()
+		} else {
+			if len(*secretKey) < minSecretSize {
+				fatal("invalid SECRET_KEY", fmt.Errorf("must be set to at least %d characters, now: %d", minSecretSize, len(*secretKey)))
+			}
+			keys = token.NewKeySet(0, token.NewHMACKey("", []byte(*secretKey)))
+		}
+		tokenMaker = token.NewJWTMakerWithKeys(keys, tokenOpts)
+	case token.FormatPasetoLocal:
+		key, err := hex.DecodeString(*pasetoLocalKey)
+		if err != nil {
+			fatal("invalid PASETO_LOCAL_KEY", err)
+		}
+		if tokenMaker, err = token.NewPasetoLocalMaker(key, tokenOpts); err != nil {
+			fatal("invalid PASETO_LOCAL_KEY", err)
+		}
+	case token.FormatPasetoPublic:
+		key, err := token.LoadPEMKey(*pasetoKeyFile)
+		if err != nil {
+			fatal("invalid PASETO_KEY_FILE", err)
+		}
+		if tokenMaker, err = token.NewPasetoPublicMaker(key, tokenOpts); err != nil {
+			fatal("invalid PASETO_KEY_FILE", err)
+		}
+	default:
+		fatal("invalid TOKEN_FORMAT", fmt.Errorf("unknown format %q", *tokenFormat))
+	}
+
+	auth := server.NewAuthenticator(tokenMaker, *serviceToken, srv, srv)
+	srvOpts = append(srvOpts,
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithFilter(filters.Not(filters.HealthCheck())),
+		)),
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			server.LoggingUnaryInterceptor(),
+			auth.UnaryInterceptor(),
+			server.IdempotencyUnaryInterceptor(st, []byte(*idempotencySecret), *idempotencyKeyTTL,
+				pb.GolangMicroservice_CreateOrder_FullMethodName,
+				pb.GolangMicroservice_CreateUser_FullMethodName,
+			),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			server.LoggingStreamInterceptor(),
+			auth.StreamInterceptor(),
+		),
+	)
+	grpcSrv := grpc.NewServer(srvOpts...)
 	pb.RegisterGolangMicroserviceServer(grpcSrv, srv)
+	pb.RegisterAuthServiceServer(grpcSrv, srv)
+
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(grpcSrv, healthSrv)
+	go server.WatchDatabaseHealth(signalCtx, healthSrv, db, *healthCheckInterval)
+
+	if *enableReflection {
+		reflection.Register(grpcSrv)
+	}
 
 	listener, err := net.Listen("tcp", *svcAddr)
 
 	if err != nil {
-		log.Fatalf("listener failed: %v", err)
+		fatal("listener failed", err)
 	}
 
-	log.Printf("server is listening on %s", *svcAddr)
-	err = grpcSrv.Serve(listener)
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("server is listening", "addr", *svcAddr)
+		serveErr <- grpcSrv.Serve(listener)
+	}()
 
-	if err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	var metricsSrv *http.Server
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			slog.Info("metrics are served", "addr", *metricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serveErr <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("failed to serve", err)
+	case <-signalCtx.Done():
 	}
+	stop()
+	slog.Info("shutting down, draining in-flight calls")
+
+	// report not serving before draining so that clients stop picking this
+	// instance; signalCtx is done, so the database watcher no longer
+	// overrides the status
+	healthSrv.Shutdown()
+
+	drained := make(chan struct{})
+	go func() {
+		grpcSrv.GracefulStop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(*shutdownTimeout):
+		slog.Warn("calls still running, cancelling them", "timeout", *shutdownTimeout)
+		grpcSrv.Stop()
+	}
+
+	cancel()
+	workers.Wait()
+
+	// metrics stay available while draining and are the last thing to go
+	if metricsSrv != nil {
+		metricsSrv.Close()
+	}
+
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("error flushing spans", "error", err)
+	}
+
+	slog.Info("server stopped")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
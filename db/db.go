@@ -1,10 +1,14 @@
 package db
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/abedsully/golang-microservice/tracing"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	"go.opentelemetry.io/otel"
 )
 
 type Database struct {
@@ -12,13 +16,18 @@ type Database struct {
 }
 
 func NewDatabase() (*Database, error) {
-	db, err := sqlx.Open("mysql", "root:password@tcp(localhost:3306)/golang_microservice?parseTime=true")
+	// queries get child spans of the traced call they are made for
+	db, err := otelsql.Open("mysql", "root:password@tcp(localhost:3306)/golang_microservice?parseTime=true",
+		otelsql.WithDBSystem("mysql"),
+		otelsql.WithDBName("golang_microservice"),
+		otelsql.WithTracerProvider(tracing.ChildSpansOnly(otel.GetTracerProvider())),
+	)
 
 	if err != nil {
 		return nil, fmt.Errorf("Error opening database: %w", err)
 	}
 
-	return &Database{db: db}, nil
+	return &Database{db: sqlx.NewDb(db, "mysql")}, nil
 }
 
 func (d *Database) Close() error {
@@ -27,4 +36,9 @@ func (d *Database) Close() error {
 
 func (d *Database) GetDB() *sqlx.DB {
 	return d.db
-}
\ No newline at end of file
+}
+
+// PingContext checks that the database can be reached.
+func (d *Database) PingContext(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
@@ -0,0 +1,16 @@
+CREATE TABLE
+    `outbox` (
+        `id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `aggregate_type` varchar(64) NOT NULL,
+        `aggregate_id` varchar(255) NOT NULL,
+        `event_type` varchar(64) NOT NULL,
+        `payload` json NOT NULL,
+        `status` ENUM('pending', 'published', 'dead') NOT NULL DEFAULT 'pending',
+        `attempts` int NOT NULL DEFAULT 0,
+        `last_error` text,
+        `available_at` datetime NOT NULL DEFAULT (now()),
+        `created_at` datetime DEFAULT (now()),
+        `published_at` datetime,
+        INDEX `outbox_status_id_idx` (`status`, `id`),
+        INDEX `outbox_aggregate_idx` (`aggregate_type`, `aggregate_id`, `id`)
+    );
@@ -0,0 +1,32 @@
+CREATE TABLE
+    `webhook_subscriptions` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `url` varchar(2048) NOT NULL,
+        `event_types` varchar(1024) NOT NULL,
+        `secret` varchar(255) NOT NULL,
+        `is_active` bool NOT NULL DEFAULT true,
+        `consecutive_failures` int NOT NULL DEFAULT 0,
+        `disabled_at` datetime,
+        `created_at` datetime DEFAULT (now()),
+        `updated_at` datetime
+    );
+
+CREATE TABLE
+    `webhook_deliveries` (
+        `id` bigint PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `subscription_id` int NOT NULL,
+        `event_id` bigint NOT NULL,
+        `event_type` varchar(64) NOT NULL,
+        `payload` json NOT NULL,
+        `status` ENUM('pending', 'succeeded', 'failed') NOT NULL DEFAULT 'pending',
+        `attempts` int NOT NULL DEFAULT 0,
+        `response_code` int,
+        `last_error` text,
+        `next_attempt_at` datetime NOT NULL DEFAULT (now()),
+        `created_at` datetime DEFAULT (now()),
+        `delivered_at` datetime,
+        UNIQUE (`subscription_id`, `event_id`),
+        INDEX `webhook_deliveries_status_idx` (`status`, `next_attempt_at`),
+        CONSTRAINT `webhook_deliveries_subscription_fk` FOREIGN KEY (`subscription_id`)
+            REFERENCES `webhook_subscriptions` (`id`) ON DELETE CASCADE
+    );
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `idempotency_keys`;
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE
+    `idempotency_keys` (
+        `method` varchar(255) NOT NULL,
+        `idempotency_key` varchar(255) NOT NULL,
+        `fingerprint` char(64) NOT NULL,
+        `status` ENUM('processing', 'completed') NOT NULL DEFAULT 'processing',
+        `response` blob,
+        `created_at` datetime DEFAULT (now()),
+        `expires_at` datetime NOT NULL,
+        PRIMARY KEY (`method`, `idempotency_key`),
+        INDEX `idempotency_keys_expires_at_idx` (`expires_at`)
+    );
@@ -0,0 +1,12 @@
+CREATE TABLE
+    `password_reset_tokens` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `user_id` int NOT NULL,
+        `token_hash` char(64) NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        `expires_at` datetime NOT NULL,
+        `used_at` datetime,
+        UNIQUE (`token_hash`),
+        CONSTRAINT `password_reset_tokens_user_id_fk` FOREIGN KEY (`user_id`)
+            REFERENCES `users` (`id`) ON DELETE CASCADE
+    );
@@ -0,0 +1,18 @@
+ALTER TABLE `users`
+    ADD COLUMN `email_verified_at` datetime;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE `users` SET `email_verified_at` = `created_at`;
+
+CREATE TABLE
+    `email_verification_tokens` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `user_id` int NOT NULL,
+        `token_hash` char(64) NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        `expires_at` datetime NOT NULL,
+        `used_at` datetime,
+        UNIQUE (`token_hash`),
+        CONSTRAINT `email_verification_tokens_user_id_fk` FOREIGN KEY (`user_id`)
+            REFERENCES `users` (`id`) ON DELETE CASCADE
+    );
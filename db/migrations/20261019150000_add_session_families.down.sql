@@ -0,0 +1,5 @@
+ALTER TABLE `sessions`
+    DROP INDEX `sessions_family_id_idx`,
+    DROP COLUMN `family_id`,
+    DROP COLUMN `replaced_by`,
+    DROP COLUMN `used_at`;
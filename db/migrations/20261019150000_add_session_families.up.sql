@@ -0,0 +1,11 @@
+ALTER TABLE `sessions`
+    ADD COLUMN `family_id` varchar(255),
+    ADD COLUMN `replaced_by` varchar(255),
+    ADD COLUMN `used_at` datetime;
+
+-- every existing session starts a family of its own
+UPDATE `sessions` SET `family_id` = `id`;
+
+ALTER TABLE `sessions`
+    MODIFY `family_id` varchar(255) NOT NULL,
+    ADD INDEX `sessions_family_id_idx` (`family_id`);
@@ -0,0 +1,6 @@
+ALTER TABLE `sessions`
+    DROP INDEX `sessions_user_email_idx`,
+    DROP INDEX `sessions_expires_at_idx`,
+    DROP COLUMN `user_agent`,
+    DROP COLUMN `ip_address`,
+    DROP COLUMN `last_used_at`;
@@ -0,0 +1,6 @@
+ALTER TABLE `sessions`
+    ADD COLUMN `user_agent` varchar(512) NOT NULL DEFAULT '',
+    ADD COLUMN `ip_address` varchar(45) NOT NULL DEFAULT '',
+    ADD COLUMN `last_used_at` datetime,
+    ADD INDEX `sessions_user_email_idx` (`user_email`),
+    ADD INDEX `sessions_expires_at_idx` (`expires_at`);
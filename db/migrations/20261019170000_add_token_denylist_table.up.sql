@@ -0,0 +1,7 @@
+CREATE TABLE
+    `token_denylist` (
+        `jti` varchar(255) PRIMARY KEY NOT NULL,
+        `expires_at` datetime NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        INDEX `token_denylist_expires_at_idx` (`expires_at`)
+    );
@@ -0,0 +1,12 @@
+ALTER TABLE `users`
+    ADD COLUMN `is_admin` bool NOT NULL DEFAULT false;
+
+UPDATE `users` u SET u.`is_admin` = true WHERE EXISTS (
+    SELECT 1 FROM `user_roles` ur JOIN `roles` r ON r.`id` = ur.`role_id`
+    WHERE ur.`user_id` = u.`id` AND r.`name` = 'superuser'
+);
+
+DROP TABLE IF EXISTS `user_roles`;
+DROP TABLE IF EXISTS `role_permissions`;
+DROP TABLE IF EXISTS `permissions`;
+DROP TABLE IF EXISTS `roles`;
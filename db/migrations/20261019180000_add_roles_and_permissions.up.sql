@@ -0,0 +1,72 @@
+CREATE TABLE
+    `roles` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `name` varchar(64) NOT NULL,
+        `description` varchar(255) NOT NULL DEFAULT '',
+        `created_at` datetime DEFAULT (now()),
+        UNIQUE (`name`)
+    );
+
+CREATE TABLE
+    `permissions` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `name` varchar(64) NOT NULL,
+        `description` varchar(255) NOT NULL DEFAULT '',
+        UNIQUE (`name`)
+    );
+
+CREATE TABLE
+    `role_permissions` (
+        `role_id` int NOT NULL,
+        `permission_id` int NOT NULL,
+        PRIMARY KEY (`role_id`, `permission_id`),
+        CONSTRAINT `role_permissions_role_id_fk` FOREIGN KEY (`role_id`)
+            REFERENCES `roles` (`id`) ON DELETE CASCADE,
+        CONSTRAINT `role_permissions_permission_id_fk` FOREIGN KEY (`permission_id`)
+            REFERENCES `permissions` (`id`) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    `user_roles` (
+        `user_id` int NOT NULL,
+        `role_id` int NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        PRIMARY KEY (`user_id`, `role_id`),
+        CONSTRAINT `user_roles_user_id_fk` FOREIGN KEY (`user_id`)
+            REFERENCES `users` (`id`) ON DELETE CASCADE,
+        CONSTRAINT `user_roles_role_id_fk` FOREIGN KEY (`role_id`)
+            REFERENCES `roles` (`id`) ON DELETE CASCADE
+    );
+
+-- the names must match the constants of the rbac package
+INSERT INTO `permissions` (`name`, `description`) VALUES
+    ('products:write', 'Create, update and delete products'),
+    ('orders:read_all', 'List the orders of all users'),
+    ('orders:update_status', 'Change the status of orders'),
+    ('users:read', 'List users'),
+    ('users:delete', 'Delete users'),
+    ('users:unlock', 'Unlock accounts locked after failed logins'),
+    ('users:revoke_sessions', 'Revoke every session of a user'),
+    ('roles:manage', 'List roles and assign them to users'),
+    ('webhooks:manage', 'Manage webhook subscriptions and deliveries');
+
+INSERT INTO `roles` (`name`, `description`) VALUES
+    ('superuser', 'Every permission'),
+    ('warehouse', 'Fulfil the orders of all users');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+    SELECT r.`id`, p.`id` FROM `roles` r CROSS JOIN `permissions` p
+    WHERE r.`name` = 'superuser';
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+    SELECT r.`id`, p.`id` FROM `roles` r JOIN `permissions` p
+        ON p.`name` IN ('orders:read_all', 'orders:update_status')
+    WHERE r.`name` = 'warehouse';
+
+-- admins keep all their rights
+INSERT INTO `user_roles` (`user_id`, `role_id`)
+    SELECT u.`id`, r.`id` FROM `users` u JOIN `roles` r ON r.`name` = 'superuser'
+    WHERE u.`is_admin`;
+
+ALTER TABLE `users`
+    DROP COLUMN `is_admin`;
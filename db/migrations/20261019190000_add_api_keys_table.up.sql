@@ -0,0 +1,24 @@
+CREATE TABLE
+    `api_keys` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `name` varchar(255) NOT NULL,
+        `prefix` varchar(32) NOT NULL,
+        `key_hash` char(64) NOT NULL,
+        `user_id` int NOT NULL,
+        `scopes` varchar(1024) NOT NULL,
+        `created_by` int NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        `expires_at` datetime,
+        `last_used_at` datetime,
+        `revoked_at` datetime,
+        UNIQUE (`prefix`),
+        CONSTRAINT `api_keys_user_id_fk` FOREIGN KEY (`user_id`)
+            REFERENCES `users` (`id`) ON DELETE CASCADE
+    );
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+    ('api_keys:manage', 'Issue, list and revoke API keys');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+    SELECT r.`id`, p.`id` FROM `roles` r JOIN `permissions` p ON p.`name` = 'api_keys:manage'
+    WHERE r.`name` = 'superuser';
@@ -0,0 +1,16 @@
+ALTER TABLE `users`
+    ADD COLUMN `totp_secret` varchar(64),
+    ADD COLUMN `totp_enabled_at` datetime,
+    ADD COLUMN `totp_last_step` bigint;
+
+CREATE TABLE
+    `mfa_recovery_codes` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `user_id` int NOT NULL,
+        `code_hash` char(64) NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        `used_at` datetime,
+        UNIQUE (`user_id`, `code_hash`),
+        CONSTRAINT `mfa_recovery_codes_user_id_fk` FOREIGN KEY (`user_id`)
+            REFERENCES `users` (`id`) ON DELETE CASCADE
+    );
@@ -0,0 +1,12 @@
+CREATE TABLE
+    `user_identities` (
+        `id` int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+        `user_id` int NOT NULL,
+        `provider` varchar(64) NOT NULL,
+        `subject` varchar(255) NOT NULL,
+        `email` varchar(255) NOT NULL,
+        `created_at` datetime DEFAULT (now()),
+        UNIQUE (`provider`, `subject`),
+        CONSTRAINT `user_identities_user_id_fk` FOREIGN KEY (`user_id`)
+            REFERENCES `users` (`id`) ON DELETE CASCADE
+    );
@@ -0,0 +1 @@
+ALTER TABLE `sessions` ADD COLUMN `refresh_token` varchar(512) NOT NULL DEFAULT '' AFTER `user_email`;
@@ -0,0 +1,5 @@
+-- refresh tokens are opaque now and sessions are named after their hash, so
+-- sessions of signed refresh tokens can no longer be renewed
+UPDATE `sessions` SET `is_revoked` = true;
+
+ALTER TABLE `sessions` DROP COLUMN `refresh_token`;
@@ -0,0 +1,6 @@
+INSERT INTO `permissions` (`name`, `description`) VALUES
+    ('api_keys:issue_for_others', 'Issue API keys that act for other users');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+    SELECT r.`id`, p.`id` FROM `roles` r JOIN `permissions` p ON p.`name` = 'api_keys:issue_for_others'
+    WHERE r.`name` = 'superuser';
@@ -0,0 +1,6 @@
+DELETE FROM `idempotency_keys`;
+
+ALTER TABLE `idempotency_keys`
+    DROP PRIMARY KEY,
+    DROP COLUMN `caller`,
+    ADD PRIMARY KEY (`method`, `idempotency_key`);
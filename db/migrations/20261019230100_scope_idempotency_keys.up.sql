@@ -0,0 +1,7 @@
+-- fingerprints were plain hashes of requests that hold passwords
+DELETE FROM `idempotency_keys`;
+
+ALTER TABLE `idempotency_keys`
+    ADD COLUMN `caller` varchar(64) NOT NULL DEFAULT '' AFTER `method`,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (`method`, `caller`, `idempotency_key`);
@@ -0,0 +1,73 @@
+// Package denylist keeps the IDs of tokens that were revoked before they
+// expired, so that they can be rejected although their signature is valid.
+package denylist
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Denylist records revoked token IDs until the tokens expire.
+type Denylist interface {
+	// Deny rejects the token with the given ID until expiresAt.
+	Deny(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsDenied reports whether the token with the given ID was denied.
+	IsDenied(ctx context.Context, jti string) (bool, error)
+}
+
+// sweepEvery is the number of writes after which expired entries are removed
+// from a Memory denylist.
+const sweepEvery = 1024
+
+// Memory is a Denylist kept in the memory of the process. Tokens denied by
+// one process are not rejected by others.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+	writes  int
+	now     func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		entries: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Deny(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if !now.Before(expiresAt) {
+		return nil
+	}
+	if e, ok := m.entries[jti]; !ok || e.Before(expiresAt) {
+		m.entries[jti] = expiresAt
+	}
+
+	m.writes++
+	if m.writes%sweepEvery == 0 {
+		m.sweep(now)
+	}
+
+	return nil
+}
+
+func (m *Memory) IsDenied(ctx context.Context, jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt, ok := m.entries[jti]
+	return ok && m.now().Before(expiresAt), nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	for k, expiresAt := range m.entries {
+		if !now.Before(expiresAt) {
+			delete(m.entries, k)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package denylist
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	denied, err := m.IsDenied(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, denied)
+
+	require.NoError(t, m.Deny(ctx, "a", now.Add(time.Minute)))
+	require.NoError(t, m.Deny(ctx, "expired", now.Add(-time.Minute)))
+
+	denied, err = m.IsDenied(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, denied)
+
+	denied, err = m.IsDenied(ctx, "expired")
+	require.NoError(t, err)
+	require.False(t, denied)
+
+	// denying again never shortens the entry
+	require.NoError(t, m.Deny(ctx, "a", now.Add(time.Second)))
+	now = now.Add(30 * time.Second)
+	denied, err = m.IsDenied(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, denied)
+
+	now = now.Add(time.Minute)
+	denied, err = m.IsDenied(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, denied)
+}
+
+func TestMemorySweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	require.NoError(t, m.Deny(ctx, "old", now.Add(time.Second)))
+	now = now.Add(time.Minute)
+	for i := 0; i < sweepEvery; i++ {
+		require.NoError(t, m.Deny(ctx, fmt.Sprint(i), now.Add(time.Hour)))
+	}
+
+	require.NotContains(t, m.entries, "old")
+	require.Len(t, m.entries, sweepEvery)
+}
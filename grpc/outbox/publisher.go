@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, e *storer.OutboxEvent) error
+}
+
+type HandlerFunc func(ctx context.Context, e *storer.OutboxEvent) error
+
+// InProcessPublisher delivers events synchronously to subscribers living in
+// the same process. Publish fails if any subscriber fails, which makes the
+// relay retry the event for all of them, so subscribers must be idempotent.
+type InProcessPublisher struct {
+	mu          sync.RWMutex
+	subscribers []HandlerFunc
+}
+
+func NewInProcessPublisher() *InProcessPublisher {
+	return &InProcessPublisher{}
+}
+
+func (p *InProcessPublisher) Subscribe(fn HandlerFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.subscribers = append(p.subscribers, fn)
+}
+
+func (p *InProcessPublisher) Publish(ctx context.Context, e *storer.OutboxEvent) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var errs []error
+	for _, fn := range p.subscribers {
+		if err := fn(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// FilePublisher appends every event as a JSON line to a file.
+type FilePublisher struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+type fileEvent struct {
+	ID            int64           `json:"id"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     string          `json:"created_at"`
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening outbox file: %w", err)
+	}
+
+	return &FilePublisher{f: f}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, e *storer.OutboxEvent) error {
+	line, err := json.Marshal(fileEvent{
+		ID:            e.ID,
+		AggregateType: e.AggregateType,
+		AggregateID:   e.AggregateID,
+		EventType:     e.EventType,
+		Payload:       e.Payload,
+		CreatedAt:     e.CreatedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing event: %w", err)
+	}
+
+	return p.f.Sync()
+}
+
+func (p *FilePublisher) Close() error {
+	return p.f.Close()
+}
+
+// MultiPublisher publishes every event to all of its publishers.
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, e *storer.OutboxEvent) error {
+	var errs []error
+	for _, p := range m {
+		if err := p.Publish(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
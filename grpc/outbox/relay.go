@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+)
+
+// Store is the subset of the storer the relay needs. *storer.MySQLStorer
+// satisfies it.
+type Store interface {
+	LockOutboxRelay(ctx context.Context) (unlock func() error, ok bool, err error)
+	ListPendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]*storer.OutboxEvent, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error
+	MarkOutboxEventDead(ctx context.Context, id int64, reason string) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int64
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		BatchSize:    100,
+		MaxAttempts:  10,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   5 * time.Minute,
+	}
+}
+
+// Relay moves events from the outbox table to a Publisher. Delivery is
+// at-least-once: an event is only marked as published after Publish returns
+// without error, so a crash in between results in a redelivery.
+//
+// Events of the same aggregate are published in the order they were written.
+// Once an event of an aggregate fails, the later events of that aggregate are
+// held back until it is either published or dead-lettered.
+//
+// Only one relay works on the outbox at a time: every batch runs under a
+// store-wide lock, and replicas that don't get it skip the batch. Claiming
+// rows with SELECT ... FOR UPDATE SKIP LOCKED would let relays run side by
+// side, but two of them could then publish events of the same aggregate out
+// of order.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	cfg       Config
+	now       func() time.Time
+}
+
+func NewRelay(store Store, publisher Publisher, cfg Config) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+		now:       time.Now,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayBatch(ctx); err != nil {
+			slog.ErrorContext(ctx, "outbox relay failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes one batch of pending events and returns how many were
+// published. It publishes nothing if another relay is working on the outbox.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	unlock, ok, err := r.store.LockOutboxRelay(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, nil
+	}
+	defer func() {
+		if err := unlock(); err != nil {
+			slog.ErrorContext(ctx, "outbox relay failed to unlock", "error", err)
+		}
+	}()
+
+	events, err := r.store.ListPendingOutboxEvents(ctx, r.now(), r.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	blocked := make(map[string]bool)
+	published := 0
+
+	for _, e := range events {
+		key := e.AggregateType + ":" + e.AggregateID
+		if blocked[key] {
+			continue
+		}
+
+		if err := r.publisher.Publish(ctx, e); err != nil {
+			if err := r.fail(ctx, e, err); err != nil {
+				return published, err
+			}
+			blocked[key] = true
+			continue
+		}
+
+		if err := r.store.MarkOutboxEventPublished(ctx, e.ID); err != nil {
+			return published, err
+		}
+		published++
+	}
+
+	return published, nil
+}
+
+func (r *Relay) fail(ctx context.Context, e *storer.OutboxEvent, cause error) error {
+	attempts := e.Attempts + 1
+	if attempts >= r.cfg.MaxAttempts {
+		slog.ErrorContext(ctx, "dead-lettering outbox event", "event_id", e.ID, "event_type", e.EventType, "attempts", attempts, "error", cause)
+		return r.store.MarkOutboxEventDead(ctx, e.ID, cause.Error())
+	}
+
+	retryAt := r.now().Add(r.backoff(attempts))
+	if err := r.store.MarkOutboxEventFailed(ctx, e.ID, cause.Error(), retryAt); err != nil {
+		return fmt.Errorf("error recording failed publish of event %d: %w", e.ID, err)
+	}
+
+	return nil
+}
+
+// backoff doubles the base delay with every attempt, capped at MaxBackoff.
+func (r *Relay) backoff(attempts int64) time.Duration {
+	d := r.cfg.BaseBackoff
+	for i := int64(1); i < attempts; i++ {
+		d *= 2
+		if d >= r.cfg.MaxBackoff {
+			return r.cfg.MaxBackoff
+		}
+	}
+
+	return d
+}
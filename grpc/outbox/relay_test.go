@@ -0,0 +1,140 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	locked    bool
+	events    []*storer.OutboxEvent
+	listedAt  time.Time
+	published []int64
+	failed    []int64
+	dead      []int64
+}
+
+func (s *fakeStore) LockOutboxRelay(ctx context.Context) (func() error, bool, error) {
+	if s.locked {
+		return nil, false, nil
+	}
+	s.locked = true
+
+	return func() error {
+		s.locked = false
+		return nil
+	}, true, nil
+}
+
+func (s *fakeStore) ListPendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]*storer.OutboxEvent, error) {
+	s.listedAt = now
+	return s.events, nil
+}
+
+func (s *fakeStore) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	s.published = append(s.published, id)
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	s.failed = append(s.failed, id)
+	return nil
+}
+
+func (s *fakeStore) MarkOutboxEventDead(ctx context.Context, id int64, reason string) error {
+	s.dead = append(s.dead, id)
+	return nil
+}
+
+func TestRelayBatch(t *testing.T) {
+	now := time.Now()
+	event := func(id int64, aggregateID string, attempts int64, availableAt time.Time) *storer.OutboxEvent {
+		return &storer.OutboxEvent{
+			ID:            id,
+			AggregateType: storer.AggregateOrder,
+			AggregateID:   aggregateID,
+			EventType:     storer.EventOrderCreated,
+			Attempts:      attempts,
+			AvailableAt:   availableAt,
+		}
+	}
+
+	tcs := []struct {
+		name      string
+		events    []*storer.OutboxEvent
+		failIDs   map[int64]bool
+		published []int64
+		failed    []int64
+		dead      []int64
+	}{
+		{
+			name:      "publishes in order",
+			events:    []*storer.OutboxEvent{event(1, "1", 0, now), event(2, "2", 0, now), event(3, "1", 0, now)},
+			published: []int64{1, 2, 3},
+		},
+		{
+			name:      "failure holds back later events of the same aggregate",
+			events:    []*storer.OutboxEvent{event(1, "1", 0, now), event(2, "2", 0, now), event(3, "1", 0, now)},
+			failIDs:   map[int64]bool{1: true},
+			published: []int64{2},
+			failed:    []int64{1},
+		},
+		{
+			name:    "dead-lettered after max attempts",
+			events:  []*storer.OutboxEvent{event(1, "1", 2, now), event(2, "1", 0, now)},
+			failIDs: map[int64]bool{1: true},
+			dead:    []int64{1},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			st := &fakeStore{events: tc.events}
+			pub := NewInProcessPublisher()
+			pub.Subscribe(func(ctx context.Context, e *storer.OutboxEvent) error {
+				if tc.failIDs[e.ID] {
+					return fmt.Errorf("failed publishing event %d", e.ID)
+				}
+				return nil
+			})
+
+			cfg := DefaultConfig()
+			cfg.MaxAttempts = 3
+			r := NewRelay(st, pub, cfg)
+			r.now = func() time.Time { return now }
+
+			n, err := r.RelayBatch(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, len(tc.published), n)
+			require.Equal(t, tc.published, st.published)
+			require.Equal(t, tc.failed, st.failed)
+			require.Equal(t, tc.dead, st.dead)
+			require.Equal(t, now, st.listedAt)
+			require.False(t, st.locked)
+		})
+	}
+
+	t.Run("skips the batch while another relay holds the lock", func(t *testing.T) {
+		st := &fakeStore{locked: true, events: []*storer.OutboxEvent{event(1, "1", 0, now)}}
+		r := NewRelay(st, NewInProcessPublisher(), DefaultConfig())
+
+		n, err := r.RelayBatch(context.Background())
+		require.NoError(t, err)
+		require.Zero(t, n)
+		require.Empty(t, st.published)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	r := NewRelay(nil, nil, Config{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	require.Equal(t, time.Second, r.backoff(1))
+	require.Equal(t, 2*time.Second, r.backoff(2))
+	require.Equal(t, 8*time.Second, r.backoff(4))
+	require.Equal(t, 10*time.Second, r.backoff(5))
+}
@@ -19,25 +19,48 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	GolangMicroservice_CreateProduct_FullMethodName     = "/pb.golang_microservice/CreateProduct"
-	GolangMicroservice_GetProduct_FullMethodName        = "/pb.golang_microservice/GetProduct"
-	GolangMicroservice_GetAllProducts_FullMethodName    = "/pb.golang_microservice/GetAllProducts"
-	GolangMicroservice_UpdateProduct_FullMethodName     = "/pb.golang_microservice/UpdateProduct"
-	GolangMicroservice_DeleteProduct_FullMethodName     = "/pb.golang_microservice/DeleteProduct"
-	GolangMicroservice_CreateOrder_FullMethodName       = "/pb.golang_microservice/CreateOrder"
-	GolangMicroservice_GetOrder_FullMethodName          = "/pb.golang_microservice/GetOrder"
-	GolangMicroservice_GetAllOrders_FullMethodName      = "/pb.golang_microservice/GetAllOrders"
-	GolangMicroservice_UpdateOrderStatus_FullMethodName = "/pb.golang_microservice/UpdateOrderStatus"
-	GolangMicroservice_DeleteOrder_FullMethodName       = "/pb.golang_microservice/DeleteOrder"
-	GolangMicroservice_CreateUser_FullMethodName        = "/pb.golang_microservice/CreateUser"
-	GolangMicroservice_GetUser_FullMethodName           = "/pb.golang_microservice/GetUser"
-	GolangMicroservice_GetAllUsers_FullMethodName       = "/pb.golang_microservice/GetAllUsers"
-	GolangMicroservice_UpdateUser_FullMethodName        = "/pb.golang_microservice/UpdateUser"
-	GolangMicroservice_DeleteUser_FullMethodName        = "/pb.golang_microservice/DeleteUser"
-	GolangMicroservice_CreateSession_FullMethodName     = "/pb.golang_microservice/CreateSession"
-	GolangMicroservice_GetSession_FullMethodName        = "/pb.golang_microservice/GetSession"
-	GolangMicroservice_RevokeSession_FullMethodName     = "/pb.golang_microservice/RevokeSession"
-	GolangMicroservice_DeleteSession_FullMethodName     = "/pb.golang_microservice/DeleteSession"
+	GolangMicroservice_CreateProduct_FullMethodName           = "/pb.golang_microservice/CreateProduct"
+	GolangMicroservice_GetProduct_FullMethodName              = "/pb.golang_microservice/GetProduct"
+	GolangMicroservice_GetAllProducts_FullMethodName          = "/pb.golang_microservice/GetAllProducts"
+	GolangMicroservice_UpdateProduct_FullMethodName           = "/pb.golang_microservice/UpdateProduct"
+	GolangMicroservice_DeleteProduct_FullMethodName           = "/pb.golang_microservice/DeleteProduct"
+	GolangMicroservice_CreateOrder_FullMethodName             = "/pb.golang_microservice/CreateOrder"
+	GolangMicroservice_GetOrder_FullMethodName                = "/pb.golang_microservice/GetOrder"
+	GolangMicroservice_GetAllOrders_FullMethodName            = "/pb.golang_microservice/GetAllOrders"
+	GolangMicroservice_UpdateOrderStatus_FullMethodName       = "/pb.golang_microservice/UpdateOrderStatus"
+	GolangMicroservice_DeleteOrder_FullMethodName             = "/pb.golang_microservice/DeleteOrder"
+	GolangMicroservice_CreateUser_FullMethodName              = "/pb.golang_microservice/CreateUser"
+	GolangMicroservice_GetUser_FullMethodName                 = "/pb.golang_microservice/GetUser"
+	GolangMicroservice_GetAllUsers_FullMethodName             = "/pb.golang_microservice/GetAllUsers"
+	GolangMicroservice_UpdateUser_FullMethodName              = "/pb.golang_microservice/UpdateUser"
+	GolangMicroservice_DeleteUser_FullMethodName              = "/pb.golang_microservice/DeleteUser"
+	GolangMicroservice_UnlockUser_FullMethodName              = "/pb.golang_microservice/UnlockUser"
+	GolangMicroservice_SetUserRoles_FullMethodName            = "/pb.golang_microservice/SetUserRoles"
+	GolangMicroservice_ListRoles_FullMethodName               = "/pb.golang_microservice/ListRoles"
+	GolangMicroservice_CreateAPIKey_FullMethodName            = "/pb.golang_microservice/CreateAPIKey"
+	GolangMicroservice_ListAPIKeys_FullMethodName             = "/pb.golang_microservice/ListAPIKeys"
+	GolangMicroservice_RevokeAPIKey_FullMethodName            = "/pb.golang_microservice/RevokeAPIKey"
+	GolangMicroservice_AuthenticateAPIKey_FullMethodName      = "/pb.golang_microservice/AuthenticateAPIKey"
+	GolangMicroservice_EnrollTOTP_FullMethodName              = "/pb.golang_microservice/EnrollTOTP"
+	GolangMicroservice_ConfirmTOTP_FullMethodName             = "/pb.golang_microservice/ConfirmTOTP"
+	GolangMicroservice_DisableTOTP_FullMethodName             = "/pb.golang_microservice/DisableTOTP"
+	GolangMicroservice_RequestPasswordReset_FullMethodName    = "/pb.golang_microservice/RequestPasswordReset"
+	GolangMicroservice_ResetPassword_FullMethodName           = "/pb.golang_microservice/ResetPassword"
+	GolangMicroservice_VerifyEmail_FullMethodName             = "/pb.golang_microservice/VerifyEmail"
+	GolangMicroservice_ResendVerificationEmail_FullMethodName = "/pb.golang_microservice/ResendVerificationEmail"
+	GolangMicroservice_ListSessions_FullMethodName            = "/pb.golang_microservice/ListSessions"
+	GolangMicroservice_RevokeMySession_FullMethodName         = "/pb.golang_microservice/RevokeMySession"
+	GolangMicroservice_RevokeMyOtherSessions_FullMethodName   = "/pb.golang_microservice/RevokeMyOtherSessions"
+	GolangMicroservice_RevokeUserSessions_FullMethodName      = "/pb.golang_microservice/RevokeUserSessions"
+	GolangMicroservice_DenyToken_FullMethodName               = "/pb.golang_microservice/DenyToken"
+	GolangMicroservice_IsTokenDenied_FullMethodName           = "/pb.golang_microservice/IsTokenDenied"
+	GolangMicroservice_CreateWebhook_FullMethodName           = "/pb.golang_microservice/CreateWebhook"
+	GolangMicroservice_GetWebhook_FullMethodName              = "/pb.golang_microservice/GetWebhook"
+	GolangMicroservice_GetAllWebhooks_FullMethodName          = "/pb.golang_microservice/GetAllWebhooks"
+	GolangMicroservice_UpdateWebhook_FullMethodName           = "/pb.golang_microservice/UpdateWebhook"
+	GolangMicroservice_DeleteWebhook_FullMethodName           = "/pb.golang_microservice/DeleteWebhook"
+	GolangMicroservice_GetAllWebhookDeliveries_FullMethodName = "/pb.golang_microservice/GetAllWebhookDeliveries"
+	GolangMicroservice_RedeliverWebhook_FullMethodName        = "/pb.golang_microservice/RedeliverWebhook"
 )
 
 // GolangMicroserviceClient is the client API for GolangMicroservice service.
@@ -59,10 +82,33 @@ type GolangMicroserviceClient interface {
 	GetAllUsers(ctx context.Context, in *UserReq, opts ...grpc.CallOption) (*ListUserRes, error)
 	UpdateUser(ctx context.Context, in *UserReq, opts ...grpc.CallOption) (*UserRes, error)
 	DeleteUser(ctx context.Context, in *UserReq, opts ...grpc.CallOption) (*UserRes, error)
-	CreateSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error)
-	GetSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error)
-	RevokeSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error)
-	DeleteSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error)
+	UnlockUser(ctx context.Context, in *UserReq, opts ...grpc.CallOption) (*UserRes, error)
+	SetUserRoles(ctx context.Context, in *UserRolesReq, opts ...grpc.CallOption) (*UserRes, error)
+	ListRoles(ctx context.Context, in *ListRolesReq, opts ...grpc.CallOption) (*ListRolesRes, error)
+	CreateAPIKey(ctx context.Context, in *APIKeyReq, opts ...grpc.CallOption) (*APIKeyRes, error)
+	ListAPIKeys(ctx context.Context, in *ListAPIKeysReq, opts ...grpc.CallOption) (*ListAPIKeysRes, error)
+	RevokeAPIKey(ctx context.Context, in *APIKeyReq, opts ...grpc.CallOption) (*APIKeyRes, error)
+	AuthenticateAPIKey(ctx context.Context, in *AuthenticateAPIKeyReq, opts ...grpc.CallOption) (*AuthenticateAPIKeyRes, error)
+	EnrollTOTP(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*TOTPEnrollmentRes, error)
+	ConfirmTOTP(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*TOTPRecoveryCodesRes, error)
+	DisableTOTP(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*UserRes, error)
+	RequestPasswordReset(ctx context.Context, in *PasswordResetReq, opts ...grpc.CallOption) (*PasswordResetRes, error)
+	ResetPassword(ctx context.Context, in *PasswordResetReq, opts ...grpc.CallOption) (*PasswordResetRes, error)
+	VerifyEmail(ctx context.Context, in *EmailVerificationReq, opts ...grpc.CallOption) (*UserRes, error)
+	ResendVerificationEmail(ctx context.Context, in *EmailVerificationReq, opts ...grpc.CallOption) (*UserRes, error)
+	ListSessions(ctx context.Context, in *ListSessionsReq, opts ...grpc.CallOption) (*ListSessionsRes, error)
+	RevokeMySession(ctx context.Context, in *RevokeSessionsReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error)
+	RevokeMyOtherSessions(ctx context.Context, in *RevokeSessionsReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error)
+	RevokeUserSessions(ctx context.Context, in *RevokeSessionsReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error)
+	DenyToken(ctx context.Context, in *DeniedTokenReq, opts ...grpc.CallOption) (*DeniedTokenRes, error)
+	IsTokenDenied(ctx context.Context, in *DeniedTokenReq, opts ...grpc.CallOption) (*DeniedTokenRes, error)
+	CreateWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error)
+	GetWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error)
+	GetAllWebhooks(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*ListWebhookRes, error)
+	UpdateWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error)
+	DeleteWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error)
+	GetAllWebhookDeliveries(ctx context.Context, in *WebhookDeliveryReq, opts ...grpc.CallOption) (*ListWebhookDeliveryRes, error)
+	RedeliverWebhook(ctx context.Context, in *WebhookDeliveryReq, opts ...grpc.CallOption) (*WebhookDeliveryRes, error)
 }
 
 type golangMicroserviceClient struct {
@@ -223,40 +269,270 @@ func (c *golangMicroserviceClient) DeleteUser(ctx context.Context, in *UserReq,
 	return out, nil
 }
 
-func (c *golangMicroserviceClient) CreateSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error) {
+func (c *golangMicroserviceClient) UnlockUser(ctx context.Context, in *UserReq, opts ...grpc.CallOption) (*UserRes, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(SessionRes)
-	err := c.cc.Invoke(ctx, GolangMicroservice_CreateSession_FullMethodName, in, out, cOpts...)
+	out := new(UserRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_UnlockUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) SetUserRoles(ctx context.Context, in *UserRolesReq, opts ...grpc.CallOption) (*UserRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_SetUserRoles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) ListRoles(ctx context.Context, in *ListRolesReq, opts ...grpc.CallOption) (*ListRolesRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRolesRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_ListRoles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) CreateAPIKey(ctx context.Context, in *APIKeyReq, opts ...grpc.CallOption) (*APIKeyRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(APIKeyRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_CreateAPIKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) ListAPIKeys(ctx context.Context, in *ListAPIKeysReq, opts ...grpc.CallOption) (*ListAPIKeysRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAPIKeysRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_ListAPIKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) RevokeAPIKey(ctx context.Context, in *APIKeyReq, opts ...grpc.CallOption) (*APIKeyRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(APIKeyRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_RevokeAPIKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) AuthenticateAPIKey(ctx context.Context, in *AuthenticateAPIKeyReq, opts ...grpc.CallOption) (*AuthenticateAPIKeyRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthenticateAPIKeyRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_AuthenticateAPIKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) EnrollTOTP(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*TOTPEnrollmentRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TOTPEnrollmentRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_EnrollTOTP_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) ConfirmTOTP(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*TOTPRecoveryCodesRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TOTPRecoveryCodesRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_ConfirmTOTP_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) DisableTOTP(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*UserRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_DisableTOTP_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) RequestPasswordReset(ctx context.Context, in *PasswordResetReq, opts ...grpc.CallOption) (*PasswordResetRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PasswordResetRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_RequestPasswordReset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) ResetPassword(ctx context.Context, in *PasswordResetReq, opts ...grpc.CallOption) (*PasswordResetRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PasswordResetRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_ResetPassword_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) VerifyEmail(ctx context.Context, in *EmailVerificationReq, opts ...grpc.CallOption) (*UserRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_VerifyEmail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) ResendVerificationEmail(ctx context.Context, in *EmailVerificationReq, opts ...grpc.CallOption) (*UserRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UserRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_ResendVerificationEmail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) ListSessions(ctx context.Context, in *ListSessionsReq, opts ...grpc.CallOption) (*ListSessionsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSessionsRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_ListSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) RevokeMySession(ctx context.Context, in *RevokeSessionsReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeSessionsRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_RevokeMySession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) RevokeMyOtherSessions(ctx context.Context, in *RevokeSessionsReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeSessionsRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_RevokeMyOtherSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) RevokeUserSessions(ctx context.Context, in *RevokeSessionsReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeSessionsRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_RevokeUserSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) DenyToken(ctx context.Context, in *DeniedTokenReq, opts ...grpc.CallOption) (*DeniedTokenRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeniedTokenRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_DenyToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) IsTokenDenied(ctx context.Context, in *DeniedTokenReq, opts ...grpc.CallOption) (*DeniedTokenRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeniedTokenRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_IsTokenDenied_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) CreateWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WebhookRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_CreateWebhook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) GetWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WebhookRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_GetWebhook_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) GetAllWebhooks(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*ListWebhookRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListWebhookRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_GetAllWebhooks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golangMicroserviceClient) UpdateWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WebhookRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_UpdateWebhook_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *golangMicroserviceClient) GetSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error) {
+func (c *golangMicroserviceClient) DeleteWebhook(ctx context.Context, in *WebhookReq, opts ...grpc.CallOption) (*WebhookRes, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(SessionRes)
-	err := c.cc.Invoke(ctx, GolangMicroservice_GetSession_FullMethodName, in, out, cOpts...)
+	out := new(WebhookRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_DeleteWebhook_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *golangMicroserviceClient) RevokeSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error) {
+func (c *golangMicroserviceClient) GetAllWebhookDeliveries(ctx context.Context, in *WebhookDeliveryReq, opts ...grpc.CallOption) (*ListWebhookDeliveryRes, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(SessionRes)
-	err := c.cc.Invoke(ctx, GolangMicroservice_RevokeSession_FullMethodName, in, out, cOpts...)
+	out := new(ListWebhookDeliveryRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_GetAllWebhookDeliveries_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *golangMicroserviceClient) DeleteSession(ctx context.Context, in *SessionReq, opts ...grpc.CallOption) (*SessionRes, error) {
+func (c *golangMicroserviceClient) RedeliverWebhook(ctx context.Context, in *WebhookDeliveryReq, opts ...grpc.CallOption) (*WebhookDeliveryRes, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(SessionRes)
-	err := c.cc.Invoke(ctx, GolangMicroservice_DeleteSession_FullMethodName, in, out, cOpts...)
+	out := new(WebhookDeliveryRes)
+	err := c.cc.Invoke(ctx, GolangMicroservice_RedeliverWebhook_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -282,10 +558,33 @@ type GolangMicroserviceServer interface {
 	GetAllUsers(context.Context, *UserReq) (*ListUserRes, error)
 	UpdateUser(context.Context, *UserReq) (*UserRes, error)
 	DeleteUser(context.Context, *UserReq) (*UserRes, error)
-	CreateSession(context.Context, *SessionReq) (*SessionRes, error)
-	GetSession(context.Context, *SessionReq) (*SessionRes, error)
-	RevokeSession(context.Context, *SessionReq) (*SessionRes, error)
-	DeleteSession(context.Context, *SessionReq) (*SessionRes, error)
+	UnlockUser(context.Context, *UserReq) (*UserRes, error)
+	SetUserRoles(context.Context, *UserRolesReq) (*UserRes, error)
+	ListRoles(context.Context, *ListRolesReq) (*ListRolesRes, error)
+	CreateAPIKey(context.Context, *APIKeyReq) (*APIKeyRes, error)
+	ListAPIKeys(context.Context, *ListAPIKeysReq) (*ListAPIKeysRes, error)
+	RevokeAPIKey(context.Context, *APIKeyReq) (*APIKeyRes, error)
+	AuthenticateAPIKey(context.Context, *AuthenticateAPIKeyReq) (*AuthenticateAPIKeyRes, error)
+	EnrollTOTP(context.Context, *TOTPReq) (*TOTPEnrollmentRes, error)
+	ConfirmTOTP(context.Context, *TOTPReq) (*TOTPRecoveryCodesRes, error)
+	DisableTOTP(context.Context, *TOTPReq) (*UserRes, error)
+	RequestPasswordReset(context.Context, *PasswordResetReq) (*PasswordResetRes, error)
+	ResetPassword(context.Context, *PasswordResetReq) (*PasswordResetRes, error)
+	VerifyEmail(context.Context, *EmailVerificationReq) (*UserRes, error)
+	ResendVerificationEmail(context.Context, *EmailVerificationReq) (*UserRes, error)
+	ListSessions(context.Context, *ListSessionsReq) (*ListSessionsRes, error)
+	RevokeMySession(context.Context, *RevokeSessionsReq) (*RevokeSessionsRes, error)
+	RevokeMyOtherSessions(context.Context, *RevokeSessionsReq) (*RevokeSessionsRes, error)
+	RevokeUserSessions(context.Context, *RevokeSessionsReq) (*RevokeSessionsRes, error)
+	DenyToken(context.Context, *DeniedTokenReq) (*DeniedTokenRes, error)
+	IsTokenDenied(context.Context, *DeniedTokenReq) (*DeniedTokenRes, error)
+	CreateWebhook(context.Context, *WebhookReq) (*WebhookRes, error)
+	GetWebhook(context.Context, *WebhookReq) (*WebhookRes, error)
+	GetAllWebhooks(context.Context, *WebhookReq) (*ListWebhookRes, error)
+	UpdateWebhook(context.Context, *WebhookReq) (*WebhookRes, error)
+	DeleteWebhook(context.Context, *WebhookReq) (*WebhookRes, error)
+	GetAllWebhookDeliveries(context.Context, *WebhookDeliveryReq) (*ListWebhookDeliveryRes, error)
+	RedeliverWebhook(context.Context, *WebhookDeliveryReq) (*WebhookDeliveryRes, error)
 	mustEmbedUnimplementedGolangMicroserviceServer()
 }
 
@@ -341,17 +640,86 @@ func (UnimplementedGolangMicroserviceServer) UpdateUser(context.Context, *UserRe
 func (UnimplementedGolangMicroserviceServer) DeleteUser(context.Context, *UserReq) (*UserRes, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
 }
-func (UnimplementedGolangMicroserviceServer) CreateSession(context.Context, *SessionReq) (*SessionRes, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method CreateSession not implemented")
+func (UnimplementedGolangMicroserviceServer) UnlockUser(context.Context, *UserReq) (*UserRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnlockUser not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) SetUserRoles(context.Context, *UserRolesReq) (*UserRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetUserRoles not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) ListRoles(context.Context, *ListRolesReq) (*ListRolesRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRoles not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) CreateAPIKey(context.Context, *APIKeyReq) (*APIKeyRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAPIKey not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) ListAPIKeys(context.Context, *ListAPIKeysReq) (*ListAPIKeysRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAPIKeys not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) RevokeAPIKey(context.Context, *APIKeyReq) (*APIKeyRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeAPIKey not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) AuthenticateAPIKey(context.Context, *AuthenticateAPIKeyReq) (*AuthenticateAPIKeyRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthenticateAPIKey not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) EnrollTOTP(context.Context, *TOTPReq) (*TOTPEnrollmentRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnrollTOTP not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) ConfirmTOTP(context.Context, *TOTPReq) (*TOTPRecoveryCodesRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfirmTOTP not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) DisableTOTP(context.Context, *TOTPReq) (*UserRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DisableTOTP not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) RequestPasswordReset(context.Context, *PasswordResetReq) (*PasswordResetRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RequestPasswordReset not implemented")
 }
-func (UnimplementedGolangMicroserviceServer) GetSession(context.Context, *SessionReq) (*SessionRes, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method GetSession not implemented")
+func (UnimplementedGolangMicroserviceServer) ResetPassword(context.Context, *PasswordResetReq) (*PasswordResetRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetPassword not implemented")
 }
-func (UnimplementedGolangMicroserviceServer) RevokeSession(context.Context, *SessionReq) (*SessionRes, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method RevokeSession not implemented")
+func (UnimplementedGolangMicroserviceServer) VerifyEmail(context.Context, *EmailVerificationReq) (*UserRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyEmail not implemented")
 }
-func (UnimplementedGolangMicroserviceServer) DeleteSession(context.Context, *SessionReq) (*SessionRes, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method DeleteSession not implemented")
+func (UnimplementedGolangMicroserviceServer) ResendVerificationEmail(context.Context, *EmailVerificationReq) (*UserRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResendVerificationEmail not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) ListSessions(context.Context, *ListSessionsReq) (*ListSessionsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) RevokeMySession(context.Context, *RevokeSessionsReq) (*RevokeSessionsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeMySession not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) RevokeMyOtherSessions(context.Context, *RevokeSessionsReq) (*RevokeSessionsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeMyOtherSessions not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) RevokeUserSessions(context.Context, *RevokeSessionsReq) (*RevokeSessionsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeUserSessions not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) DenyToken(context.Context, *DeniedTokenReq) (*DeniedTokenRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DenyToken not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) IsTokenDenied(context.Context, *DeniedTokenReq) (*DeniedTokenRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IsTokenDenied not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) CreateWebhook(context.Context, *WebhookReq) (*WebhookRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateWebhook not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) GetWebhook(context.Context, *WebhookReq) (*WebhookRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetWebhook not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) GetAllWebhooks(context.Context, *WebhookReq) (*ListWebhookRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllWebhooks not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) UpdateWebhook(context.Context, *WebhookReq) (*WebhookRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateWebhook not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) DeleteWebhook(context.Context, *WebhookReq) (*WebhookRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteWebhook not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) GetAllWebhookDeliveries(context.Context, *WebhookDeliveryReq) (*ListWebhookDeliveryRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllWebhookDeliveries not implemented")
+}
+func (UnimplementedGolangMicroserviceServer) RedeliverWebhook(context.Context, *WebhookDeliveryReq) (*WebhookDeliveryRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RedeliverWebhook not implemented")
 }
 func (UnimplementedGolangMicroserviceServer) mustEmbedUnimplementedGolangMicroserviceServer() {}
 func (UnimplementedGolangMicroserviceServer) testEmbeddedByValue()                            {}
@@ -644,160 +1012,958 @@ func _GolangMicroservice_DeleteUser_Handler(srv interface{}, ctx context.Context
 	return interceptor(ctx, in, info, handler)
 }
 
-func _GolangMicroservice_CreateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(SessionReq)
+func _GolangMicroservice_UnlockUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserReq)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GolangMicroserviceServer).CreateSession(ctx, in)
+		return srv.(GolangMicroserviceServer).UnlockUser(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: GolangMicroservice_CreateSession_FullMethodName,
+		FullMethod: GolangMicroservice_UnlockUser_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GolangMicroserviceServer).CreateSession(ctx, req.(*SessionReq))
+		return srv.(GolangMicroserviceServer).UnlockUser(ctx, req.(*UserReq))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _GolangMicroservice_GetSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(SessionReq)
+func _GolangMicroservice_SetUserRoles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRolesReq)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GolangMicroserviceServer).GetSession(ctx, in)
+		return srv.(GolangMicroserviceServer).SetUserRoles(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: GolangMicroservice_GetSession_FullMethodName,
+		FullMethod: GolangMicroservice_SetUserRoles_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GolangMicroserviceServer).GetSession(ctx, req.(*SessionReq))
+		return srv.(GolangMicroserviceServer).SetUserRoles(ctx, req.(*UserRolesReq))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _GolangMicroservice_RevokeSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(SessionReq)
+func _GolangMicroservice_ListRoles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRolesReq)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GolangMicroserviceServer).RevokeSession(ctx, in)
+		return srv.(GolangMicroserviceServer).ListRoles(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: GolangMicroservice_RevokeSession_FullMethodName,
+		FullMethod: GolangMicroservice_ListRoles_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GolangMicroserviceServer).RevokeSession(ctx, req.(*SessionReq))
+		return srv.(GolangMicroserviceServer).ListRoles(ctx, req.(*ListRolesReq))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _GolangMicroservice_DeleteSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(SessionReq)
+func _GolangMicroservice_CreateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyReq)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GolangMicroserviceServer).DeleteSession(ctx, in)
+		return srv.(GolangMicroserviceServer).CreateAPIKey(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: GolangMicroservice_DeleteSession_FullMethodName,
+		FullMethod: GolangMicroservice_CreateAPIKey_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GolangMicroserviceServer).DeleteSession(ctx, req.(*SessionReq))
+		return srv.(GolangMicroserviceServer).CreateAPIKey(ctx, req.(*APIKeyReq))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-// GolangMicroservice_ServiceDesc is the grpc.ServiceDesc for GolangMicroservice service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var GolangMicroservice_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "pb.golang_microservice",
-	HandlerType: (*GolangMicroserviceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "CreateProduct",
-			Handler:    _GolangMicroservice_CreateProduct_Handler,
-		},
-		{
-			MethodName: "GetProduct",
-			Handler:    _GolangMicroservice_GetProduct_Handler,
-		},
-		{
-			MethodName: "GetAllProducts",
-			Handler:    _GolangMicroservice_GetAllProducts_Handler,
-		},
-		{
-			MethodName: "UpdateProduct",
-			Handler:    _GolangMicroservice_UpdateProduct_Handler,
-		},
-		{
-			MethodName: "DeleteProduct",
-			Handler:    _GolangMicroservice_DeleteProduct_Handler,
-		},
-		{
-			MethodName: "CreateOrder",
-			Handler:    _GolangMicroservice_CreateOrder_Handler,
-		},
-		{
-			MethodName: "GetOrder",
-			Handler:    _GolangMicroservice_GetOrder_Handler,
-		},
-		{
-			MethodName: "GetAllOrders",
-			Handler:    _GolangMicroservice_GetAllOrders_Handler,
-		},
-		{
-			MethodName: "UpdateOrderStatus",
-			Handler:    _GolangMicroservice_UpdateOrderStatus_Handler,
-		},
-		{
-			MethodName: "DeleteOrder",
-			Handler:    _GolangMicroservice_DeleteOrder_Handler,
-		},
-		{
-			MethodName: "CreateUser",
-			Handler:    _GolangMicroservice_CreateUser_Handler,
-		},
-		{
-			MethodName: "GetUser",
-			Handler:    _GolangMicroservice_GetUser_Handler,
-		},
-		{
-			MethodName: "GetAllUsers",
-			Handler:    _GolangMicroservice_GetAllUsers_Handler,
-		},
-		{
-			MethodName: "UpdateUser",
-			Handler:    _GolangMicroservice_UpdateUser_Handler,
-		},
-		{
-			MethodName: "DeleteUser",
-			Handler:    _GolangMicroservice_DeleteUser_Handler,
+func _GolangMicroservice_ListAPIKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAPIKeysReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).ListAPIKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_ListAPIKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).ListAPIKeys(ctx, req.(*ListAPIKeysReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_RevokeAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(APIKeyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).RevokeAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_RevokeAPIKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).RevokeAPIKey(ctx, req.(*APIKeyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_AuthenticateAPIKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthenticateAPIKeyReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).AuthenticateAPIKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_AuthenticateAPIKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).AuthenticateAPIKey(ctx, req.(*AuthenticateAPIKeyReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_EnrollTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TOTPReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).EnrollTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_EnrollTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).EnrollTOTP(ctx, req.(*TOTPReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_ConfirmTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TOTPReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).ConfirmTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_ConfirmTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).ConfirmTOTP(ctx, req.(*TOTPReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_DisableTOTP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TOTPReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).DisableTOTP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_DisableTOTP_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).DisableTOTP(ctx, req.(*TOTPReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_RequestPasswordReset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordResetReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).RequestPasswordReset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_RequestPasswordReset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).RequestPasswordReset(ctx, req.(*PasswordResetReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_ResetPassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PasswordResetReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).ResetPassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_ResetPassword_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).ResetPassword(ctx, req.(*PasswordResetReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_VerifyEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailVerificationReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).VerifyEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_VerifyEmail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).VerifyEmail(ctx, req.(*EmailVerificationReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_ResendVerificationEmail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmailVerificationReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).ResendVerificationEmail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_ResendVerificationEmail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).ResendVerificationEmail(ctx, req.(*EmailVerificationReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSessionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).ListSessions(ctx, req.(*ListSessionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_RevokeMySession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeSessionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).RevokeMySession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_RevokeMySession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).RevokeMySession(ctx, req.(*RevokeSessionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_RevokeMyOtherSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeSessionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).RevokeMyOtherSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_RevokeMyOtherSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).RevokeMyOtherSessions(ctx, req.(*RevokeSessionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_RevokeUserSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeSessionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).RevokeUserSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_RevokeUserSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).RevokeUserSessions(ctx, req.(*RevokeSessionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_DenyToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeniedTokenReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).DenyToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_DenyToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).DenyToken(ctx, req.(*DeniedTokenReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_IsTokenDenied_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeniedTokenReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).IsTokenDenied(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_IsTokenDenied_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).IsTokenDenied(ctx, req.(*DeniedTokenReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_CreateWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).CreateWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_CreateWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).CreateWebhook(ctx, req.(*WebhookReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_GetWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).GetWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_GetWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).GetWebhook(ctx, req.(*WebhookReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_GetAllWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).GetAllWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_GetAllWebhooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).GetAllWebhooks(ctx, req.(*WebhookReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_UpdateWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).UpdateWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_UpdateWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).UpdateWebhook(ctx, req.(*WebhookReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_DeleteWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).DeleteWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_DeleteWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).DeleteWebhook(ctx, req.(*WebhookReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_GetAllWebhookDeliveries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookDeliveryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).GetAllWebhookDeliveries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_GetAllWebhookDeliveries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).GetAllWebhookDeliveries(ctx, req.(*WebhookDeliveryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolangMicroservice_RedeliverWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WebhookDeliveryReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolangMicroserviceServer).RedeliverWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolangMicroservice_RedeliverWebhook_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolangMicroserviceServer).RedeliverWebhook(ctx, req.(*WebhookDeliveryReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GolangMicroservice_ServiceDesc is the grpc.ServiceDesc for GolangMicroservice service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GolangMicroservice_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.golang_microservice",
+	HandlerType: (*GolangMicroserviceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateProduct",
+			Handler:    _GolangMicroservice_CreateProduct_Handler,
+		},
+		{
+			MethodName: "GetProduct",
+			Handler:    _GolangMicroservice_GetProduct_Handler,
+		},
+		{
+			MethodName: "GetAllProducts",
+			Handler:    _GolangMicroservice_GetAllProducts_Handler,
+		},
+		{
+			MethodName: "UpdateProduct",
+			Handler:    _GolangMicroservice_UpdateProduct_Handler,
+		},
+		{
+			MethodName: "DeleteProduct",
+			Handler:    _GolangMicroservice_DeleteProduct_Handler,
+		},
+		{
+			MethodName: "CreateOrder",
+			Handler:    _GolangMicroservice_CreateOrder_Handler,
+		},
+		{
+			MethodName: "GetOrder",
+			Handler:    _GolangMicroservice_GetOrder_Handler,
+		},
+		{
+			MethodName: "GetAllOrders",
+			Handler:    _GolangMicroservice_GetAllOrders_Handler,
+		},
+		{
+			MethodName: "UpdateOrderStatus",
+			Handler:    _GolangMicroservice_UpdateOrderStatus_Handler,
+		},
+		{
+			MethodName: "DeleteOrder",
+			Handler:    _GolangMicroservice_DeleteOrder_Handler,
+		},
+		{
+			MethodName: "CreateUser",
+			Handler:    _GolangMicroservice_CreateUser_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _GolangMicroservice_GetUser_Handler,
+		},
+		{
+			MethodName: "GetAllUsers",
+			Handler:    _GolangMicroservice_GetAllUsers_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _GolangMicroservice_UpdateUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _GolangMicroservice_DeleteUser_Handler,
+		},
+		{
+			MethodName: "UnlockUser",
+			Handler:    _GolangMicroservice_UnlockUser_Handler,
+		},
+		{
+			MethodName: "SetUserRoles",
+			Handler:    _GolangMicroservice_SetUserRoles_Handler,
+		},
+		{
+			MethodName: "ListRoles",
+			Handler:    _GolangMicroservice_ListRoles_Handler,
+		},
+		{
+			MethodName: "CreateAPIKey",
+			Handler:    _GolangMicroservice_CreateAPIKey_Handler,
+		},
+		{
+			MethodName: "ListAPIKeys",
+			Handler:    _GolangMicroservice_ListAPIKeys_Handler,
+		},
+		{
+			MethodName: "RevokeAPIKey",
+			Handler:    _GolangMicroservice_RevokeAPIKey_Handler,
+		},
+		{
+			MethodName: "AuthenticateAPIKey",
+			Handler:    _GolangMicroservice_AuthenticateAPIKey_Handler,
+		},
+		{
+			MethodName: "EnrollTOTP",
+			Handler:    _GolangMicroservice_EnrollTOTP_Handler,
+		},
+		{
+			MethodName: "ConfirmTOTP",
+			Handler:    _GolangMicroservice_ConfirmTOTP_Handler,
+		},
+		{
+			MethodName: "DisableTOTP",
+			Handler:    _GolangMicroservice_DisableTOTP_Handler,
+		},
+		{
+			MethodName: "RequestPasswordReset",
+			Handler:    _GolangMicroservice_RequestPasswordReset_Handler,
+		},
+		{
+			MethodName: "ResetPassword",
+			Handler:    _GolangMicroservice_ResetPassword_Handler,
+		},
+		{
+			MethodName: "VerifyEmail",
+			Handler:    _GolangMicroservice_VerifyEmail_Handler,
+		},
+		{
+			MethodName: "ResendVerificationEmail",
+			Handler:    _GolangMicroservice_ResendVerificationEmail_Handler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    _GolangMicroservice_ListSessions_Handler,
+		},
+		{
+			MethodName: "RevokeMySession",
+			Handler:    _GolangMicroservice_RevokeMySession_Handler,
+		},
+		{
+			MethodName: "RevokeMyOtherSessions",
+			Handler:    _GolangMicroservice_RevokeMyOtherSessions_Handler,
+		},
+		{
+			MethodName: "RevokeUserSessions",
+			Handler:    _GolangMicroservice_RevokeUserSessions_Handler,
+		},
+		{
+			MethodName: "DenyToken",
+			Handler:    _GolangMicroservice_DenyToken_Handler,
+		},
+		{
+			MethodName: "IsTokenDenied",
+			Handler:    _GolangMicroservice_IsTokenDenied_Handler,
+		},
+		{
+			MethodName: "CreateWebhook",
+			Handler:    _GolangMicroservice_CreateWebhook_Handler,
+		},
+		{
+			MethodName: "GetWebhook",
+			Handler:    _GolangMicroservice_GetWebhook_Handler,
+		},
+		{
+			MethodName: "GetAllWebhooks",
+			Handler:    _GolangMicroservice_GetAllWebhooks_Handler,
+		},
+		{
+			MethodName: "UpdateWebhook",
+			Handler:    _GolangMicroservice_UpdateWebhook_Handler,
+		},
+		{
+			MethodName: "DeleteWebhook",
+			Handler:    _GolangMicroservice_DeleteWebhook_Handler,
+		},
+		{
+			MethodName: "GetAllWebhookDeliveries",
+			Handler:    _GolangMicroservice_GetAllWebhookDeliveries_Handler,
+		},
+		{
+			MethodName: "RedeliverWebhook",
+			Handler:    _GolangMicroservice_RedeliverWebhook_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api.proto",
+}
+
+const (
+	AuthService_Login_FullMethodName             = "/pb.auth_service/Login"
+	AuthService_LoginMFA_FullMethodName          = "/pb.auth_service/LoginMFA"
+	AuthService_LoginWithIdentity_FullMethodName = "/pb.auth_service/LoginWithIdentity"
+	AuthService_RenewToken_FullMethodName        = "/pb.auth_service/RenewToken"
+	AuthService_Logout_FullMethodName            = "/pb.auth_service/Logout"
+	AuthService_ChangePassword_FullMethodName    = "/pb.auth_service/ChangePassword"
+)
+
+// AuthServiceClient is the client API for AuthService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AuthServiceClient interface {
+	Login(ctx context.Context, in *LoginReq, opts ...grpc.CallOption) (*LoginRes, error)
+	LoginMFA(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*LoginRes, error)
+	LoginWithIdentity(ctx context.Context, in *IdentityReq, opts ...grpc.CallOption) (*LoginRes, error)
+	RenewToken(ctx context.Context, in *RenewTokenReq, opts ...grpc.CallOption) (*LoginRes, error)
+	Logout(ctx context.Context, in *LogoutReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error)
+	ChangePassword(ctx context.Context, in *ChangePasswordReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error)
+}
+
+type authServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAuthServiceClient(cc grpc.ClientConnInterface) AuthServiceClient {
+	return &authServiceClient{cc}
+}
+
+func (c *authServiceClient) Login(ctx context.Context, in *LoginReq, opts ...grpc.CallOption) (*LoginRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginRes)
+	err := c.cc.Invoke(ctx, AuthService_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) LoginMFA(ctx context.Context, in *TOTPReq, opts ...grpc.CallOption) (*LoginRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginRes)
+	err := c.cc.Invoke(ctx, AuthService_LoginMFA_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) LoginWithIdentity(ctx context.Context, in *IdentityReq, opts ...grpc.CallOption) (*LoginRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginRes)
+	err := c.cc.Invoke(ctx, AuthService_LoginWithIdentity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) RenewToken(ctx context.Context, in *RenewTokenReq, opts ...grpc.CallOption) (*LoginRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginRes)
+	err := c.cc.Invoke(ctx, AuthService_RenewToken_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) Logout(ctx context.Context, in *LogoutReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeSessionsRes)
+	err := c.cc.Invoke(ctx, AuthService_Logout_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authServiceClient) ChangePassword(ctx context.Context, in *ChangePasswordReq, opts ...grpc.CallOption) (*RevokeSessionsRes, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RevokeSessionsRes)
+	err := c.cc.Invoke(ctx, AuthService_ChangePassword_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AuthServiceServer is the server API for AuthService service.
+// All implementations must embed UnimplementedAuthServiceServer
+// for forward compatibility.
+type AuthServiceServer interface {
+	Login(context.Context, *LoginReq) (*LoginRes, error)
+	LoginMFA(context.Context, *TOTPReq) (*LoginRes, error)
+	LoginWithIdentity(context.Context, *IdentityReq) (*LoginRes, error)
+	RenewToken(context.Context, *RenewTokenReq) (*LoginRes, error)
+	Logout(context.Context, *LogoutReq) (*RevokeSessionsRes, error)
+	ChangePassword(context.Context, *ChangePasswordReq) (*RevokeSessionsRes, error)
+	mustEmbedUnimplementedAuthServiceServer()
+}
+
+// UnimplementedAuthServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAuthServiceServer struct{}
+
+func (UnimplementedAuthServiceServer) Login(context.Context, *LoginReq) (*LoginRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedAuthServiceServer) LoginMFA(context.Context, *TOTPReq) (*LoginRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoginMFA not implemented")
+}
+func (UnimplementedAuthServiceServer) LoginWithIdentity(context.Context, *IdentityReq) (*LoginRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoginWithIdentity not implemented")
+}
+func (UnimplementedAuthServiceServer) RenewToken(context.Context, *RenewTokenReq) (*LoginRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenewToken not implemented")
+}
+func (UnimplementedAuthServiceServer) Logout(context.Context, *LogoutReq) (*RevokeSessionsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Logout not implemented")
+}
+func (UnimplementedAuthServiceServer) ChangePassword(context.Context, *ChangePasswordReq) (*RevokeSessionsRes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangePassword not implemented")
+}
+func (UnimplementedAuthServiceServer) mustEmbedUnimplementedAuthServiceServer() {}
+func (UnimplementedAuthServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeAuthServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AuthServiceServer will
+// result in compilation errors.
+type UnsafeAuthServiceServer interface {
+	mustEmbedUnimplementedAuthServiceServer()
+}
+
+func RegisterAuthServiceServer(s grpc.ServiceRegistrar, srv AuthServiceServer) {
+	// If the following call pancis, it indicates UnimplementedAuthServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&AuthService_ServiceDesc, srv)
+}
+
+func _AuthService_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Login(ctx, req.(*LoginReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_LoginMFA_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TOTPReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).LoginMFA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_LoginMFA_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).LoginMFA(ctx, req.(*TOTPReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_LoginWithIdentity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IdentityReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).LoginWithIdentity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_LoginWithIdentity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).LoginWithIdentity(ctx, req.(*IdentityReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_RenewToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewTokenReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).RenewToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_RenewToken_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).RenewToken(ctx, req.(*RenewTokenReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_Logout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogoutReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).Logout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_Logout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).Logout(ctx, req.(*LogoutReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthService_ChangePassword_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChangePasswordReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthServiceServer).ChangePassword(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AuthService_ChangePassword_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthServiceServer).ChangePassword(ctx, req.(*ChangePasswordReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AuthService_ServiceDesc is the grpc.ServiceDesc for AuthService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AuthService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.auth_service",
+	HandlerType: (*AuthServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Login",
+			Handler:    _AuthService_Login_Handler,
+		},
+		{
+			MethodName: "LoginMFA",
+			Handler:    _AuthService_LoginMFA_Handler,
 		},
 		{
-			MethodName: "CreateSession",
-			Handler:    _GolangMicroservice_CreateSession_Handler,
+			MethodName: "LoginWithIdentity",
+			Handler:    _AuthService_LoginWithIdentity_Handler,
 		},
 		{
-			MethodName: "GetSession",
-			Handler:    _GolangMicroservice_GetSession_Handler,
+			MethodName: "RenewToken",
+			Handler:    _AuthService_RenewToken_Handler,
 		},
 		{
-			MethodName: "RevokeSession",
-			Handler:    _GolangMicroservice_RevokeSession_Handler,
+			MethodName: "Logout",
+			Handler:    _AuthService_Logout_Handler,
 		},
 		{
-			MethodName: "DeleteSession",
-			Handler:    _GolangMicroservice_DeleteSession_Handler,
+			MethodName: "ChangePassword",
+			Handler:    _AuthService_ChangePassword_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/token"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyPrefix starts every API key, so that leaked keys are easy to spot.
+// It is followed by the key's prefix, an underscore and the secret.
+const APIKeyPrefix = "gmk_"
+
+const (
+	apiKeyIDLength = 16
+	// apiKeyTouchInterval limits how often the last use of a key is written.
+	apiKeyTouchInterval = time.Minute
+)
+
+// ErrInvalidAPIKey is returned for API keys that are malformed, unknown,
+// revoked or expired.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKeyVerifier resolves API keys to the claims their caller acts with.
+type APIKeyVerifier interface {
+	APIKeyClaims(ctx context.Context, key string) (*token.UserClaims, error)
+}
+
+// newAPIKey returns a random API key, the prefix it is looked up by and the
+// hash it is stored as.
+func newAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, apiKeyIDLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", fmt.Errorf("error generating api key: %w", err)
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, _, err := newSecretToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = APIKeyPrefix + prefix + "_" + secret
+	return key, prefix, hashSecretToken(key), nil
+}
+
+func parseAPIKey(key string) (prefix string, ok bool) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", false
+	}
+
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != apiKeyIDLength || secret == "" {
+		return "", false
+	}
+
+	return prefix, true
+}
+
+// APIKeyClaims returns the claims of the user the key acts for, with the
+// key's scopes the user still has as permissions, so that permissions taken
+// from a user are taken from their keys too. ErrInvalidAPIKey is returned if
+// the key can not be used.
+func (s *Server) APIKeyClaims(ctx context.Context, key string) (*token.UserClaims, error) {
+	prefix, ok := parseAPIKey(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	k, err := s.storer.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecretToken(key)), []byte(k.KeyHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if k.RevokedAt != nil || (k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.storer.GetUserByID(ctx, k.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.storer.ListUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := slices.DeleteFunc(splitList(k.Scopes), func(scope string) bool {
+		return !rbac.Has(granted, scope)
+	})
+
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= apiKeyTouchInterval {
+		// failing to record the use is no reason to turn the caller away
+		if err := s.storer.TouchAPIKey(ctx, k.ID, now); err != nil {
+			slog.WarnContext(ctx, "error recording api key use", "api_key", k.Prefix, "error", err)
+		}
+	}
+
+	return &token.UserClaims{
+		ID:           user.ID,
+		Email:        user.Email,
+		Permissions:  permissions,
+		APIKeyPrefix: k.Prefix,
+	}, nil
+}
+
+// CreateAPIKey issues a key acting for the given user, or the caller if none
+// is given. Keys for other users need rbac.APIKeysIssueForOthers. The caller
+// can only grant scopes they have themselves.
+func (s *Server) CreateAPIKey(ctx context.Context, req *pb.APIKeyReq) (*pb.APIKeyRes, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "user token is required")
+	}
+
+	if strings.TrimSpace(req.GetName()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	scopes := slices.Clone(req.GetScopes())
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+	if len(scopes) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(rbac.All, scope) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown scope %q", scope)
+		}
+		if !claims.HasPermission(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "missing permission %s", scope)
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		t := req.GetExpiresAt().AsTime()
+		if !t.After(time.Now()) {
+			return nil, status.Error(codes.InvalidArgument, "expires_at must be in the future")
+		}
+		expiresAt = &t
+	}
+
+	userID := req.GetUserId()
+	if userID == 0 {
+		userID = claims.ID
+	}
+	if userID != claims.ID && !claims.HasPermission(rbac.APIKeysIssueForOthers) {
+		return nil, status.Errorf(codes.PermissionDenied, "missing permission %s", rbac.APIKeysIssueForOthers)
+	}
+	if _, err := s.storer.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "user %d not found", userID)
+		}
+		return nil, err
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := s.storer.CreateAPIKey(ctx, &storer.APIKey{
+		Name:      req.GetName(),
+		Prefix:    prefix,
+		KeyHash:   hash,
+		UserID:    userID,
+		Scopes:    strings.Join(scopes, ","),
+		CreatedBy: claims.ID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "created api key", "api_key", k.Prefix, "target_user_id", userID, "scopes", scopes)
+
+	// the key is only ever returned once, on creation
+	res := toPBAPIKeyRes(k)
+	res.Key = key
+
+	return res, nil
+}
+
+func (s *Server) ListAPIKeys(ctx context.Context, _ *pb.ListAPIKeysReq) (*pb.ListAPIKeysRes, error) {
+	keys, err := s.storer.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListAPIKeysRes{}
+	for _, k := range keys {
+		res.Keys = append(res.Keys, toPBAPIKeyRes(k))
+	}
+
+	return res, nil
+}
+
+func (s *Server) RevokeAPIKey(ctx context.Context, req *pb.APIKeyReq) (*pb.APIKeyRes, error) {
+	k, err := s.storer.RevokeAPIKey(ctx, req.GetId(), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "api key %d not found", req.GetId())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "revoked api key", "api_key", k.Prefix)
+
+	return toPBAPIKeyRes(k), nil
+}
+
+// AuthenticateAPIKey lets the gateway check the keys presented to it.
+func (s *Server) AuthenticateAPIKey(ctx context.Context, req *pb.AuthenticateAPIKeyReq) (*pb.AuthenticateAPIKeyRes, error) {
+	claims, err := s.APIKeyClaims(ctx, req.GetKey())
+	if errors.Is(err, ErrInvalidAPIKey) {
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.AuthenticateAPIKeyRes{
+		UserId:      claims.ID,
+		Email:       claims.Email,
+		Permissions: claims.Permissions,
+		Prefix:      claims.APIKeyPrefix,
+	}, nil
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseAPIKey(t *testing.T) {
+	key, prefix, hash, err := newAPIKey()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(key, APIKeyPrefix+prefix+"_"))
+	require.Equal(t, hashSecretToken(key), hash)
+
+	parsed, ok := parseAPIKey(key)
+	require.True(t, ok)
+	require.Equal(t, prefix, parsed)
+
+	for _, key := range []string{"", "gmk_", "gmk_0123456789abcdef", "gmk_0123456789abcdef_", "gmk_short_secret", "xyz_0123456789abcdef_secret"} {
+		_, ok := parseAPIKey(key)
+		require.False(t, ok, key)
+	}
+}
+
+func expectPermissions(mock sqlmock.Sqlmock, userID int64, permissions ...string) {
+	rows := sqlmock.NewRows([]string{"name"})
+	for _, p := range permissions {
+		rows.AddRow(p)
+	}
+	mock.ExpectQuery("SELECT DISTINCT p.name FROM permissions p JOIN role_permissions rp ON rp.permission_id=p.id JOIN user_roles ur ON ur.role_id=rp.role_id WHERE ur.user_id=? ORDER BY p.name").WithArgs(userID).
+		WillReturnRows(rows)
+}
+
+func TestAPIKeyClaims(t *testing.T) {
+	keyCols := []string{"id", "name", "prefix", "key_hash", "user_id", "scopes", "created_by", "created_at", "expires_at", "last_used_at", "revoked_at"}
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+
+	key, prefix, hash, err := newAPIKey()
+	require.NoError(t, err)
+	scopes := rbac.OrdersReadAll + "," + rbac.OrdersUpdateStatus
+
+	t.Run("valid key", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM api_keys WHERE prefix=?").WithArgs(prefix).
+			WillReturnRows(sqlmock.NewRows(keyCols).AddRow(1, "partner", prefix, hash, 3, scopes, 1, time.Now(), nil, nil, nil))
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(3, "Partner", "partner@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		expectPermissions(mock, 3, rbac.OrdersReadAll, rbac.OrdersUpdateStatus, rbac.ProductsWrite)
+		mock.ExpectExec("UPDATE api_keys SET last_used_at=? WHERE id=?").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		claims, err := srv.APIKeyClaims(context.Background(), key)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), claims.ID)
+		require.Equal(t, "partner@example.com", claims.Email)
+		require.Equal(t, []string{rbac.OrdersReadAll, rbac.OrdersUpdateStatus}, claims.Permissions)
+		require.Equal(t, prefix, claims.APIKeyPrefix)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("recently used key is not touched", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM api_keys WHERE prefix=?").WithArgs(prefix).
+			WillReturnRows(sqlmock.NewRows(keyCols).AddRow(1, "partner", prefix, hash, 3, scopes, 1, time.Now(), nil, time.Now(), nil))
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(3, "Partner", "partner@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		expectPermissions(mock, 3, rbac.OrdersReadAll, rbac.OrdersUpdateStatus)
+
+		_, err := srv.APIKeyClaims(context.Background(), key)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("scopes the user lost are dropped", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM api_keys WHERE prefix=?").WithArgs(prefix).
+			WillReturnRows(sqlmock.NewRows(keyCols).AddRow(1, "partner", prefix, hash, 3, scopes, 1, time.Now(), nil, time.Now(), nil))
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(3, "Partner", "partner@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		expectPermissions(mock, 3, rbac.OrdersReadAll)
+
+		claims, err := srv.APIKeyClaims(context.Background(), key)
+		require.NoError(t, err)
+		require.Equal(t, []string{rbac.OrdersReadAll}, claims.Permissions)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	tcs := []struct {
+		name string
+		row  []driver.Value
+	}{
+		{name: "wrong secret", row: []driver.Value{1, "partner", prefix, hashSecretToken("other"), 3, scopes, 1, time.Now(), nil, nil, nil}},
+		{name: "revoked", row: []driver.Value{1, "partner", prefix, hash, 3, scopes, 1, time.Now(), nil, nil, time.Now()}},
+		{name: "expired", row: []driver.Value{1, "partner", prefix, hash, 3, scopes, 1, time.Now(), time.Now().Add(-time.Minute), nil, nil}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, mock, _ := newMockServer(t)
+			mock.ExpectQuery("SELECT * FROM api_keys WHERE prefix=?").WithArgs(prefix).
+				WillReturnRows(sqlmock.NewRows(keyCols).AddRow(tc.row...))
+
+			_, err := srv.APIKeyClaims(context.Background(), key)
+			require.ErrorIs(t, err, ErrInvalidAPIKey)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM api_keys WHERE prefix=?").WithArgs(prefix).WillReturnRows(sqlmock.NewRows(keyCols))
+
+		_, err := srv.AuthenticateAPIKey(context.Background(), &pb.AuthenticateAPIKeyReq{Key: key})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+	ctx := context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1, Email: "admin@example.com", Permissions: []string{rbac.APIKeysManage, rbac.OrdersReadAll}})
+
+	t.Run("success", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		ctx := context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1, Email: "admin@example.com", Permissions: []string{rbac.APIKeysManage, rbac.APIKeysIssueForOthers, rbac.OrdersReadAll}})
+		var storedHash string
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(3, "Partner", "partner@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		mock.ExpectExec("INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)").
+			WithArgs("partner", sqlmock.AnyArg(), tokenHashArg{&storedHash}, 3, rbac.OrdersReadAll, 1, sqlmock.AnyArg(), nil).
+			WillReturnResult(sqlmock.NewResult(5, 1))
+
+		res, err := srv.CreateAPIKey(ctx, &pb.APIKeyReq{Name: "partner", UserId: 3, Scopes: []string{rbac.OrdersReadAll, rbac.OrdersReadAll}})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		require.Equal(t, int64(5), res.GetId())
+		require.True(t, strings.HasPrefix(res.GetKey(), res.GetPrefix()+"_"))
+		require.Equal(t, hashSecretToken(res.GetKey()), storedHash)
+		require.Equal(t, []string{rbac.OrdersReadAll}, res.GetScopes())
+	})
+
+	tcs := []struct {
+		name string
+		req  *pb.APIKeyReq
+		code codes.Code
+	}{
+		{name: "missing name", req: &pb.APIKeyReq{Scopes: []string{rbac.OrdersReadAll}}, code: codes.InvalidArgument},
+		{name: "missing scopes", req: &pb.APIKeyReq{Name: "partner"}, code: codes.InvalidArgument},
+		{name: "unknown scope", req: &pb.APIKeyReq{Name: "partner", Scopes: []string{"orders:steal"}}, code: codes.InvalidArgument},
+		{name: "scope the caller lacks", req: &pb.APIKeyReq{Name: "partner", Scopes: []string{rbac.UsersDelete}}, code: codes.PermissionDenied},
+		{name: "key for another user", req: &pb.APIKeyReq{Name: "partner", UserId: 3, Scopes: []string{rbac.OrdersReadAll}}, code: codes.PermissionDenied},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, mock, _ := newMockServer(t)
+
+			_, err := srv.CreateAPIKey(ctx, tc.req)
+			require.Equal(t, tc.code, status.Code(err))
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceTokenHeader carries the shared credential of trusted services such
+// as the API gateway.
+const ServiceTokenHeader = "x-service-token"
+
+// AccessPolicy decides who may call a method.
+type AccessPolicy struct {
+	kind       policyKind
+	permission string
+}
+
+type policyKind int
+
+const (
+	policyPublic policyKind = iota + 1
+	policyAuthenticated
+	policyPermission
+	policyInternal
+)
+
+var (
+	// PolicyPublic methods can be called without any credential.
+	PolicyPublic = AccessPolicy{kind: policyPublic}
+	// PolicyAuthenticated methods require a valid user token or API key.
+	PolicyAuthenticated = AccessPolicy{kind: policyAuthenticated}
+	// PolicyInternal methods require the service credential. They act on
+	// behalf of callers that are not logged in yet, or serve the gateway
+	// itself.
+	PolicyInternal = AccessPolicy{kind: policyInternal}
+)
+
+// PolicyPermission methods require a valid user token or API key granting
+// permission, one of the names in the rbac package.
+func PolicyPermission(permission string) AccessPolicy {
+	return AccessPolicy{kind: policyPermission, permission: permission}
+}
+
+// MethodPolicies maps every RPC to its access policy. Methods missing from the
+// table are rejected.
+var MethodPolicies = map[string]AccessPolicy{
+	pb.GolangMicroservice_GetProduct_FullMethodName:     PolicyPublic,
+	pb.GolangMicroservice_GetAllProducts_FullMethodName: PolicyPublic,
+	pb.GolangMicroservice_CreateProduct_FullMethodName:  PolicyPermission(rbac.ProductsWrite),
+	pb.GolangMicroservice_UpdateProduct_FullMethodName:  PolicyPermission(rbac.ProductsWrite),
+	pb.GolangMicroservice_DeleteProduct_FullMethodName:  PolicyPermission(rbac.ProductsWrite),
+
+	pb.GolangMicroservice_CreateOrder_FullMethodName:       PolicyAuthenticated,
+	pb.GolangMicroservice_GetOrder_FullMethodName:          PolicyAuthenticated,
+	pb.GolangMicroservice_DeleteOrder_FullMethodName:       PolicyAuthenticated,
+	pb.GolangMicroservice_GetAllOrders_FullMethodName:      PolicyPermission(rbac.OrdersReadAll),
+	pb.GolangMicroservice_UpdateOrderStatus_FullMethodName: PolicyPermission(rbac.OrdersUpdateStatus),
+
+	pb.GolangMicroservice_UpdateUser_FullMethodName:  PolicyAuthenticated,
+	pb.GolangMicroservice_GetAllUsers_FullMethodName: PolicyPermission(rbac.UsersRead),
+	pb.GolangMicroservice_DeleteUser_FullMethodName:  PolicyPermission(rbac.UsersDelete),
+	pb.GolangMicroservice_CreateUser_FullMethodName:  PolicyInternal,
+	pb.GolangMicroservice_GetUser_FullMethodName:     PolicyInternal,
+	pb.GolangMicroservice_UnlockUser_FullMethodName:  PolicyPermission(rbac.UsersUnlock),
+
+	pb.GolangMicroservice_SetUserRoles_FullMethodName: PolicyPermission(rbac.RolesManage),
+	pb.GolangMicroservice_ListRoles_FullMethodName:    PolicyPermission(rbac.RolesManage),
+
+	pb.GolangMicroservice_CreateAPIKey_FullMethodName:       PolicyPermission(rbac.APIKeysManage),
+	pb.GolangMicroservice_ListAPIKeys_FullMethodName:        PolicyPermission(rbac.APIKeysManage),
+	pb.GolangMicroservice_RevokeAPIKey_FullMethodName:       PolicyPermission(rbac.APIKeysManage),
+	pb.GolangMicroservice_AuthenticateAPIKey_FullMethodName: PolicyInternal,
+
+	pb.GolangMicroservice_EnrollTOTP_FullMethodName:  PolicyAuthenticated,
+	pb.GolangMicroservice_ConfirmTOTP_FullMethodName: PolicyAuthenticated,
+	pb.GolangMicroservice_DisableTOTP_FullMethodName: PolicyAuthenticated,
+
+	pb.AuthService_Login_FullMethodName:             PolicyInternal,
+	pb.AuthService_LoginMFA_FullMethodName:          PolicyInternal,
+	pb.AuthService_LoginWithIdentity_FullMethodName: PolicyInternal,
+	pb.AuthService_RenewToken_FullMethodName:        PolicyInternal,
+	pb.AuthService_Logout_FullMethodName:            PolicyAuthenticated,
+	pb.AuthService_ChangePassword_FullMethodName:    PolicyAuthenticated,
+
+	pb.GolangMicroservice_RequestPasswordReset_FullMethodName: PolicyInternal,
+	pb.GolangMicroservice_ResetPassword_FullMethodName:        PolicyInternal,
+
+	pb.GolangMicroservice_VerifyEmail_FullMethodName:             PolicyInternal,
+	pb.GolangMicroservice_ResendVerificationEmail_FullMethodName: PolicyInternal,
+
+	pb.GolangMicroservice_ListSessions_FullMethodName:          PolicyAuthenticated,
+	pb.GolangMicroservice_RevokeMySession_FullMethodName:       PolicyAuthenticated,
+	pb.GolangMicroservice_RevokeMyOtherSessions_FullMethodName: PolicyAuthenticated,
+	pb.GolangMicroservice_RevokeUserSessions_FullMethodName:    PolicyPermission(rbac.UsersRevokeSessions),
+
+	pb.GolangMicroservice_DenyToken_FullMethodName:     PolicyInternal,
+	pb.GolangMicroservice_IsTokenDenied_FullMethodName: PolicyInternal,
+
+	pb.GolangMicroservice_CreateWebhook_FullMethodName:           PolicyPermission(rbac.WebhooksManage),
+	pb.GolangMicroservice_GetWebhook_FullMethodName:              PolicyPermission(rbac.WebhooksManage),
+	pb.GolangMicroservice_GetAllWebhooks_FullMethodName:          PolicyPermission(rbac.WebhooksManage),
+	pb.GolangMicroservice_UpdateWebhook_FullMethodName:           PolicyPermission(rbac.WebhooksManage),
+	pb.GolangMicroservice_DeleteWebhook_FullMethodName:           PolicyPermission(rbac.WebhooksManage),
+	pb.GolangMicroservice_GetAllWebhookDeliveries_FullMethodName: PolicyPermission(rbac.WebhooksManage),
+	pb.GolangMicroservice_RedeliverWebhook_FullMethodName:        PolicyPermission(rbac.WebhooksManage),
+
+	grpc_health_v1.Health_Check_FullMethodName: PolicyPublic,
+	grpc_health_v1.Health_Watch_FullMethodName: PolicyPublic,
+
+	// reflection is only registered when enabled by flag and even then it is
+	// limited to internal callers, which tools like grpcurl can be by sending
+	// the service token header
+	grpc_reflection_v1.ServerReflection_ServerReflectionInfo_FullMethodName:      PolicyInternal,
+	grpc_reflection_v1alpha.ServerReflection_ServerReflectionInfo_FullMethodName: PolicyInternal,
+}
+
+type claimsKey struct{}
+type internalCallerKey struct{}
+
+// ClaimsFromContext returns the claims of the user token or API key the call
+// was made with, if any.
+func ClaimsFromContext(ctx context.Context) (*token.UserClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*token.UserClaims)
+	return claims, ok
+}
+
+// requireClaims returns the claims of the user a call is made by. Methods
+// acting on the caller's own data take the user from here rather than from
+// the request.
+func requireClaims(ctx context.Context) (*token.UserClaims, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+
+	return claims, nil
+}
+
+// IsInternalCaller reports whether the call was made with the service
+// credential.
+func IsInternalCaller(ctx context.Context) bool {
+	internal, _ := ctx.Value(internalCallerKey{}).(bool)
+	return internal
+}
+
+// TokenRevocations tells whether a user token was revoked before it expired,
+// either by itself or along with the session it was issued for.
+type TokenRevocations interface {
+	IsTokenRevoked(ctx context.Context, claims *token.UserClaims) (bool, error)
+}
+
+type Authenticator struct {
+	tokenMaker   token.Maker
+	serviceToken string
+	apiKeys      APIKeyVerifier
+	revocations  TokenRevocations
+	policies     map[string]AccessPolicy
+}
+
+// NewAuthenticator returns an Authenticator accepting user tokens made by
+// tokenMaker, the service token and, unless apiKeys is nil, API keys sent as
+// "authorization: ApiKey <key>". Unless revocations is nil, user tokens it
+// reports as revoked are rejected.
+func NewAuthenticator(tokenMaker token.Maker, serviceToken string, apiKeys APIKeyVerifier, revocations TokenRevocations) *Authenticator {
+	return &Authenticator{
+		tokenMaker:   tokenMaker,
+		serviceToken: serviceToken,
+		apiKeys:      apiKeys,
+		revocations:  revocations,
+		policies:     MethodPolicies,
+	}
+}
+
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Authenticator) authorize(ctx context.Context, method string) (context.Context, error) {
+	policy, ok := a.policies[method]
+	if !ok {
+		return nil, status.Errorf(codes.PermissionDenied, "no access policy for %s", method)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	internal := false
+	if st := firstMetadataValue(md, ServiceTokenHeader); st != "" {
+		if a.serviceToken == "" || subtle.ConstantTimeCompare([]byte(st), []byte(a.serviceToken)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid service credential")
+		}
+		internal = true
+	}
+
+	var claims *token.UserClaims
+	if authHeader := firstMetadataValue(md, "authorization"); authHeader != "" {
+		fields := strings.Fields(authHeader)
+		if len(fields) != 2 {
+			return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata")
+		}
+
+		switch {
+		case strings.EqualFold(fields[0], "Bearer"):
+			c, err := a.tokenMaker.VerifyToken(fields[1])
+			if err != nil || c.Purpose != "" {
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			if a.revocations != nil {
+				revoked, err := a.revocations.IsTokenRevoked(ctx, c)
+				if err != nil {
+					slog.ErrorContext(ctx, "error checking token revocation", "error", err)
+					return nil, status.Error(codes.Internal, "error checking token")
+				}
+				if revoked {
+					return nil, status.Error(codes.Unauthenticated, "token revoked")
+				}
+			}
+			claims = c
+		case strings.EqualFold(fields[0], "ApiKey") && a.apiKeys != nil:
+			c, err := a.apiKeys.APIKeyClaims(ctx, fields[1])
+			if errors.Is(err, ErrInvalidAPIKey) {
+				return nil, status.Error(codes.Unauthenticated, "invalid api key")
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "error checking api key", "error", err)
+				return nil, status.Error(codes.Internal, "error checking api key")
+			}
+			claims = c
+		default:
+			return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata")
+		}
+	}
+
+	switch policy.kind {
+	case policyPublic:
+	case policyAuthenticated:
+		if claims == nil {
+			return nil, status.Error(codes.Unauthenticated, "user token or api key is required")
+		}
+	case policyPermission:
+		if claims == nil {
+			return nil, status.Error(codes.Unauthenticated, "user token or api key is required")
+		}
+		if !claims.HasPermission(policy.permission) {
+			return nil, status.Errorf(codes.PermissionDenied, "missing permission %s", policy.permission)
+		}
+	case policyInternal:
+		if !internal {
+			return nil, status.Error(codes.PermissionDenied, "method is only available to internal services")
+		}
+	default:
+		return nil, status.Errorf(codes.PermissionDenied, "no access policy for %s", method)
+	}
+
+	if claims != nil {
+		logCallUser(ctx, claims.ID)
+		ctx = context.WithValue(ctx, claimsKey{}, claims)
+	}
+	ctx = context.WithValue(ctx, internalCallerKey{}, internal)
+
+	return ctx, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// staticAPIKeys accepts a fixed set of keys.
+type staticAPIKeys map[string]*token.UserClaims
+
+func (k staticAPIKeys) APIKeyClaims(ctx context.Context, key string) (*token.UserClaims, error) {
+	claims, ok := k[key]
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	return claims, nil
+}
+
+// revokedSessions reports the tokens of the sessions it holds as revoked.
+type revokedSessions map[string]bool
+
+func (r revokedSessions) IsTokenRevoked(ctx context.Context, claims *token.UserClaims) (bool, error) {
+	return r[claims.SessionID], nil
+}
+
+func TestAuthenticatorUnaryInterceptor(t *testing.T) {
+	const serviceToken = "service-token-service-token-1234"
+	tokenMaker := token.NewJWTMaker("01234567890123456789012345678901")
+
+	userToken, _, err := tokenMaker.CreateToken(1, "user@example.com", nil, "", time.Minute)
+	require.NoError(t, err)
+	adminToken, _, err := tokenMaker.CreateToken(2, "admin@example.com", []string{rbac.UsersDelete}, "", time.Minute)
+	require.NoError(t, err)
+	revokedToken, _, err := tokenMaker.CreateToken(1, "user@example.com", nil, "s2", time.Minute)
+	require.NoError(t, err)
+
+	apiKeys := staticAPIKeys{"partner-key": {ID: 3, Email: "partner@example.com", Permissions: []string{rbac.OrdersReadAll}, APIKeyPrefix: "partner"}}
+
+	auth := NewAuthenticator(tokenMaker, serviceToken, apiKeys, revokedSessions{"s2": true})
+	interceptor := auth.UnaryInterceptor()
+
+	tcs := []struct {
+		name   string
+		method string
+		md     metadata.MD
+		code   codes.Code
+	}{
+		{name: "public without credentials", method: pb.GolangMicroservice_GetProduct_FullMethodName, code: codes.OK},
+		{name: "authenticated without token", method: pb.GolangMicroservice_CreateOrder_FullMethodName, code: codes.Unauthenticated},
+		{name: "authenticated with user token", method: pb.GolangMicroservice_CreateOrder_FullMethodName, md: metadata.Pairs("authorization", "Bearer "+userToken), code: codes.OK},
+		{name: "invalid token", method: pb.GolangMicroservice_CreateOrder_FullMethodName, md: metadata.Pairs("authorization", "Bearer garbage"), code: codes.Unauthenticated},
+		{name: "token of revoked session", method: pb.GolangMicroservice_CreateOrder_FullMethodName, md: metadata.Pairs("authorization", "Bearer "+revokedToken), code: codes.Unauthenticated},
+		{name: "permission with user token", method: pb.GolangMicroservice_DeleteUser_FullMethodName, md: metadata.Pairs("authorization", "Bearer "+userToken), code: codes.PermissionDenied},
+		{name: "permission with granted token", method: pb.GolangMicroservice_DeleteUser_FullMethodName, md: metadata.Pairs("authorization", "Bearer "+adminToken), code: codes.OK},
+		{name: "permission with other permission", method: pb.GolangMicroservice_SetUserRoles_FullMethodName, md: metadata.Pairs("authorization", "Bearer "+adminToken), code: codes.PermissionDenied},
+		{name: "authenticated with api key", method: pb.GolangMicroservice_CreateOrder_FullMethodName, md: metadata.Pairs("authorization", "ApiKey partner-key"), code: codes.OK},
+		{name: "permission with api key", method: pb.GolangMicroservice_GetAllOrders_FullMethodName, md: metadata.Pairs("authorization", "ApiKey partner-key"), code: codes.OK},
+		{name: "permission outside api key scopes", method: pb.GolangMicroservice_DeleteUser_FullMethodName, md: metadata.Pairs("authorization", "ApiKey partner-key"), code: codes.PermissionDenied},
+		{name: "unknown api key", method: pb.GolangMicroservice_CreateOrder_FullMethodName, md: metadata.Pairs("authorization", "ApiKey stolen"), code: codes.Unauthenticated},
+		{name: "internal with admin token", method: pb.AuthService_Login_FullMethodName, md: metadata.Pairs("authorization", "Bearer "+adminToken), code: codes.PermissionDenied},
+		{name: "internal with service token", method: pb.AuthService_Login_FullMethodName, md: metadata.Pairs(ServiceTokenHeader, serviceToken), code: codes.OK},
+		{name: "wrong service token", method: pb.AuthService_Login_FullMethodName, md: metadata.Pairs(ServiceTokenHeader, "nope"), code: codes.Unauthenticated},
+		{name: "health check without credentials", method: grpc_health_v1.Health_Check_FullMethodName, code: codes.OK},
+		{name: "unknown method", method: "/pb.golang_microservice/DropDatabase", md: metadata.Pairs(ServiceTokenHeader, serviceToken), code: codes.PermissionDenied},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			require.Equal(t, tc.code, status.Code(err))
+		})
+	}
+}
+
+func TestAuthenticatorPassesClaims(t *testing.T) {
+	tokenMaker := token.NewJWTMaker("01234567890123456789012345678901")
+	userToken, _, err := tokenMaker.CreateToken(1, "user@example.com", nil, "", time.Minute)
+	require.NoError(t, err)
+
+	interceptor := NewAuthenticator(tokenMaker, "", nil, nil).UnaryInterceptor()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+userToken))
+
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: pb.GolangMicroservice_GetOrder_FullMethodName}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		claims, ok := ClaimsFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, int64(1), claims.ID)
+		require.False(t, IsInternalCaller(ctx))
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMethodPoliciesCoverService(t *testing.T) {
+	for _, desc := range []grpc.ServiceDesc{pb.GolangMicroservice_ServiceDesc, pb.AuthService_ServiceDesc} {
+		for _, m := range desc.Methods {
+			method := "/" + desc.ServiceName + "/" + m.MethodName
+			_, ok := MethodPolicies[method]
+			require.True(t, ok, "missing access policy for %s", method)
+		}
+	}
+}
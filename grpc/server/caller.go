@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Metadata the API gateway forwards about the HTTP request a call is made for.
+const (
+	RequestIDHeader       = "x-request-id"
+	ClientIPHeader        = "x-client-ip"
+	ClientUserAgentHeader = "x-client-user-agent"
+)
+
+// Caller describes who a call is made by.
+type Caller struct {
+	RequestID string
+	// IP and UserAgent are those of the end user when the call was forwarded
+	// by an internal service, otherwise those of the direct peer.
+	IP        string
+	UserAgent string
+	// UserID is the ID of the user whose token the call was made with, 0 if
+	// none was sent.
+	UserID int64
+}
+
+// CallerFromContext returns the caller of the RPC ctx belongs to. Forwarded
+// client details are only trusted from internal callers, so it must be used
+// after the Authenticator has run.
+func CallerFromContext(ctx context.Context) Caller {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	c := Caller{
+		RequestID: firstMetadataValue(md, RequestIDHeader),
+		UserAgent: firstMetadataValue(md, "user-agent"),
+	}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		c.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(c.IP); err == nil {
+			c.IP = host
+		}
+	}
+
+	if IsInternalCaller(ctx) {
+		if ip := firstMetadataValue(md, ClientIPHeader); ip != "" {
+			c.IP = ip
+		}
+		if ua := firstMetadataValue(md, ClientUserAgentHeader); ua != "" {
+			c.UserAgent = ua
+		}
+	}
+
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		c.UserID = claims.ID
+	}
+
+	return c
+}
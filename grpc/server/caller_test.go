@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestCallerFromContext(t *testing.T) {
+	md := metadata.Pairs(
+		RequestIDHeader, "req-1",
+		ClientIPHeader, "203.0.113.7",
+		ClientUserAgentHeader, "curl/8.0",
+		"user-agent", "grpc-go/1.67.1",
+	)
+	base := peer.NewContext(metadata.NewIncomingContext(context.Background(), md), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 51234},
+	})
+
+	tcs := []struct {
+		name string
+		ctx  context.Context
+		want Caller
+	}{
+		{
+			name: "forwarded details are ignored from external callers",
+			ctx:  context.WithValue(base, claimsKey{}, &token.UserClaims{ID: 5}),
+			want: Caller{RequestID: "req-1", IP: "10.0.0.2", UserAgent: "grpc-go/1.67.1", UserID: 5},
+		},
+		{
+			name: "forwarded details are trusted from internal callers",
+			ctx:  context.WithValue(base, internalCallerKey{}, true),
+			want: Caller{RequestID: "req-1", IP: "203.0.113.7", UserAgent: "curl/8.0"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, CallerFromContext(tc.ctx))
+		})
+	}
+}
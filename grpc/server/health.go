@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Pinger is implemented by the database the service depends on.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// WatchDatabaseHealth pings db every interval and reports the service as
+// serving only while the ping succeeds. The status is set both for the whole
+// server ("") and for the GolangMicroservice service.
+func WatchDatabaseHealth(ctx context.Context, hs *health.Server, db Pinger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if status != last {
+			if err != nil {
+				slog.WarnContext(ctx, "database ping failed", "status", status.String(), "error", err)
+			} else {
+				slog.InfoContext(ctx, "database ping succeeded", "status", status.String())
+			}
+			hs.SetServingStatus("", status)
+			hs.SetServingStatus(pb.GolangMicroservice_ServiceDesc.ServiceName, status)
+			last = status
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
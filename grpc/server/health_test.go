@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type fakePinger struct {
+	down atomic.Bool
+}
+
+func (p *fakePinger) PingContext(ctx context.Context) error {
+	if p.down.Load() {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func TestWatchDatabaseHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hs := health.NewServer()
+	db := &fakePinger{}
+	go WatchDatabaseHealth(ctx, hs, db, 10*time.Millisecond)
+
+	requireStatus := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		for _, service := range []string{"", pb.GolangMicroservice_ServiceDesc.ServiceName} {
+			require.Eventually(t, func() bool {
+				res, err := hs.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+				return err == nil && res.GetStatus() == want
+			}, time.Second, 5*time.Millisecond, "service %q", service)
+		}
+	}
+
+	requireStatus(healthpb.HealthCheckResponse_SERVING)
+
+	db.down.Store(true)
+	requireStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	db.down.Store(false)
+	requireStatus(healthpb.HealthCheckResponse_SERVING)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Metadata keys used for idempotent requests.
+const (
+	IdempotencyKeyHeader     = "idempotency-key"
+	IdempotentReplayedHeader = "idempotent-replayed"
+)
+
+// Reasons of the ErrorInfo detail of errors raised by the idempotency
+// interceptor, which tell them apart from errors of the methods themselves
+// with the same code.
+const (
+	ErrorDomain                  = "golang-microservice"
+	IdempotencyKeyReusedReason   = "IDEMPOTENCY_KEY_REUSED"
+	IdempotencyKeyInFlightReason = "IDEMPOTENCY_KEY_IN_FLIGHT"
+)
+
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, k *storer.IdempotencyKey) (*storer.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, method, caller, key string, response []byte) error
+	DeleteIdempotencyKey(ctx context.Context, method, caller, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+// IdempotencyUnaryInterceptor makes the given methods idempotent for callers
+// that send an idempotency-key. The first request with a key is executed and
+// its response stored; later requests with the same key and fingerprint get
+// the stored response back without running the handler again. Reusing a key
+// with a different request fails with FailedPrecondition, and a request whose
+// twin is still being processed fails with Aborted, both with an ErrorInfo
+// detail naming the reason.
+//
+// Keys are scoped to the caller, the user the call is made by or else the
+// client's address, so that callers can not replay each other's responses.
+// Requests are told apart by an HMAC of the request message under secret, as
+// the messages may hold passwords.
+//
+// Failed requests are not remembered, so they can be retried with the same key.
+func IdempotencyUnaryInterceptor(st IdempotencyStore, secret []byte, ttl time.Duration, methods ...string) grpc.UnaryServerInterceptor {
+	enabled := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		enabled[m] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !enabled[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		key := firstMetadataValue(md, IdempotencyKeyHeader)
+		if key == "" {
+			return handler(ctx, req)
+		}
+
+		if len(key) > 255 {
+			return nil, status.Error(codes.InvalidArgument, "idempotency key must be at most 255 characters")
+		}
+
+		fingerprint, err := fingerprintMessage(secret, req)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "error fingerprinting request: %v", err)
+		}
+
+		caller := idempotencyCaller(ctx)
+		existing, err := st.ReserveIdempotencyKey(ctx, &storer.IdempotencyKey{
+			Method:      info.FullMethod,
+			Caller:      caller,
+			Key:         key,
+			Fingerprint: fingerprint,
+			Status:      storer.IdempotencyStatusProcessing,
+			ExpiresAt:   time.Now().Add(ttl),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if existing != nil {
+			return replay(ctx, existing, fingerprint)
+		}
+
+		res, err := handler(ctx, req)
+		if err != nil {
+			// use a fresh context, the request one may be what failed
+			if delErr := st.DeleteIdempotencyKey(context.WithoutCancel(ctx), info.FullMethod, caller, key); delErr != nil {
+				slog.ErrorContext(ctx, "error releasing idempotency key", "key", key, "error", delErr)
+			}
+			return nil, err
+		}
+
+		stored, err := encodeResponse(res)
+		if err == nil {
+			err = st.CompleteIdempotencyKey(context.WithoutCancel(ctx), info.FullMethod, caller, key, stored)
+		}
+		if err != nil {
+			// the work is done; failing now would invite a duplicate retry
+			slog.ErrorContext(ctx, "error storing response for idempotency key", "key", key, "error", err)
+		}
+
+		return res, nil
+	}
+}
+
+func idempotencyError(code codes.Code, reason, msg string) error {
+	st, err := status.New(code, msg).WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: ErrorDomain})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+
+	return st.Err()
+}
+
+func replay(ctx context.Context, k *storer.IdempotencyKey, fingerprint string) (interface{}, error) {
+	if k.Fingerprint != fingerprint {
+		return nil, idempotencyError(codes.FailedPrecondition, IdempotencyKeyReusedReason, "idempotency key was already used for a different request")
+	}
+
+	if k.Status != storer.IdempotencyStatusCompleted {
+		return nil, idempotencyError(codes.Aborted, IdempotencyKeyInFlightReason, "a request with this idempotency key is still being processed")
+	}
+
+	var a anypb.Any
+	if err := proto.Unmarshal(k.Response, &a); err != nil {
+		return nil, status.Errorf(codes.Internal, "error decoding stored response: %v", err)
+	}
+
+	res, err := a.UnmarshalNew()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "error decoding stored response: %v", err)
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(IdempotentReplayedHeader, "true"))
+
+	return res, nil
+}
+
+func encodeResponse(res interface{}) ([]byte, error) {
+	m, ok := res.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("response is not a proto message")
+	}
+
+	a, err := anypb.New(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(a)
+}
+
+func fingerprintMessage(secret []byte, req interface{}) (string, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return "", fmt.Errorf("request is not a proto message")
+	}
+
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// idempotencyCaller names the caller idempotency keys are scoped to. Calls
+// made without a user, such as sign-ups forwarded by the gateway, are scoped
+// to the client's address.
+func idempotencyCaller(ctx context.Context) string {
+	c := CallerFromContext(ctx)
+	if c.UserID != 0 {
+		return "user:" + strconv.FormatInt(c.UserID, 10)
+	}
+
+	return "ip:" + c.IP
+}
+
+func firstMetadataValue(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+// SweepIdempotencyKeys deletes expired idempotency keys every interval until
+// ctx is cancelled.
+func SweepIdempotencyKeys(ctx context.Context, st IdempotencyStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := st.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+			if err != nil {
+				slog.ErrorContext(ctx, "error sweeping idempotency keys", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "swept expired idempotency keys", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func errorReason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if ei, ok := d.(*errdetails.ErrorInfo); ok {
+			return ei.GetReason()
+		}
+	}
+	return ""
+}
+
+type fakeIdempotencyStore struct {
+	keys map[string]*storer.IdempotencyKey
+}
+
+func (s *fakeIdempotencyStore) ReserveIdempotencyKey(ctx context.Context, k *storer.IdempotencyKey) (*storer.IdempotencyKey, error) {
+	if existing, ok := s.keys[k.Method+k.Caller+k.Key]; ok {
+		return existing, nil
+	}
+	s.keys[k.Method+k.Caller+k.Key] = k
+	return nil, nil
+}
+
+func (s *fakeIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, method, caller, key string, response []byte) error {
+	k := s.keys[method+caller+key]
+	k.Status = storer.IdempotencyStatusCompleted
+	k.Response = response
+	return nil
+}
+
+func (s *fakeIdempotencyStore) DeleteIdempotencyKey(ctx context.Context, method, caller, key string) error {
+	delete(s.keys, method+caller+key)
+	return nil
+}
+
+func (s *fakeIdempotencyStore) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestIdempotencyUnaryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: pb.GolangMicroservice_CreateOrder_FullMethodName}
+	withKey := func(key string) context.Context {
+		ctx := context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1})
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(IdempotencyKeyHeader, key))
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, grpc.UnaryServerInterceptor, *fakeIdempotencyStore)
+	}{
+		{
+			name: "replays the stored response",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				calls := int64(0)
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					calls++
+					return &pb.OrderRes{Id: calls}, nil
+				}
+				req := &pb.OrderReq{UserId: 1, PaymentMethod: "QRIS"}
+
+				first, err := interceptor(withKey("k1"), req, info, handler)
+				require.NoError(t, err)
+
+				second, err := interceptor(withKey("k1"), req, info, handler)
+				require.NoError(t, err)
+
+				require.Equal(t, int64(1), calls)
+				require.Equal(t, first.(*pb.OrderRes).Id, second.(*pb.OrderRes).Id)
+			},
+		},
+		{
+			name: "rejects a different request with the same key",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return &pb.OrderRes{Id: 1}, nil
+				}
+
+				_, err := interceptor(withKey("k1"), &pb.OrderReq{UserId: 1, TotalPrice: 10}, info, handler)
+				require.NoError(t, err)
+
+				_, err = interceptor(withKey("k1"), &pb.OrderReq{UserId: 1, TotalPrice: 20}, info, handler)
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+				require.Equal(t, IdempotencyKeyReusedReason, errorReason(err))
+			},
+		},
+		{
+			name: "in-flight request is reported as aborted",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				req := &pb.OrderReq{UserId: 1}
+				handler := func(ctx context.Context, r interface{}) (interface{}, error) {
+					_, err := interceptor(withKey("k1"), req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+						t.Fatal("handler must not run twice")
+						return nil, nil
+					})
+					require.Equal(t, codes.Aborted, status.Code(err))
+					require.Equal(t, IdempotencyKeyInFlightReason, errorReason(err))
+					return &pb.OrderRes{Id: 1}, nil
+				}
+
+				_, err := interceptor(withKey("k1"), req, info, handler)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed requests release the key",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				fail := true
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					if fail {
+						return nil, fmt.Errorf("database is down")
+					}
+					return &pb.OrderRes{Id: 1}, nil
+				}
+				req := &pb.OrderReq{UserId: 1}
+
+				_, err := interceptor(withKey("k1"), req, info, handler)
+				require.Error(t, err)
+				require.Empty(t, st.keys)
+
+				fail = false
+				_, err = interceptor(withKey("k1"), req, info, handler)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "keys are scoped to the caller",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				calls := int64(0)
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					calls++
+					return &pb.OrderRes{Id: calls}, nil
+				}
+				req := &pb.OrderReq{PaymentMethod: "QRIS"}
+				other := metadata.NewIncomingContext(
+					context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 2}),
+					metadata.Pairs(IdempotencyKeyHeader, "k1"),
+				)
+
+				_, err := interceptor(withKey("k1"), req, info, handler)
+				require.NoError(t, err)
+
+				res, err := interceptor(other, req, info, handler)
+				require.NoError(t, err)
+				require.Equal(t, int64(2), res.(*pb.OrderRes).Id)
+			},
+		},
+		{
+			name: "fingerprints are keyed",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return &pb.UserRes{Id: 1}, nil
+				}
+				req := &pb.UserReq{Email: "john@example.com", Password: "correct horse"}
+
+				_, err := interceptor(withKey("k1"), req, info, handler)
+				require.NoError(t, err)
+
+				b, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+				require.NoError(t, err)
+				unkeyed := sha256.Sum256(b)
+				for _, k := range st.keys {
+					require.NotEqual(t, hex.EncodeToString(unkeyed[:]), k.Fingerprint)
+				}
+			},
+		},
+		{
+			name: "requests without a key are passed through",
+			test: func(t *testing.T, interceptor grpc.UnaryServerInterceptor, st *fakeIdempotencyStore) {
+				calls := 0
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					calls++
+					return &pb.OrderRes{}, nil
+				}
+
+				for i := 0; i < 2; i++ {
+					_, err := interceptor(context.Background(), &pb.OrderReq{}, info, handler)
+					require.NoError(t, err)
+				}
+				require.Equal(t, 2, calls)
+				require.Empty(t, st.keys)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			st := &fakeIdempotencyStore{keys: make(map[string]*storer.IdempotencyKey)}
+			interceptor := IdempotencyUnaryInterceptor(st, []byte("secret"), time.Hour, pb.GolangMicroservice_CreateOrder_FullMethodName)
+			tc.test(t, interceptor, st)
+		})
+	}
+}
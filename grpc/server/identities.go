@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LoginWithIdentity logs in the user with an account at an OpenID Connect
+// provider, whose email address the provider has verified. An account seen
+// before logs in as the user it was linked to. Otherwise it is linked to the
+// user with the same email address, or a new user without a password is
+// created for it.
+//
+// Only users who verified their email address are linked, as anybody could
+// have registered an unverified one and would share the account with its
+// owner. Like with Login, users with two-factor authentication complete the
+// login with LoginMFA.
+func (s *Server) LoginWithIdentity(ctx context.Context, r *pb.IdentityReq) (*pb.LoginRes, error) {
+	if r.GetProvider() == "" || r.GetSubject() == "" {
+		return nil, status.Error(codes.InvalidArgument, "provider and subject are required")
+	}
+
+	user, err := s.identityUser(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLocked(user); err != nil {
+		return nil, err
+	}
+
+	return s.login(ctx, user)
+}
+
+// identityUser returns the user the identity belongs to, linking it first if
+// it was not seen before.
+func (s *Server) identityUser(ctx context.Context, r *pb.IdentityReq) (*storer.User, error) {
+	user, err := s.storer.GetUserByIdentity(ctx, r.GetProvider(), r.GetSubject())
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if err := validateEmail(r.GetEmail()); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	identity := &storer.Identity{
+		Provider:  r.GetProvider(),
+		Subject:   r.GetSubject(),
+		Email:     r.GetEmail(),
+		CreatedAt: now,
+	}
+
+	user, err = s.storer.GetUser(ctx, r.GetEmail())
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		name := r.GetName()
+		if name == "" {
+			name = r.GetEmail()
+		}
+
+		user, err = s.storer.CreateUserWithIdentity(ctx, &storer.User{
+			Name:            name,
+			Email:           r.GetEmail(),
+			EmailVerifiedAt: &now,
+		}, identity)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if user.EmailVerifiedAt == nil {
+			return nil, status.Error(codes.FailedPrecondition, "an account with this email address exists, verify its email address to link it")
+		}
+
+		identity.UserID = user.ID
+		if err := s.storer.LinkIdentity(ctx, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.InfoContext(ctx, "linked identity", "target_user_id", user.ID, "provider", identity.Provider)
+
+	return user, nil
+}
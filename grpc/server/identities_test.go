@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginWithIdentity(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+	req := &pb.IdentityReq{Provider: "google", Subject: "1234567890", Email: "john@example.com", Name: "John"}
+	const (
+		byIdentity = "SELECT u.* FROM users u JOIN user_identities i ON i.user_id=u.id WHERE i.provider=? AND i.subject=?"
+		byEmail    = "SELECT * FROM users WHERE email=?"
+		link       = "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)"
+	)
+
+	t.Run("linked before", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byIdentity).WithArgs("google", "1234567890").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", "hashed", 0, nil, time.Now(), time.Now(), nil))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		res, err := srv.LoginWithIdentity(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), res.GetUser().GetId())
+		require.NotEmpty(t, res.GetRefreshToken())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("links verified user", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byIdentity).WithArgs("google", "1234567890").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", "hashed", 0, nil, time.Now(), time.Now(), nil))
+		mock.ExpectExec(link).WithArgs(1, "google", "1234567890", "john@example.com", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		res, err := srv.LoginWithIdentity(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), res.GetUser().GetId())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("does not link unverified user", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byIdentity).WithArgs("google", "1234567890").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+
+		_, err := srv.LoginWithIdentity(context.Background(), req)
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("creates user", func(t *testing.T) {
+		srv, mock, sender := newMockServer(t)
+		mock.ExpectQuery(byIdentity).WithArgs("google", "1234567890").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnError(sql.ErrNoRows)
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO users (name, email, password, email_verified_at) VALUES (?, ?, ?, ?)").
+			WithArgs("John", "john@example.com", "", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectExec(link).WithArgs(2, "google", "1234567890", "john@example.com", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		expectCreateSession(mock, "john@example.com")
+		mock.ExpectQuery("SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id=r.id WHERE ur.user_id=? ORDER BY r.name").WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}))
+		mock.ExpectQuery("SELECT DISTINCT p.name FROM permissions p JOIN role_permissions rp ON rp.permission_id=p.id JOIN user_roles ur ON ur.role_id=rp.role_id WHERE ur.user_id=? ORDER BY p.name").WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}))
+
+		res, err := srv.LoginWithIdentity(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), res.GetUser().GetId())
+		require.NotNil(t, res.GetUser().GetEmailVerifiedAt())
+		require.Empty(t, sender.sent)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("locked user", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byIdentity).WithArgs("google", "1234567890").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", "hashed", 10, time.Now().Add(time.Minute), time.Now(), time.Now(), nil))
+
+		_, err := srv.LoginWithIdentity(context.Background(), req)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byIdentity).WithArgs("google", "1234567890").WillReturnError(sql.ErrNoRows)
+
+		_, err := srv.LoginWithIdentity(context.Background(), &pb.IdentityReq{Provider: "google", Subject: "1234567890", Email: "John <john@example.com>"})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/abedsully/golang-microservice/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// callLog collects what later interceptors learn about a call, such as the
+// authenticated user, for the call's log line.
+type callLog struct {
+	userID int64
+}
+
+type callLogKey struct{}
+
+func logCallUser(ctx context.Context, userID int64) {
+	if cl, ok := ctx.Value(callLogKey{}).(*callLog); ok {
+		cl.userID = userID
+	}
+}
+
+// LoggingUnaryInterceptor writes one log line per call, tagged with the
+// request ID forwarded by the gateway. Errors that are not gRPC statuses, and
+// internal ones, are logged with their full cause but returned to the caller
+// as a generic internal error carrying only the request ID. It must run
+// before the Authenticator so that rejected calls are logged as well.
+func LoggingUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, cl := withCallLog(ctx)
+
+		res, err := handler(ctx, req)
+
+		err = logCall(ctx, cl, info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+// LoggingStreamInterceptor is the streaming counterpart of
+// LoggingUnaryInterceptor.
+func LoggingStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, cl := withCallLog(ss.Context())
+
+		err := handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+
+		return logCall(ctx, cl, info.FullMethod, start, err)
+	}
+}
+
+func withCallLog(ctx context.Context) (context.Context, *callLog) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if id := firstMetadataValue(md, RequestIDHeader); id != "" {
+		ctx = logging.WithRequestID(ctx, id)
+	}
+
+	cl := &callLog{}
+	return context.WithValue(ctx, callLogKey{}, cl), cl
+}
+
+func logCall(ctx context.Context, cl *callLog, method string, start time.Time, err error) error {
+	code := status.Code(err)
+
+	level := slog.LevelInfo
+	switch {
+	case code == codes.Unknown || code == codes.Internal || code == codes.DataLoss:
+		level = slog.LevelError
+	case method == healthpb.Health_Check_FullMethodName && code == codes.OK:
+		level = slog.LevelDebug
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if cl.userID != 0 {
+		attrs = append(attrs, slog.Int64("user_id", cl.userID))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	slog.LogAttrs(ctx, level, "grpc call", attrs...)
+
+	if level == slog.LevelError {
+		return status.Errorf(codes.Internal, "internal error (request id: %s)", logging.RequestID(ctx))
+	}
+
+	return err
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/abedsully/golang-microservice/logging"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoggingUnaryInterceptor(t *testing.T) {
+	tcs := []struct {
+		name      string
+		err       error
+		wantCode  codes.Code
+		wantMsg   string
+		wantLevel string
+	}{
+		{
+			name:      "success",
+			wantCode:  codes.OK,
+			wantLevel: "INFO",
+		},
+		{
+			name:      "status errors are returned as is",
+			err:       status.Error(codes.NotFound, "order not found"),
+			wantCode:  codes.NotFound,
+			wantMsg:   "order not found",
+			wantLevel: "INFO",
+		},
+		{
+			name:      "other errors are hidden from the caller",
+			err:       errors.New("error getting order: connection refused"),
+			wantCode:  codes.Internal,
+			wantMsg:   "internal error (request id: req-1)",
+			wantLevel: "ERROR",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := slog.Default()
+			defer slog.SetDefault(prev)
+			var buf bytes.Buffer
+			slog.SetDefault(slog.New(logging.ContextHandler{Handler: slog.NewJSONHandler(&buf, nil)}))
+
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, "req-1"))
+			info := &grpc.UnaryServerInfo{FullMethod: "/pb.GolangMicroservice/GetOrder"}
+
+			_, err := LoggingUnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				logCallUser(ctx, 9)
+				return nil, tc.err
+			})
+
+			st := status.Convert(err)
+			require.Equal(t, tc.wantCode, st.Code())
+			require.Equal(t, tc.wantMsg, st.Message())
+
+			var rec map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+			require.Equal(t, "grpc call", rec["msg"])
+			require.Equal(t, tc.wantLevel, rec["level"])
+			require.Equal(t, "req-1", rec["request_id"])
+			require.Equal(t, float64(9), rec["user_id"])
+			if tc.err != nil {
+				require.Equal(t, tc.err.Error(), rec["error"])
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/password"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Sessions configures the refresh tokens sessions are renewed with.
+type Sessions struct {
+	// RefreshTokenTTL is how long a refresh token can be used. Every renewal
+	// hands out a new one.
+	RefreshTokenTTL time.Duration
+}
+
+// Login checks the email and password of a user logging in and starts a
+// session. Users with two-factor authentication get no session yet, they
+// complete the login with LoginMFA.
+//
+// Unknown emails and wrong passwords fail alike with Unauthenticated, and take
+// as long, as unknown emails are checked against a dummy hash. Wrong passwords
+// count towards the lockout. Only the right password of a locked account
+// fails with ResourceExhausted, with a RetryInfo detail telling the time left
+// on the lock, so that the lock does not reveal that an account exists.
+func (s *Server) Login(ctx context.Context, r *pb.LoginReq) (*pb.LoginRes, error) {
+	user, err := s.storer.GetUser(ctx, r.GetEmail())
+	if errors.Is(err, sql.ErrNoRows) {
+		password.Verify(r.GetPassword(), s.dummyPasswordHash())
+		metrics.LoginFailed(metrics.LoginFailureUnknownUser)
+		return nil, status.Error(codes.Unauthenticated, "invalid email or password")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.verifyPassword(r.GetPassword(), user.Password)
+	if errors.Is(err, password.ErrMismatch) {
+		if isLocked(user) {
+			// wrong passwords neither extend the lock nor learn of it
+			metrics.LoginFailed(metrics.LoginFailureLocked)
+			return nil, status.Error(codes.Unauthenticated, "invalid email or password")
+		}
+		metrics.LoginFailed(metrics.LoginFailureWrongPassword)
+		if _, err := s.recordFailedLogin(ctx, user); err != nil {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid email or password")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLocked(user); err != nil {
+		return nil, err
+	}
+	s.upgradePasswordHash(ctx, user, r.GetPassword())
+
+	return s.login(ctx, user)
+}
+
+// LoginMFA completes the login of a user with two-factor authentication,
+// whose password Login checked, with a code of the user's authenticator app
+// or a recovery code. Wrong codes count towards the lockout like wrong
+// passwords. NotFound is returned if the user was deleted or turned
+// two-factor authentication off since, and has to log in again.
+func (s *Server) LoginMFA(ctx context.Context, r *pb.TOTPReq) (*pb.LoginRes, error) {
+	user, err := s.storer.GetUserByID(ctx, r.GetUserId())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "user %d not found", r.GetUserId())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, status.Error(codes.NotFound, "two-factor authentication is not enabled")
+	}
+	if err := checkLocked(user); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, r.GetCode())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		metrics.LoginFailed(metrics.LoginFailureWrongMFACode)
+		return nil, s.failLogin(ctx, user, "invalid code")
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// login starts a session for a user whose credentials were checked, unless
+// the user has to enter a second factor first.
+func (s *Server) login(ctx context.Context, user *storer.User) (*pb.LoginRes, error) {
+	if user.TOTPEnabledAt != nil {
+		return &pb.LoginRes{User: toPBUserRes(user), MfaRequired: true}, nil
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// startSession clears the failed logins of the user and starts a session
+// with a new refresh token. Only the hash of the token is stored.
+func (s *Server) startSession(ctx context.Context, user *storer.User) (*pb.LoginRes, error) {
+	if s.cfg.EmailVerification.Require == VerificationBeforeLogin {
+		if err := requireVerifiedEmail(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		if err := s.storer.ResetFailedLogins(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.FailedLoginAttempts = 0
+		user.LockedUntil = nil
+	}
+
+	refreshToken, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// every refresh token the session is renewed with belongs to the same
+	// family, which names the session in tokens and to users
+	sess, err := s.storer.CreateSession(ctx, withCaller(ctx, &storer.Session{
+		ID:        hash,
+		FamilyID:  uuid.NewString(),
+		UserEmail: user.Email,
+		ExpiresAt: time.Now().Add(s.cfg.Sessions.RefreshTokenTTL),
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	ur, err := s.withAccess(ctx, toPBUserRes(user))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LoginRes{
+		User:                  ur,
+		SessionId:             sess.FamilyID,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(sess.ExpiresAt),
+	}, nil
+}
+
+// failLogin counts a failed login of the user and returns the error to fail
+// the login with, telling when the account can log in again if the failure
+// locked it.
+func (s *Server) failLogin(ctx context.Context, user *storer.User, msg string) error {
+	lockedUntil, err := s.recordFailedLogin(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	if lockedUntil != nil {
+		return lockedError(codes.Unauthenticated, msg, *lockedUntil)
+	}
+
+	return status.Error(codes.Unauthenticated, msg)
+}
+
+// recordFailedLogin counts a failed login of the user, which locks the
+// account once the LoginLockout threshold is reached. The end of the lock is
+// returned if the account is locked now.
+func (s *Server) recordFailedLogin(ctx context.Context, user *storer.User) (*time.Time, error) {
+	failed, err := s.storer.RecordFailedLogin(ctx, user.ID, s.cfg.Lockout.MaxAttempts, s.cfg.Lockout.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isLocked(failed) {
+		return nil, nil
+	}
+
+	slog.InfoContext(ctx, "locked account after failed logins", "target_user_id", user.ID, "attempts", failed.FailedLoginAttempts)
+	return failed.LockedUntil, nil
+}
+
+// checkLocked fails the login of a locked account.
+func checkLocked(user *storer.User) error {
+	if !isLocked(user) {
+		return nil
+	}
+
+	metrics.LoginFailed(metrics.LoginFailureLocked)
+	return lockedError(codes.ResourceExhausted, "account locked", *user.LockedUntil)
+}
+
+func isLocked(user *storer.User) bool {
+	return user.LockedUntil != nil && user.LockedUntil.After(time.Now())
+}
+
+// lockedError returns an error telling the client when a locked account can
+// log in again.
+func lockedError(code codes.Code, msg string, lockedUntil time.Time) error {
+	st, err := status.New(code, msg).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(time.Until(lockedUntil)),
+	})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+
+	return st.Err()
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/password"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const insertSessionQuery = "INSERT INTO sessions (id, family_id, user_email, is_revoked, user_agent, ip_address, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+func expectCreateSession(mock sqlmock.Sqlmock, email string) {
+	mock.ExpectExec(insertSessionQuery).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), email, false, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectFailedLogin(mock sqlmock.Sqlmock, row *sqlmock.Rows) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM users WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(row)
+	mock.ExpectExec("UPDATE users SET failed_login_attempts=?, locked_until=? WHERE id=?").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func loginUserRow(hash string, failed int64, lockedUntil, totpEnabledAt driver.Value) *sqlmock.Rows {
+	return sqlmock.NewRows(mfaUserCols).AddRow(1, "John", "john@example.com", hash, failed, lockedUntil, nil, time.Now(), nil, testTOTPSecret, totpEnabledAt, nil)
+}
+
+func retryDelay(t *testing.T, err error) time.Duration {
+	t.Helper()
+
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			return ri.GetRetryDelay().AsDuration()
+		}
+	}
+	return 0
+}
+
+func TestLogin(t *testing.T) {
+	const byEmail = "SELECT * FROM users WHERE email=?"
+
+	bcryptHash, err := password.DefaultBcrypt().Hash("correct horse")
+	require.NoError(t, err)
+
+	t.Run("starts session", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		hash, err := srv.cfg.Passwords.Hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		var sessionID string
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(hash, 0, nil, nil))
+		mock.ExpectExec(insertSessionQuery).
+			WithArgs(tokenHashArg{&sessionID}, sqlmock.AnyArg(), "john@example.com", false, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectNoAccess(mock)
+
+		res, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), res.GetUser().GetId())
+		require.False(t, res.GetMfaRequired())
+		require.NotEmpty(t, res.GetSessionId())
+		require.Equal(t, hashSecretToken(res.GetRefreshToken()), sessionID)
+		require.WithinDuration(t, time.Now().Add(srv.cfg.Sessions.RefreshTokenTTL), res.GetRefreshTokenExpiresAt().AsTime(), time.Minute)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("upgrades bcrypt hash", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		var upgraded string
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(bcryptHash, 0, nil, nil))
+		mock.ExpectExec("UPDATE users SET password=? WHERE id=? AND password=?").WithArgs(tokenHashArg{&upgraded}, 1, bcryptHash).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		require.True(t, strings.HasPrefix(upgraded, "$argon2id$"))
+		require.NoError(t, password.Verify("correct horse", upgraded))
+	})
+
+	t.Run("resets failed logins", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		hash, err := srv.cfg.Passwords.Hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(hash, 3, nil, nil))
+		mock.ExpectExec("UPDATE users SET failed_login_attempts=0, locked_until=NULL WHERE id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		res, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.NoError(t, err)
+		require.Zero(t, res.GetUser().GetFailedLoginAttempts())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("mfa required", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(bcryptHash, 0, nil, time.Now()))
+		mock.ExpectExec("UPDATE users SET password=? WHERE id=? AND password=?").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		res, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.NoError(t, err)
+		require.True(t, res.GetMfaRequired())
+		require.Empty(t, res.GetRefreshToken())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byEmail).WithArgs("jane@example.com").WillReturnError(sql.ErrNoRows)
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "jane@example.com", Password: "correct horse"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NotEmpty(t, srv.dummyHash, "unknown emails are checked against a dummy hash")
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(bcryptHash, 0, nil, nil))
+		expectFailedLogin(mock, loginUserRow(bcryptHash, 0, nil, nil))
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "battery staple"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.Zero(t, retryDelay(t, err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("wrong password locks account quietly", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(bcryptHash, 9, nil, nil))
+		expectFailedLogin(mock, loginUserRow(bcryptHash, 9, nil, nil))
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "battery staple"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.Zero(t, retryDelay(t, err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("locked account", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(bcryptHash, 10, time.Now().Add(5*time.Minute), nil))
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.InDelta(t, 5*time.Minute, retryDelay(t, err), float64(time.Minute))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("locked account with wrong password", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow(bcryptHash, 10, time.Now().Add(5*time.Minute), nil))
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "battery staple"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.Equal(t, "invalid email or password", status.Convert(err).Message())
+		require.Zero(t, retryDelay(t, err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no password", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery(byEmail).WithArgs("john@example.com").WillReturnRows(loginUserRow("", 0, nil, nil))
+		expectFailedLogin(mock, loginUserRow("", 0, nil, nil))
+
+		_, err := srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: ""})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestLoginMFA(t *testing.T) {
+	step := time.Now().Unix() / totpPeriod
+	code, err := totp.GenerateCode(testTOTPSecret, time.Unix(step*totpPeriod, 0))
+	require.NoError(t, err)
+
+	t.Run("totp code", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, time.Now()))
+		mock.ExpectExec("UPDATE users SET totp_last_step=? WHERE id=? AND totp_enabled_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < ?)").
+			WithArgs(step, 1, step).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		res, err := srv.LoginMFA(context.Background(), &pb.TOTPReq{UserId: 1, Code: code})
+		require.NoError(t, err)
+		require.True(t, res.GetUser().GetTotpEnabled())
+		require.NotEmpty(t, res.GetRefreshToken())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reused totp code", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, time.Now()))
+		mock.ExpectExec("UPDATE users SET totp_last_step=? WHERE id=? AND totp_enabled_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < ?)").
+			WithArgs(step, 1, step).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectFailedLogin(mock, mfaUserRow(testTOTPSecret, time.Now()))
+
+		_, err := srv.LoginMFA(context.Background(), &pb.TOTPReq{UserId: 1, Code: code})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, time.Now()))
+		mock.ExpectExec("UPDATE mfa_recovery_codes SET used_at=? WHERE user_id=? AND code_hash=? AND used_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1, hashSecretToken("0a1b2c3d4e")).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		_, err := srv.LoginMFA(context.Background(), &pb.TOTPReq{UserId: 1, Code: "0A1B2-C3D4E"})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, time.Now()))
+		mock.ExpectExec("UPDATE mfa_recovery_codes SET used_at=? WHERE user_id=? AND code_hash=? AND used_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectFailedLogin(mock, mfaUserRow(testTOTPSecret, time.Now()))
+
+		_, err := srv.LoginMFA(context.Background(), &pb.TOTPReq{UserId: 1, Code: "12345"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("locked account", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(loginUserRow("hashed", 10, time.Now().Add(time.Minute), time.Now()))
+
+		_, err := srv.LoginMFA(context.Background(), &pb.TOTPReq{UserId: 1, Code: code})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, nil))
+
+		_, err := srv.LoginMFA(context.Background(), &pb.TOTPReq{UserId: 1, Code: code})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -1,11 +1,11 @@
 package server
 
 import (
+	"strings"
 	"time"
 
 	"github.com/abedsully/golang-microservice/grpc/pb"
 	"github.com/abedsully/golang-microservice/grpc/storer"
-	"github.com/abedsully/golang-microservice/util"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -106,6 +106,8 @@ func toPBOrderRes(o *storer.Order) *pb.OrderRes {
 		TaxPrice:      o.TaxPrice,
 		ShippingPrice: o.ShippingPrice,
 		TotalPrice:    o.TotalPrice,
+		UserId:        o.UserID,
+		Status:        o.Status,
 		CreatedAt:     timestamppb.New(o.CreatedAt),
 	}
 	if o.UpdatedAt != nil {
@@ -134,18 +136,25 @@ func toStorerUser(u *pb.UserReq) *storer.User {
 		Name:     u.Name,
 		Email:    u.Email,
 		Password: u.Password,
-		IsAdmin:  u.IsAdmin,
 	}
 }
 
 func toPBUserRes(u *storer.User) *pb.UserRes {
-	return &pb.UserRes{
-		Id:       u.ID,
-		Name:     u.Name,
-		Email:    u.Email,
-		Password: u.Password,
-		IsAdmin:  u.IsAdmin,
+	res := &pb.UserRes{
+		Id:                  u.ID,
+		Name:                u.Name,
+		Email:               u.Email,
+		FailedLoginAttempts: u.FailedLoginAttempts,
+		TotpEnabled:         u.TOTPEnabledAt != nil,
 	}
+	if u.LockedUntil != nil {
+		res.LockedUntil = timestamppb.New(*u.LockedUntil)
+	}
+	if u.EmailVerifiedAt != nil {
+		res.EmailVerifiedAt = timestamppb.New(*u.EmailVerifiedAt)
+	}
+
+	return res
 }
 
 func patchUserReq(user *storer.User, u *pb.UserReq) {
@@ -155,15 +164,113 @@ func patchUserReq(user *storer.User, u *pb.UserReq) {
 	if u.Email != "" {
 		user.Email = u.Email
 	}
-	if u.Password != "" {
-		hashed, err := util.HashPassword(u.Password)
-		if err != nil {
-			panic(err)
+	user.UpdatedAt = toTimePtr(time.Now())
+}
+
+func toPBWebhookRes(ws *storer.WebhookSubscription) *pb.WebhookRes {
+	res := &pb.WebhookRes{
+		Id:                  ws.ID,
+		Url:                 ws.URL,
+		EventTypes:          splitList(ws.EventTypes),
+		IsActive:            ws.IsActive,
+		ConsecutiveFailures: ws.ConsecutiveFailures,
+		CreatedAt:           timestamppb.New(ws.CreatedAt),
+	}
+	if ws.DisabledAt != nil {
+		res.DisabledAt = timestamppb.New(*ws.DisabledAt)
+	}
+	if ws.UpdatedAt != nil {
+		res.UpdatedAt = timestamppb.New(*ws.UpdatedAt)
+	}
+
+	return res
+}
+
+func patchWebhookReq(ws *storer.WebhookSubscription, w *pb.WebhookReq) {
+	if w.Url != "" {
+		ws.URL = w.Url
+	}
+	if len(w.EventTypes) > 0 {
+		ws.EventTypes = strings.Join(w.EventTypes, ",")
+	}
+	if w.IsActive != nil {
+		// re-enabling a subscription starts a fresh failure streak
+		if *w.IsActive && !ws.IsActive {
+			ws.ConsecutiveFailures = 0
+			ws.DisabledAt = nil
 		}
-		user.Password = hashed
+		ws.IsActive = *w.IsActive
 	}
-	if u.IsAdmin {
-		user.IsAdmin = u.IsAdmin
+	ws.UpdatedAt = toTimePtr(time.Now())
+}
+
+// splitList splits the comma separated lists webhook event types and API key
+// scopes are stored as.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
 	}
-	user.UpdatedAt = toTimePtr(time.Now())
-}
\ No newline at end of file
+	return strings.Split(list, ",")
+}
+
+func toPBAPIKeyRes(k *storer.APIKey) *pb.APIKeyRes {
+	res := &pb.APIKeyRes{
+		Id:        k.ID,
+		Name:      k.Name,
+		Prefix:    APIKeyPrefix + k.Prefix,
+		UserId:    k.UserID,
+		Scopes:    splitList(k.Scopes),
+		CreatedAt: timestamppb.New(k.CreatedAt),
+	}
+	if k.ExpiresAt != nil {
+		res.ExpiresAt = timestamppb.New(*k.ExpiresAt)
+	}
+	if k.LastUsedAt != nil {
+		res.LastUsedAt = timestamppb.New(*k.LastUsedAt)
+	}
+	if k.RevokedAt != nil {
+		res.RevokedAt = timestamppb.New(*k.RevokedAt)
+	}
+
+	return res
+}
+
+func toPBWebhookDeliveryRes(d *storer.WebhookDelivery) *pb.WebhookDeliveryRes {
+	res := &pb.WebhookDeliveryRes{
+		Id:            d.ID,
+		WebhookId:     d.SubscriptionID,
+		EventId:       d.EventID,
+		EventType:     d.EventType,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		NextAttemptAt: timestamppb.New(d.NextAttemptAt),
+		CreatedAt:     timestamppb.New(d.CreatedAt),
+	}
+	if d.ResponseCode != nil {
+		res.ResponseCode = *d.ResponseCode
+	}
+	if d.LastError != nil {
+		res.LastError = *d.LastError
+	}
+	if d.DeliveredAt != nil {
+		res.DeliveredAt = timestamppb.New(*d.DeliveredAt)
+	}
+
+	return res
+}
+
+func toPBSessionInfo(s *storer.Session, currentID string) *pb.SessionInfo {
+	info := &pb.SessionInfo{
+		Id:        s.FamilyID,
+		UserAgent: s.UserAgent,
+		IpAddress: s.IPAddress,
+		CreatedAt: timestamppb.New(s.CreatedAt),
+		ExpiresAt: timestamppb.New(s.ExpiresAt),
+		Current:   currentID != "" && s.FamilyID == currentID,
+	}
+	if s.LastUsedAt != nil {
+		info.LastUsedAt = timestamppb.New(*s.LastUsedAt)
+	}
+
+	return info
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/pquerna/otp/totp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MFA configures two-factor authentication with authenticator apps (TOTP,
+// RFC 6238).
+type MFA struct {
+	// Issuer names the service in authenticator apps.
+	Issuer string
+	// RecoveryCodes is the number of one-time recovery codes handed out when
+	// an enrollment is confirmed.
+	RecoveryCodes int
+}
+
+// totpPeriod is the lifetime of a code in seconds. Codes of the steps before
+// and after the current one are accepted too, for clock skew.
+const totpPeriod = 30
+
+// EnrollTOTP starts the enrollment of an authenticator app for the caller and
+// returns its secret and otpauth URI, usually shown as a QR code. Codes are
+// not required before the enrollment is confirmed with ConfirmTOTP; starting
+// over replaces the secret.
+func (s *Server) EnrollTOTP(ctx context.Context, _ *pb.TOTPReq) (*pb.TOTPEnrollmentRes, error) {
+	user, err := s.mfaCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.cfg.MFA.Issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating totp secret: %w", err)
+	}
+
+	err = s.storer.StartTOTPEnrollment(ctx, user.ID, key.Secret())
+	if errors.Is(err, storer.ErrTOTPEnabled) {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.TOTPEnrollmentRes{
+		Secret: key.Secret(),
+		Uri:    key.URL(),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication for the caller once the
+// first code of the enrolled app is entered, and returns the recovery codes.
+// They are only stored hashed, so this is the only time they are shown.
+func (s *Server) ConfirmTOTP(ctx context.Context, r *pb.TOTPReq) (*pb.TOTPRecoveryCodesRes, error) {
+	user, err := s.mfaCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication enrollment has not been started")
+	}
+
+	step, ok := matchTOTP(*user.TOTPSecret, r.GetCode(), time.Now())
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid code")
+	}
+
+	recoveryCodes, hashes, err := newRecoveryCodes(s.cfg.MFA.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storer.EnableTOTP(ctx, user.ID, step, hashes, time.Now())
+	if errors.Is(err, storer.ErrTOTPEnabled) {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is already enabled")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "enabled two-factor authentication", "target_user_id", user.ID)
+
+	return &pb.TOTPRecoveryCodesRes{RecoveryCodes: recoveryCodes}, nil
+}
+
+// DisableTOTP turns two-factor authentication off for the caller, who has to
+// enter a current code or a recovery code.
+func (s *Server) DisableTOTP(ctx context.Context, r *pb.TOTPReq) (*pb.UserRes, error) {
+	user, err := s.mfaCaller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, status.Error(codes.FailedPrecondition, "two-factor authentication is not enabled")
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, r.GetCode())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "invalid code")
+	}
+
+	if err := s.storer.DisableTOTP(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = nil
+	user.TOTPEnabledAt = nil
+
+	slog.InfoContext(ctx, "disabled two-factor authentication", "target_user_id", user.ID)
+
+	return s.withAccess(ctx, toPBUserRes(user))
+}
+
+// mfaCaller returns the user the call was made by. Two-factor authentication
+// can only be managed by users themselves, never with an API key.
+func (s *Server) mfaCaller(ctx context.Context) (*storer.User, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if claims.APIKeyPrefix != "" {
+		return nil, status.Error(codes.PermissionDenied, "api keys can not manage two-factor authentication")
+	}
+
+	user, err := s.storer.GetUserByID(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkSecondFactor reports whether code is an unused code of the user's
+// authenticator app or recovery codes, and uses it up if so.
+func (s *Server) checkSecondFactor(ctx context.Context, user *storer.User, code string) (bool, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if code == "" {
+		return false, nil
+	}
+
+	if step, ok := matchTOTP(*user.TOTPSecret, code, time.Now()); ok {
+		return s.storer.UseTOTPStep(ctx, user.ID, step)
+	}
+
+	return s.storer.UseRecoveryCode(ctx, user.ID, hashSecretToken(normalizeRecoveryCode(code)), time.Now())
+}
+
+// matchTOTP reports whether code is the code of secret at now, or of the
+// steps right before or after it, and returns the step it belongs to.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current, current - 1, current + 1} {
+		want, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totp.ValidateOpts{Period: totpPeriod})
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// newRecoveryCodes returns n random codes formatted as xxxxx-xxxxx and the
+// hashes they are stored as.
+func newRecoveryCodes(n int) (recoveryCodes, hashes []string, err error) {
+	for range n {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+
+		code := hex.EncodeToString(b)
+		recoveryCodes = append(recoveryCodes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashSecretToken(code))
+	}
+
+	return recoveryCodes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case and dashes, as users may type them
+// either way.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
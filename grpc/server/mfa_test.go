@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var mfaUserCols = []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at", "totp_secret", "totp_enabled_at", "totp_last_step"}
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func mfaUserRow(secret, enabledAt driver.Value) *sqlmock.Rows {
+	return sqlmock.NewRows(mfaUserCols).AddRow(1, "John", "john@example.com", "hashed", 0, nil, nil, time.Now(), nil, secret, enabledAt, nil)
+}
+
+func expectNoAccess(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id=r.id WHERE ur.user_id=? ORDER BY r.name").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+	mock.ExpectQuery("SELECT DISTINCT p.name FROM permissions p JOIN role_permissions rp ON rp.permission_id=p.id JOIN user_roles ur ON ur.role_id=rp.role_id WHERE ur.user_id=? ORDER BY p.name").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}))
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(nil, nil))
+		mock.ExpectExec("UPDATE users SET totp_secret=?, totp_last_step=NULL WHERE id=? AND totp_enabled_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		res, err := srv.EnrollTOTP(userContext(""), &pb.TOTPReq{})
+		require.NoError(t, err)
+		require.NotEmpty(t, res.GetSecret())
+		require.True(t, strings.HasPrefix(res.GetUri(), "otpauth://totp/golang-microservice:john@example.com?"))
+		require.Contains(t, res.GetUri(), "secret="+res.GetSecret())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, time.Now()))
+
+		_, err := srv.EnrollTOTP(userContext(""), &pb.TOTPReq{})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("api key", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		ctx := context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1, APIKeyPrefix: "0123456789abcdef"})
+
+		_, err := srv.EnrollTOTP(ctx, &pb.TOTPReq{})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	step := time.Now().Unix() / totpPeriod
+	code, err := totp.GenerateCode(testTOTPSecret, time.Unix(step*totpPeriod, 0))
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, nil))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET totp_enabled_at=?, totp_last_step=? WHERE id=? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), step, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM mfa_recovery_codes WHERE user_id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		for range DefaultConfig().MFA.RecoveryCodes {
+			mock.ExpectExec("INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)").
+				WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+
+		res, err := srv.ConfirmTOTP(userContext(""), &pb.TOTPReq{Code: code})
+		require.NoError(t, err)
+		require.Len(t, res.GetRecoveryCodes(), DefaultConfig().MFA.RecoveryCodes)
+		require.Regexp(t, "^[0-9a-f]{5}-[0-9a-f]{5}$", res.GetRecoveryCodes()[0])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(testTOTPSecret, nil))
+
+		_, err := srv.ConfirmTOTP(userContext(""), &pb.TOTPReq{Code: "000000x"})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not enrolled", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(mfaUserRow(nil, nil))
+
+		_, err := srv.ConfirmTOTP(userContext(""), &pb.TOTPReq{Code: code})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / totpPeriod
+
+	for _, offset := range []int64{-1, 0, 1} {
+		code, err := totp.GenerateCode(testTOTPSecret, now.Add(time.Duration(offset*totpPeriod)*time.Second))
+		require.NoError(t, err)
+
+		got, ok := matchTOTP(testTOTPSecret, code, now)
+		require.True(t, ok)
+		require.Equal(t, step+offset, got)
+	}
+
+	code, err := totp.GenerateCode(testTOTPSecret, now.Add(2*totpPeriod*time.Second))
+	require.NoError(t, err)
+	_, ok := matchTOTP(testTOTPSecret, code, now)
+	require.False(t, ok)
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/mail"
+	"github.com/abedsully/golang-microservice/password"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PasswordReset configures the reset links mailed to users. The token is
+// added to URL as the token query parameter and can be used once within TTL.
+type PasswordReset struct {
+	URL string
+	TTL time.Duration
+}
+
+// Passwords configures how passwords are hashed and which ones users may
+// choose. Hashes of other algorithms or parameters are replaced when their
+// users log in.
+type Passwords struct {
+	Hasher password.Hasher
+	Policy password.Policy
+}
+
+// hashNewPassword checks a password the user with the email address chose
+// against the policy, failing with InvalidArgument, and hashes it.
+func (s *Server) hashNewPassword(pw, email string) (string, error) {
+	if err := s.cfg.Passwords.Policy.Check(pw, email); err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	hashed, err := s.cfg.Passwords.Hasher.Hash(pw)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+
+	return hashed, nil
+}
+
+// dummyPasswordHash returns a hash of a random password made by the
+// configured hasher, which logins of users without a password are checked
+// against so that they take as long as those of users with one.
+func (s *Server) dummyPasswordHash() string {
+	s.dummyHashOnce.Do(func() {
+		pw, _, err := newSecretToken()
+		if err == nil {
+			s.dummyHash, err = s.cfg.Passwords.Hasher.Hash(pw)
+		}
+		if err != nil {
+			slog.Error("error making dummy password hash", "error", err)
+		}
+	})
+
+	return s.dummyHash
+}
+
+// verifyPassword checks pw against hash like password.Verify, checking it
+// against the dummy hash if the user has no password.
+func (s *Server) verifyPassword(pw, hash string) error {
+	if hash == "" {
+		password.Verify(pw, s.dummyPasswordHash())
+		return password.ErrMismatch
+	}
+
+	return password.Verify(pw, hash)
+}
+
+// upgradePasswordHash replaces the hash of a user who logged in with pw if it
+// was made with an outdated algorithm or parameters. The login succeeds
+// either way, the hash is upgraded next time.
+func (s *Server) upgradePasswordHash(ctx context.Context, user *storer.User, pw string) {
+	if !s.cfg.Passwords.Hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashed, err := s.cfg.Passwords.Hasher.Hash(pw)
+	if err == nil {
+		err = s.storer.UpdatePasswordHash(ctx, user.ID, user.Password, hashed)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error upgrading password hash", "target_user_id", user.ID, "error", err)
+	}
+}
+
+// ChangePassword sets a new password for the caller, who has to know the
+// current one, and revokes all other sessions of the caller. The session the
+// password is changed from stays logged in. Wrong current passwords count
+// towards the lockout like wrong passwords at login, so that a stolen session
+// can not be used to guess the password, and locked accounts can not change
+// their password until the lock ends.
+func (s *Server) ChangePassword(ctx context.Context, r *pb.ChangePasswordReq) (*pb.RevokeSessionsRes, error) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.APIKeyPrefix != "" {
+		return nil, status.Error(codes.PermissionDenied, "passwords can only be changed by their users")
+	}
+
+	user, err := s.storer.GetUserByID(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "user %d not found", claims.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if isLocked(user) {
+		return nil, lockedError(codes.ResourceExhausted, "account locked", *user.LockedUntil)
+	}
+
+	err = password.Verify(r.GetCurrentPassword(), user.Password)
+	if errors.Is(err, password.ErrMismatch) {
+		lockedUntil, err := s.recordFailedLogin(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		if lockedUntil != nil {
+			return nil, lockedError(codes.PermissionDenied, "current password is wrong", *lockedUntil)
+		}
+		return nil, status.Error(codes.PermissionDenied, "current password is wrong")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := s.hashNewPassword(r.GetNewPassword(), user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := s.storer.ChangePassword(ctx, user, hashed, claims.SessionID)
+	if errors.Is(err, storer.ErrPasswordChanged) {
+		return nil, status.Error(codes.Aborted, "password was changed meanwhile, try again")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.FailedLoginAttempts > 0 {
+		if err := s.storer.ResetFailedLogins(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.InfoContext(ctx, "changed password", "target_user_id", user.ID, "revoked_sessions", revoked)
+
+	return &pb.RevokeSessionsRes{Revoked: revoked}, nil
+}
+
+// RequestPasswordReset mails a reset link to the user with the given email.
+// Unknown emails succeed without sending anything, so that callers cannot
+// tell which emails are registered.
+func (s *Server) RequestPasswordReset(ctx context.Context, r *pb.PasswordResetReq) (*pb.PasswordResetRes, error) {
+	user, err := s.storer.GetUser(ctx, r.GetEmail())
+	if errors.Is(err, sql.ErrNoRows) {
+		return &pb.PasswordResetRes{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := s.issueUserToken(ctx, storer.PasswordResetTokens, user, s.cfg.PasswordReset.URL, s.cfg.PasswordReset.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nopen the link below within %s to choose a new password:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Name, s.cfg.PasswordReset.TTL, link),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error sending password reset mail: %w", err)
+	}
+
+	return &pb.PasswordResetRes{}, nil
+}
+
+// ResetPassword sets a new password with a token from a reset link and revokes
+// all sessions of the user.
+func (s *Server) ResetPassword(ctx context.Context, r *pb.PasswordResetReq) (*pb.PasswordResetRes, error) {
+	if r.GetToken() == "" || r.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token and password are required")
+	}
+
+	// the policy needs the email address, so the token is looked up before
+	// the password is hashed, which happens outside of the transaction that
+	// uses the token up
+	tokenHash := hashSecretToken(r.GetToken())
+	user, err := s.storer.GetUserByToken(ctx, storer.PasswordResetTokens, tokenHash, time.Now())
+	if errors.Is(err, storer.ErrInvalidToken) {
+		return nil, status.Error(codes.InvalidArgument, storer.ErrInvalidToken.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashed, err := s.hashNewPassword(r.GetPassword(), user.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err = s.storer.ResetPassword(ctx, tokenHash, hashed)
+	if errors.Is(err, storer.ErrInvalidToken) {
+		return nil, status.Error(codes.InvalidArgument, storer.ErrInvalidToken.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.PasswordResetRes{Email: user.Email}, nil
+}
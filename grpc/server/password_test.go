@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/mail"
+	"github.com/abedsully/golang-microservice/password"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type recordingSender struct {
+	sent []mail.Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, m mail.Message) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func newMockServer(t *testing.T) (*Server, sqlmock.Sqlmock, *recordingSender) {
+	t.Helper()
+
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() { mockDB.Close() })
+
+	sender := &recordingSender{}
+	st := storer.NewMySqlStorer(sqlx.NewDb(mockDB, "sqlmock"))
+	return NewServer(st, sender, DefaultConfig()), mock, sender
+}
+
+// tokenHashArg matches the stored hash against the token mailed to the user,
+// which is only known once the mail was sent.
+type tokenHashArg struct {
+	hash *string
+}
+
+func (a tokenHashArg) Match(v driver.Value) bool {
+	*a.hash, _ = v.(string)
+	return true
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+
+	t.Run("registered email", func(t *testing.T) {
+		srv, mock, sender := newMockServer(t)
+
+		var storedHash string
+		mock.ExpectQuery("SELECT * FROM users WHERE email=?").WithArgs("john@example.com").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM password_reset_tokens WHERE user_id=? AND (used_at IS NOT NULL OR expires_at<=?)").WithArgs(1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)").WithArgs(1, tokenHashArg{&storedHash}, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		_, err := srv.RequestPasswordReset(context.Background(), &pb.PasswordResetReq{Email: "john@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		require.Len(t, sender.sent, 1)
+		require.Equal(t, "john@example.com", sender.sent[0].To)
+
+		// the mail carries the token, the database only its hash
+		var link *url.URL
+		for _, field := range strings.Fields(sender.sent[0].Body) {
+			if strings.HasPrefix(field, "http") {
+				link, err = url.Parse(field)
+				require.NoError(t, err)
+			}
+		}
+		require.NotNil(t, link)
+		token := link.Query().Get("token")
+		require.NotEmpty(t, token)
+		require.Equal(t, hashSecretToken(token), storedHash)
+		require.NotContains(t, sender.sent[0].Body, storedHash)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		srv, mock, sender := newMockServer(t)
+
+		mock.ExpectQuery("SELECT * FROM users WHERE email=?").WithArgs("jane@example.com").WillReturnRows(sqlmock.NewRows(userCols))
+
+		_, err := srv.RequestPasswordReset(context.Background(), &pb.PasswordResetReq{Email: "jane@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+		require.Empty(t, sender.sent)
+	})
+}
+
+const getUserByResetToken = "SELECT u.* FROM users u JOIN password_reset_tokens t ON t.user_id=u.id WHERE t.token_hash=? AND t.used_at IS NULL AND t.expires_at>?"
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	srv, mock, _ := newMockServer(t)
+
+	mock.ExpectQuery(getUserByResetToken).WithArgs(hashSecretToken("used"), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(mfaUserCols))
+
+	_, err := srv.ResetPassword(context.Background(), &pb.PasswordResetReq{Token: "used", Password: "new-password"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordPolicy(t *testing.T) {
+	srv, mock, _ := newMockServer(t)
+
+	// the token is neither used up nor locked
+	mock.ExpectQuery(getUserByResetToken).WithArgs(hashSecretToken("token"), sqlmock.AnyArg()).WillReturnRows(mfaUserRow(nil, nil))
+
+	_, err := srv.ResetPassword(context.Background(), &pb.PasswordResetReq{Token: "token", Password: "john-secret"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "email")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword(t *testing.T) {
+	srv, mock, _ := newMockServer(t)
+
+	var hashed string
+	mock.ExpectQuery(getUserByResetToken).WithArgs(hashSecretToken("token"), sqlmock.AnyArg()).WillReturnRows(mfaUserRow(nil, nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT * FROM password_reset_tokens WHERE token_hash=? FOR UPDATE").WithArgs(hashSecretToken("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "token_hash", "created_at", "expires_at", "used_at"}).
+			AddRow(1, 1, hashSecretToken("token"), time.Now(), time.Now().Add(time.Hour), nil))
+	mock.ExpectExec("UPDATE password_reset_tokens SET used_at=? WHERE user_id=? AND used_at IS NULL").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT * FROM users WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(mfaUserRow(nil, nil))
+	mock.ExpectExec("UPDATE users SET password=?, failed_login_attempts=?, locked_until=?, updated_at=? WHERE id=?").
+		WithArgs(tokenHashArg{&hashed}, 0, nil, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=?").WithArgs("john@example.com").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	res, err := srv.ResetPassword(context.Background(), &pb.PasswordResetReq{Token: "token", Password: "correct horse battery"})
+	require.NoError(t, err)
+	require.Equal(t, "john@example.com", res.GetEmail())
+	require.NoError(t, mock.ExpectationsWereMet())
+	require.NoError(t, password.Verify("correct horse battery", hashed))
+}
+
+func TestCreateUserPasswordPolicy(t *testing.T) {
+	tcs := []struct {
+		name     string
+		password string
+	}{
+		{name: "too short", password: "s3cr3t"},
+		{name: "common", password: "password123"},
+		{name: "contains email", password: "JohnDoe-2024"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, mock, sender := newMockServer(t)
+
+			_, err := srv.CreateUser(context.Background(), &pb.UserReq{Name: "John", Email: "johndoe@example.com", Password: tc.password})
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+			require.NoError(t, mock.ExpectationsWereMet())
+			require.Empty(t, sender.sent)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	const (
+		changePassword = "UPDATE users SET password=?, updated_at=? WHERE id=? AND password=?"
+		revokeOthers   = "UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id<>? AND is_revoked=0"
+	)
+
+	bcryptHash, err := password.DefaultBcrypt().Hash("correct horse")
+	require.NoError(t, err)
+	userRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows(mfaUserCols).AddRow(1, "John", "john@example.com", bcryptHash, 0, nil, nil, time.Now(), nil, nil, nil, nil)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		var hashed string
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(userRow())
+		mock.ExpectBegin()
+		mock.ExpectExec(changePassword).WithArgs(tokenHashArg{&hashed}, sqlmock.AnyArg(), 1, bcryptHash).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(revokeOthers).WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		res, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "correct horse", NewPassword: "battery staple"})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), res.GetRevoked())
+		require.NoError(t, mock.ExpectationsWereMet())
+		require.NoError(t, password.Verify("battery staple", hashed))
+	})
+
+	t.Run("wrong current password", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(userRow())
+		expectFailedLogin(mock, userRow())
+
+		_, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "battery staple", NewPassword: "battery staple"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		require.Zero(t, retryDelay(t, err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("wrong current passwords lock account", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		for failed := int64(0); failed < 10; failed++ {
+			mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(loginUserRow(bcryptHash, failed, nil, nil))
+			expectFailedLogin(mock, loginUserRow(bcryptHash, failed, nil, nil))
+
+			_, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "battery staple", NewPassword: "battery staple"})
+			require.Equal(t, codes.PermissionDenied, status.Code(err))
+			if failed < 9 {
+				require.Zero(t, retryDelay(t, err))
+			} else {
+				require.Greater(t, retryDelay(t, err), time.Duration(0))
+			}
+		}
+
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(loginUserRow(bcryptHash, 10, time.Now().Add(5*time.Minute), nil))
+
+		_, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "correct horse", NewPassword: "battery staple"})
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.Greater(t, retryDelay(t, err), time.Duration(0))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success clears failed logins", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(loginUserRow(bcryptHash, 3, nil, nil))
+		mock.ExpectBegin()
+		mock.ExpectExec(changePassword).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, bcryptHash).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(revokeOthers).WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectExec("UPDATE users SET failed_login_attempts=0, locked_until=NULL WHERE id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "correct horse", NewPassword: "battery staple"})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(userRow())
+
+		_, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "correct horse", NewPassword: "short"})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("changed meanwhile", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(userRow())
+		mock.ExpectBegin()
+		mock.ExpectExec(changePassword).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1, bcryptHash).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		_, err := srv.ChangePassword(userContext("f1"), &pb.ChangePasswordReq{CurrentPassword: "correct horse", NewPassword: "battery staple"})
+		require.Equal(t, codes.Aborted, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("api key", func(t *testing.T) {
+		srv, _, _ := newMockServer(t)
+		ctx := context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1, Email: "john@example.com", APIKeyPrefix: "partner"})
+
+		_, err := srv.ChangePassword(ctx, &pb.ChangePasswordReq{CurrentPassword: "correct horse", NewPassword: "battery staple"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// withAccess adds the roles of the user res describes and the permissions
+// they grant, which end up in the user's tokens.
+func (s *Server) withAccess(ctx context.Context, res *pb.UserRes) (*pb.UserRes, error) {
+	roles, err := s.storer.ListUserRoles(ctx, res.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.storer.ListUserPermissions(ctx, res.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	res.Roles = roles
+	res.Permissions = permissions
+	return res, nil
+}
+
+// SetUserRoles replaces the roles of a user. The user's tokens keep the
+// permissions they were issued with until they are renewed.
+func (s *Server) SetUserRoles(ctx context.Context, ur *pb.UserRolesReq) (*pb.UserRes, error) {
+	roles := slices.Clone(ur.GetRoles())
+	slices.Sort(roles)
+	roles = slices.Compact(roles)
+
+	user, err := s.storer.GetUserByID(ctx, ur.GetUserId())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "user %d not found", ur.GetUserId())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storer.SetUserRoles(ctx, user.ID, roles)
+	if errors.Is(err, storer.ErrUnknownRole) {
+		return nil, status.Error(codes.InvalidArgument, "unknown role")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "set user roles", "target_user_id", user.ID, "roles", roles)
+
+	return s.withAccess(ctx, toPBUserRes(user))
+}
+
+func (s *Server) ListRoles(ctx context.Context, _ *pb.ListRolesReq) (*pb.ListRolesRes, error) {
+	roles, err := s.storer.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListRolesRes{}
+	for _, r := range roles {
+		res.Roles = append(res.Roles, &pb.RoleRes{
+			Name:        r.Name,
+			Description: r.Description,
+			Permissions: r.Permissions,
+		})
+	}
+
+	return res, nil
+}
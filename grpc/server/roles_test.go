@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/rbac"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSetUserRoles(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+
+	t.Run("success", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(7, "Jane", "jane@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM roles WHERE name IN (?)").WithArgs(rbac.RoleWarehouse).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectExec("DELETE FROM user_roles WHERE user_id=?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)").WithArgs(7, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id=r.id WHERE ur.user_id=? ORDER BY r.name").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(rbac.RoleWarehouse))
+		mock.ExpectQuery("SELECT DISTINCT p.name FROM permissions p JOIN role_permissions rp ON rp.permission_id=p.id JOIN user_roles ur ON ur.role_id=rp.role_id WHERE ur.user_id=? ORDER BY p.name").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow(rbac.OrdersReadAll).AddRow(rbac.OrdersUpdateStatus))
+
+		res, err := srv.SetUserRoles(context.Background(), &pb.UserRolesReq{UserId: 7, Roles: []string{rbac.RoleWarehouse, rbac.RoleWarehouse}})
+		require.NoError(t, err)
+		require.Equal(t, []string{rbac.RoleWarehouse}, res.GetRoles())
+		require.Equal(t, []string{rbac.OrdersReadAll, rbac.OrdersUpdateStatus}, res.GetPermissions())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown role", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(7, "Jane", "jane@example.com", "hashed", 0, nil, nil, time.Now(), nil))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM roles WHERE name IN (?)").WithArgs("pirate").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		_, err := srv.SetUserRoles(context.Background(), &pb.UserRolesReq{UserId: 7, Roles: []string{"pirate"}})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(7).WillReturnRows(sqlmock.NewRows(userCols))
+
+		_, err := srv.SetUserRoles(context.Background(), &pb.UserRolesReq{UserId: 7, Roles: []string{rbac.RoleWarehouse}})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
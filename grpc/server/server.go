@@ -2,21 +2,89 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/abedsully/golang-microservice/grpc/pb"
 	"github.com/abedsully/golang-microservice/grpc/storer"
-	"google.golang.org/protobuf/types/known/timestamppb"
+	"github.com/abedsully/golang-microservice/mail"
+	"github.com/abedsully/golang-microservice/metrics"
+	"github.com/abedsully/golang-microservice/password"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 
 type Server struct {
 	storer *storer.MySQLStorer
+	mailer mail.Sender
+	cfg    Config
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+
 	pb.UnimplementedGolangMicroserviceServer
+	pb.UnimplementedAuthServiceServer
+}
+
+type Config struct {
+	Lockout           LoginLockout
+	PasswordReset     PasswordReset
+	EmailVerification EmailVerification
+	MFA               MFA
+	Passwords         Passwords
+	Sessions          Sessions
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Lockout: LoginLockout{
+			MaxAttempts: 10,
+			Duration:    15 * time.Minute,
+		},
+		PasswordReset: PasswordReset{
+			URL: "http://localhost:8080/reset-password",
+			TTL: time.Hour,
+		},
+		EmailVerification: EmailVerification{
+			URL:     "http://localhost:8080/users/verify",
+			TTL:     48 * time.Hour,
+			Require: VerificationOptional,
+		},
+		MFA: MFA{
+			Issuer:        "golang-microservice",
+			RecoveryCodes: 10,
+		},
+		Passwords: Passwords{
+			Hasher: password.DefaultArgon2id(),
+			Policy: password.DefaultPolicy(),
+		},
+		Sessions: Sessions{
+			RefreshTokenTTL: 24 * time.Hour,
+		},
+	}
+}
+
+// LoginLockout locks accounts for Duration after MaxAttempts consecutive
+// failed logins. A MaxAttempts of 0 never locks.
+type LoginLockout struct {
+	MaxAttempts int64
+	Duration    time.Duration
 }
 
-func NewServer(storer *storer.MySQLStorer) *Server {
+func NewServer(storer *storer.MySQLStorer, mailer mail.Sender, cfg Config) *Server {
 	return &Server{
 		storer: storer,
+		mailer: mailer,
+		cfg:    cfg,
 	}
 }
 
@@ -78,20 +146,57 @@ func (s *Server) DeleteProduct(ctx context.Context, p *pb.ProductReq) (*pb.Produ
 	return &pb.ProductRes{}, nil
 }
 
+// CreateOrder places an order for the caller. A user_id naming someone else
+// is rejected.
 func (s *Server) CreateOrder(ctx context.Context, o *pb.OrderReq) (*pb.OrderRes, error) {
-	order, err := s.storer.CreateOrder(ctx, toStorerOrder(o))
+	claims, err := requireClaims(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if o.GetUserId() != 0 && o.GetUserId() != claims.ID {
+		return nil, status.Error(codes.PermissionDenied, "orders can only be placed for yourself")
+	}
+
+	if s.cfg.EmailVerification.Require != VerificationOptional {
+		user, err := s.storer.GetUserByID(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := requireVerifiedEmail(user); err != nil {
+			return nil, err
+		}
+	}
+
+	so := toStorerOrder(o)
+	so.UserID = claims.ID
+	order, err := s.storer.CreateOrder(ctx, so)
+	if err != nil {
+		return nil, err
+	}
+	metrics.OrderCreated(float64(order.TotalPrice))
 
 	return toPBOrderRes(order), nil
 }
 
 func (s *Server) GetOrder(ctx context.Context, o *pb.OrderReq) (*pb.OrderRes, error) {
-	order, err := s.storer.GetOrder(ctx, o.GetUserId())
+	claims, err := requireClaims(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if o.GetUserId() != 0 && o.GetUserId() != claims.ID {
+		return nil, status.Error(codes.PermissionDenied, "orders of other users can not be read")
+	}
+
+	order, err := s.storer.GetOrder(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != claims.ID {
+		return nil, status.Error(codes.NotFound, "order not found")
+	}
 
 	return toPBOrderRes(order), nil
 }
@@ -112,8 +217,38 @@ func (s *Server) ListOrders(ctx context.Context, o *pb.OrderReq) (*pb.ListOrderR
 	}, nil
 }
 
+func (s *Server) UpdateOrderStatus(ctx context.Context, o *pb.OrderReq) (*pb.OrderRes, error) {
+	if !storer.IsValidOrderStatus(o.GetStatus()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid order status %q", o.GetStatus())
+	}
+
+	order, err := s.storer.UpdateOrderStatus(ctx, o.GetId(), o.GetStatus())
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBOrderRes(order), nil
+}
+
+// DeleteOrder deletes an order of the caller.
 func (s *Server) DeleteOrder(ctx context.Context, o *pb.OrderReq) (*pb.OrderRes, error) {
-	err := s.storer.DeleteOrder(ctx, o.GetId())
+	claims, err := requireClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := s.storer.GetOrder(ctx, o.GetId())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "order %d not found", o.GetId())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != claims.ID {
+		return nil, status.Errorf(codes.PermissionDenied, "order %d belongs to another user", o.GetId())
+	}
+
+	err = s.storer.DeleteOrder(ctx, o.GetId())
 	if err != nil {
 		return nil, err
 	}
@@ -122,21 +257,40 @@ func (s *Server) DeleteOrder(ctx context.Context, o *pb.OrderReq) (*pb.OrderRes,
 }
 
 func (s *Server) CreateUser(ctx context.Context, u *pb.UserReq) (*pb.UserRes, error) {
-	user, err := s.storer.CreateUser(ctx, toStorerUser(u))
+	if err := validateEmail(u.GetEmail()); err != nil {
+		return nil, err
+	}
+
+	hashed, err := s.hashNewPassword(u.GetPassword(), u.GetEmail())
+	if err != nil {
+		return nil, err
+	}
+
+	user := toStorerUser(u)
+	user.Password = hashed
+	user, err = s.storer.CreateUser(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 
+	// the user is created either way, the mail can be sent again
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "error sending verification email", "user_id", user.ID, "error", err)
+	}
+
 	return toPBUserRes(user), nil
 }
 
 func (s *Server) GetUser(ctx context.Context, u *pb.UserReq) (*pb.UserRes, error) {
 	user, err := s.storer.GetUser(ctx, u.GetEmail())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return toPBUserRes(user), nil
+	return s.withAccess(ctx, toPBUserRes(user))
 }
 
 func (s *Server) ListUsers(ctx context.Context, u *pb.UserReq) (*pb.ListUserRes, error) {
@@ -155,8 +309,21 @@ func (s *Server) ListUsers(ctx context.Context, u *pb.UserReq) (*pb.ListUserRes,
 	}, nil
 }
 
+// UpdateUser changes the profile of the caller. Passwords are changed with
+// ChangePassword, which asks for the current one.
 func (s *Server) UpdateUser(ctx context.Context, u *pb.UserReq) (*pb.UserRes, error) {
-	user, err := s.storer.GetUser(ctx, u.GetEmail())
+	claims, err := requireClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if u.GetId() != 0 && u.GetId() != claims.ID || u.GetEmail() != "" && u.GetEmail() != claims.Email {
+		return nil, status.Error(codes.PermissionDenied, "users can only update their own profile")
+	}
+	if u.GetPassword() != "" {
+		return nil, status.Error(codes.InvalidArgument, "password can not be updated, change it with the current password instead")
+	}
+
+	user, err := s.storer.GetUser(ctx, claims.Email)
 	if err != nil {
 		return nil, err
 	}
@@ -179,56 +346,164 @@ func (s *Server) DeleteUser(ctx context.Context, u *pb.UserReq) (*pb.UserRes, er
 	return &pb.UserRes{}, nil
 }
 
-func (s *Server) CreateSession(ctx context.Context, sr *pb.SessionReq) (*pb.SessionRes, error) {
-	sess, err := s.storer.CreateSession(ctx, &storer.Session{
-		ID:           sr.GetId(),
-		UserEmail:    sr.GetUserEmail(),
-		RefreshToken: sr.GetRefreshToken(),
-		IsRevoked:    sr.GetIsRevoked(),
-		ExpiresAt:    sr.GetExpiresAt().AsTime(),
+// UnlockUser lifts the lock of an account and clears its failed logins.
+func (s *Server) UnlockUser(ctx context.Context, u *pb.UserReq) (*pb.UserRes, error) {
+	err := s.storer.ResetFailedLogins(ctx, u.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.storer.GetUserByID(ctx, u.GetId())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "user %d not found", u.GetId())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBUserRes(user), nil
+}
+
+func (s *Server) CreateWebhook(ctx context.Context, w *pb.WebhookReq) (*pb.WebhookRes, error) {
+	if err := validateWebhookReq(w, true); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := s.storer.CreateWebhookSubscription(ctx, &storer.WebhookSubscription{
+		URL:        w.GetUrl(),
+		EventTypes: strings.Join(w.GetEventTypes(), ","),
+		Secret:     secret,
+		IsActive:   w.IsActive == nil || w.GetIsActive(),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.SessionRes{
-		Id:           sess.ID,
-		UserEmail:    sess.UserEmail,
-		RefreshToken: sess.RefreshToken,
-		IsRevoked:    sess.IsRevoked,
-		ExpiresAt:    timestamppb.New(sess.ExpiresAt),
-	}, nil
+	// the secret is only ever returned once, on creation
+	res := toPBWebhookRes(ws)
+	res.Secret = ws.Secret
+
+	return res, nil
 }
 
-func (s *Server) GetSession(ctx context.Context, sr *pb.SessionReq) (*pb.SessionRes, error) {
-	sess, err := s.storer.GetSession(ctx, sr.GetId())
+func (s *Server) GetWebhook(ctx context.Context, w *pb.WebhookReq) (*pb.WebhookRes, error) {
+	ws, err := s.storer.GetWebhookSubscription(ctx, w.GetId())
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.SessionRes{
-		Id:           sess.ID,
-		UserEmail:    sess.UserEmail,
-		RefreshToken: sess.RefreshToken,
-		IsRevoked:    sess.IsRevoked,
-		ExpiresAt:    timestamppb.New(sess.ExpiresAt),
+	return toPBWebhookRes(ws), nil
+}
+
+func (s *Server) GetAllWebhooks(ctx context.Context, w *pb.WebhookReq) (*pb.ListWebhookRes, error) {
+	subs, err := s.storer.GetAllWebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lwr := make([]*pb.WebhookRes, 0, len(subs))
+	for _, ws := range subs {
+		lwr = append(lwr, toPBWebhookRes(ws))
+	}
+
+	return &pb.ListWebhookRes{
+		Webhooks: lwr,
 	}, nil
 }
 
-func (s *Server) RevokeSession(ctx context.Context, sr *pb.SessionReq) (*pb.SessionRes, error) {
-	err := s.storer.RevokeSession(ctx, sr.GetId())
+func (s *Server) UpdateWebhook(ctx context.Context, w *pb.WebhookReq) (*pb.WebhookRes, error) {
+	if err := validateWebhookReq(w, false); err != nil {
+		return nil, err
+	}
+
+	ws, err := s.storer.GetWebhookSubscription(ctx, w.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	patchWebhookReq(ws, w)
+	ws, err = s.storer.UpdateWebhookSubscription(ctx, ws)
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.SessionRes{}, nil
+	return toPBWebhookRes(ws), nil
 }
 
-func (s *Server) DeleteSession(ctx context.Context, sr *pb.SessionReq) (*pb.SessionRes, error) {
-	err := s.storer.DeleteSession(ctx, sr.GetId())
+func (s *Server) DeleteWebhook(ctx context.Context, w *pb.WebhookReq) (*pb.WebhookRes, error) {
+	err := s.storer.DeleteWebhookSubscription(ctx, w.GetId())
 	if err != nil {
 		return nil, err
 	}
 
-	return &pb.SessionRes{}, nil
-}
\ No newline at end of file
+	return &pb.WebhookRes{}, nil
+}
+
+func (s *Server) GetAllWebhookDeliveries(ctx context.Context, d *pb.WebhookDeliveryReq) (*pb.ListWebhookDeliveryRes, error) {
+	deliveries, err := s.storer.GetAllWebhookDeliveries(ctx, d.GetWebhookId())
+	if err != nil {
+		return nil, err
+	}
+
+	ldr := make([]*pb.WebhookDeliveryRes, 0, len(deliveries))
+	for _, del := range deliveries {
+		ldr = append(ldr, toPBWebhookDeliveryRes(del))
+	}
+
+	return &pb.ListWebhookDeliveryRes{
+		Deliveries: ldr,
+	}, nil
+}
+
+func (s *Server) RedeliverWebhook(ctx context.Context, d *pb.WebhookDeliveryReq) (*pb.WebhookDeliveryRes, error) {
+	del, err := s.storer.GetWebhookDelivery(ctx, d.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if del.SubscriptionID != d.GetWebhookId() {
+		return nil, status.Errorf(codes.NotFound, "delivery %d does not belong to webhook %d", d.GetId(), d.GetWebhookId())
+	}
+
+	del, err = s.storer.RedeliverWebhookDelivery(ctx, del.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBWebhookDeliveryRes(del), nil
+}
+
+func validateWebhookReq(w *pb.WebhookReq, create bool) error {
+	if create || w.GetUrl() != "" {
+		u, err := url.Parse(w.GetUrl())
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return status.Errorf(codes.InvalidArgument, "invalid webhook url %q", w.GetUrl())
+		}
+	}
+
+	if create && len(w.GetEventTypes()) == 0 {
+		return status.Error(codes.InvalidArgument, "at least one event type is required")
+	}
+
+	for _, et := range w.GetEventTypes() {
+		if !storer.IsKnownEventType(et) {
+			return status.Errorf(codes.InvalidArgument, "unknown event type %q", et)
+		}
+	}
+
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+
+	return "whsec_" + hex.EncodeToString(b), nil
+}
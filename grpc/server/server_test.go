@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func expectGetOrder(mock sqlmock.Sqlmock, id, userID int64) {
+	mock.ExpectQuery("SELECT * FROM orders WHERE id=?").WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "user_id", "status", "created_at", "updated_at"}).
+			AddRow(id, "card", 1, 2, 13, userID, "pending", time.Now(), nil))
+	mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}))
+}
+
+func TestOrderOwnership(t *testing.T) {
+	t.Run("orders are placed for the caller", func(t *testing.T) {
+		srv, _, _ := newMockServer(t)
+
+		_, err := srv.CreateOrder(userContext(""), &pb.OrderReq{UserId: 2})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		_, err = srv.CreateOrder(context.Background(), &pb.OrderReq{})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("orders of other users are not read", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		_, err := srv.GetOrder(userContext(""), &pb.OrderReq{UserId: 2})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		expectGetOrder(mock, 1, 2)
+		_, err = srv.GetOrder(userContext(""), &pb.OrderReq{})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("orders of other users are not deleted", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		expectGetOrder(mock, 7, 2)
+
+		_, err := srv.DeleteOrder(userContext(""), &pb.OrderReq{Id: 7})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("own orders are deleted", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		expectGetOrder(mock, 7, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM order_items WHERE order_id=?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM orders WHERE id=?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, err := srv.DeleteOrder(userContext(""), &pb.OrderReq{Id: 7})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUpdateUserOwnership(t *testing.T) {
+	srv, _, _ := newMockServer(t)
+
+	for _, u := range []*pb.UserReq{{Email: "jane@example.com"}, {Id: 2}} {
+		_, err := srv.UpdateUser(userContext(""), u)
+		require.Equal(t, codes.PermissionDenied, status.Code(err), u.String())
+	}
+}
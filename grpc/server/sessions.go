@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/token"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxUserAgentLength is the size of the sessions.user_agent column.
+const maxUserAgentLength = 512
+
+// withCaller records the user agent and address of the client that s is
+// created for.
+func withCaller(ctx context.Context, s *storer.Session) *storer.Session {
+	c := CallerFromContext(ctx)
+
+	s.UserAgent = c.UserAgent
+	if len(s.UserAgent) > maxUserAgentLength {
+		s.UserAgent = strings.ToValidUTF8(s.UserAgent[:maxUserAgentLength], "")
+	}
+	s.IPAddress = c.IP
+
+	return s
+}
+
+// RenewToken replaces a refresh token with a new one of the same session and
+// returns the user to issue an access token for. A refresh token presented a
+// second time revokes every session descended from the same login.
+func (s *Server) RenewToken(ctx context.Context, r *pb.RenewTokenReq) (*pb.LoginRes, error) {
+	if r.GetRefreshToken() == "" {
+		return nil, status.Error(codes.Unauthenticated, "refresh token is required")
+	}
+
+	refreshToken, hash, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := s.storer.RotateSession(ctx, hashSecretToken(r.GetRefreshToken()), withCaller(ctx, &storer.Session{
+		ID:        hash,
+		ExpiresAt: time.Now().Add(s.cfg.Sessions.RefreshTokenTTL),
+	}))
+	if errors.Is(err, storer.ErrRefreshTokenReused) {
+		slog.WarnContext(ctx, "refresh token reused, revoked session family")
+		return nil, status.Error(codes.Unauthenticated, "refresh token reused")
+	}
+	if errors.Is(err, storer.ErrInvalidSession) {
+		return nil, status.Error(codes.Unauthenticated, "invalid session")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.storer.GetUser(ctx, sess.UserEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Error(codes.Unauthenticated, "invalid session")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ur, err := s.withAccess(ctx, toPBUserRes(user))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.LoginRes{
+		User:                  ur,
+		SessionId:             sess.FamilyID,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: timestamppb.New(sess.ExpiresAt),
+	}, nil
+}
+
+// Logout revokes the session the call was made from, which makes the service
+// reject its access tokens too. Tokens not bound to a session have nothing to
+// revoke; they stay valid until the gateway denies them.
+func (s *Server) Logout(ctx context.Context, _ *pb.LogoutReq) (*pb.RevokeSessionsRes, error) {
+	claims, _ := ClaimsFromContext(ctx)
+	if claims.APIKeyPrefix != "" {
+		return nil, status.Error(codes.InvalidArgument, "api keys have no session, revoke the key instead")
+	}
+	if claims.SessionID == "" {
+		return &pb.RevokeSessionsRes{}, nil
+	}
+
+	n, err := s.storer.RevokeSessionFamily(ctx, claims.Email, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RevokeSessionsRes{Revoked: n}, nil
+}
+
+// ListSessions returns the active sessions of the calling user, marking the
+// one the call was made from.
+func (s *Server) ListSessions(ctx context.Context, _ *pb.ListSessionsReq) (*pb.ListSessionsRes, error) {
+	claims, _ := ClaimsFromContext(ctx)
+
+	sessions, err := s.storer.ListSessions(ctx, claims.Email, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.ListSessionsRes{}
+	for _, sess := range sessions {
+		res.Sessions = append(res.Sessions, toPBSessionInfo(sess, claims.SessionID))
+	}
+
+	return res, nil
+}
+
+// RevokeMySession revokes one session of the calling user, which may be the
+// one the call was made from.
+func (s *Server) RevokeMySession(ctx context.Context, rr *pb.RevokeSessionsReq) (*pb.RevokeSessionsRes, error) {
+	claims, _ := ClaimsFromContext(ctx)
+
+	if rr.GetSessionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "session id is required")
+	}
+
+	n, err := s.storer.RevokeSessionFamily(ctx, claims.Email, rr.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, status.Errorf(codes.NotFound, "session %s not found", rr.GetSessionId())
+	}
+
+	return &pb.RevokeSessionsRes{Revoked: n}, nil
+}
+
+// RevokeMyOtherSessions revokes every session of the calling user except the
+// one the call was made from.
+func (s *Server) RevokeMyOtherSessions(ctx context.Context, _ *pb.RevokeSessionsReq) (*pb.RevokeSessionsRes, error) {
+	claims, _ := ClaimsFromContext(ctx)
+
+	// without a session ID the current session cannot be spared
+	if claims.SessionID == "" {
+		return nil, status.Error(codes.FailedPrecondition, "token is not bound to a session, log in again")
+	}
+
+	n, err := s.storer.RevokeUserSessions(ctx, claims.Email, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RevokeSessionsRes{Revoked: n}, nil
+}
+
+// RevokeUserSessions revokes every session of the given user.
+func (s *Server) RevokeUserSessions(ctx context.Context, rr *pb.RevokeSessionsReq) (*pb.RevokeSessionsRes, error) {
+	user, err := s.storer.GetUserByID(ctx, rr.GetUserId())
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "user %d not found", rr.GetUserId())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := s.storer.RevokeUserSessions(ctx, user.Email, "")
+	if err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "revoked all sessions of user", "target_user_id", user.ID, "count", n)
+
+	return &pb.RevokeSessionsRes{Revoked: n}, nil
+}
+
+// IsTokenRevoked reports whether a user token was denied or the session it was
+// issued for was revoked, by logging out, revoking sessions or changing the
+// password. It makes Server usable as the TokenRevocations of an
+// Authenticator.
+func (s *Server) IsTokenRevoked(ctx context.Context, claims *token.UserClaims) (bool, error) {
+	return s.storer.IsTokenRevoked(ctx, claims.RegisteredClaims.ID, claims.SessionID, time.Now())
+}
+
+// DenyToken adds a token to the denylist shared by the gateways.
+func (s *Server) DenyToken(ctx context.Context, dr *pb.DeniedTokenReq) (*pb.DeniedTokenRes, error) {
+	if dr.GetJti() == "" || dr.GetExpiresAt() == nil {
+		return nil, status.Error(codes.InvalidArgument, "jti and expires_at are required")
+	}
+
+	err := s.storer.DenyToken(ctx, dr.GetJti(), dr.GetExpiresAt().AsTime())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DeniedTokenRes{Denied: true}, nil
+}
+
+func (s *Server) IsTokenDenied(ctx context.Context, dr *pb.DeniedTokenReq) (*pb.DeniedTokenRes, error) {
+	denied, err := s.storer.IsTokenDenied(ctx, dr.GetJti(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DeniedTokenRes{Denied: denied}, nil
+}
+
+// SessionSweeper deletes sessions and denied tokens that can no longer be
+// used.
+type SessionSweeper interface {
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error)
+	DeleteExpiredDeniedTokens(ctx context.Context, now time.Time) (int64, error)
+}
+
+// SweepSessions deletes expired sessions and denylist entries of expired
+// tokens every interval until ctx is cancelled.
+func SweepSessions(ctx context.Context, st SessionSweeper, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now()
+			n, err := st.DeleteExpiredSessions(ctx, now)
+			if err != nil {
+				slog.ErrorContext(ctx, "error sweeping sessions", "error", err)
+			} else if n > 0 {
+				slog.InfoContext(ctx, "swept expired sessions", "count", n)
+			}
+
+			n, err = st.DeleteExpiredDeniedTokens(ctx, now)
+			if err != nil {
+				slog.ErrorContext(ctx, "error sweeping token denylist", "error", err)
+			} else if n > 0 {
+				slog.InfoContext(ctx, "swept expired denied tokens", "count", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func userContext(sessionID string) context.Context {
+	return context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1, Email: "john@example.com", SessionID: sessionID})
+}
+
+func TestListSessions(t *testing.T) {
+	srv, mock, _ := newMockServer(t)
+	rows := sqlmock.NewRows([]string{"id", "user_email", "is_revoked", "created_at", "expires_at", "family_id", "replaced_by", "used_at", "user_agent", "ip_address", "last_used_at"}).
+		AddRow("s2", "john@example.com", false, time.Now(), time.Now().Add(time.Hour), "f2", nil, nil, "curl/8.0", "10.0.0.2", nil).
+		AddRow("s1", "john@example.com", false, time.Now(), time.Now().Add(time.Hour), "f1", nil, nil, "Firefox", "10.0.0.1", time.Now())
+
+	mock.ExpectQuery("SELECT * FROM sessions WHERE user_email=? AND is_revoked=0 AND used_at IS NULL AND expires_at>? ORDER BY created_at DESC").WithArgs("john@example.com", sqlmock.AnyArg()).WillReturnRows(rows)
+
+	res, err := srv.ListSessions(userContext("f1"), &pb.ListSessionsReq{})
+	require.NoError(t, err)
+	require.Len(t, res.GetSessions(), 2)
+	require.Equal(t, "f2", res.GetSessions()[0].GetId())
+	require.False(t, res.GetSessions()[0].GetCurrent())
+	require.Nil(t, res.GetSessions()[0].GetLastUsedAt())
+	require.True(t, res.GetSessions()[1].GetCurrent())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeSessions(t *testing.T) {
+	t.Run("unknown session", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id=? AND is_revoked=0").WithArgs("john@example.com", "f9").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		_, err := srv.RevokeMySession(userContext("f1"), &pb.RevokeSessionsReq{SessionId: "f9"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("other sessions", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id<>? AND is_revoked=0").WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 2))
+
+		res, err := srv.RevokeMyOtherSessions(userContext("f1"), &pb.RevokeSessionsReq{})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, res.GetRevoked())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("other sessions without a session", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		_, err := srv.RevokeMyOtherSessions(userContext(""), &pb.RevokeSessionsReq{})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("all sessions of unknown user", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := srv.RevokeUserSessions(userContext("f1"), &pb.RevokeSessionsReq{UserId: 7})
+		require.Equal(t, codes.NotFound, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRenewToken(t *testing.T) {
+	sessionCols := []string{"id", "user_email", "is_revoked", "created_at", "expires_at", "family_id", "replaced_by", "used_at", "user_agent", "ip_address", "last_used_at"}
+	const (
+		selectSession = "SELECT * FROM sessions WHERE id=? FOR UPDATE"
+		useSession    = "UPDATE sessions SET used_at=?, replaced_by=? WHERE id=?"
+	)
+
+	t.Run("rotates refresh token", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		var next string
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectSession).WithArgs(hashSecretToken("old-token")).WillReturnRows(sqlmock.NewRows(sessionCols).
+			AddRow(hashSecretToken("old-token"), "john@example.com", false, time.Now(), time.Now().Add(time.Hour), "f1", nil, nil, "", "", nil))
+		mock.ExpectExec(useSession).WithArgs(sqlmock.AnyArg(), tokenHashArg{&next}, hashSecretToken("old-token")).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectCreateSession(mock, "john@example.com")
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT * FROM users WHERE email=?").WithArgs("john@example.com").WillReturnRows(mfaUserRow(nil, nil))
+		expectNoAccess(mock)
+
+		res, err := srv.RenewToken(context.Background(), &pb.RenewTokenReq{RefreshToken: "old-token"})
+		require.NoError(t, err)
+		require.Equal(t, "f1", res.GetSessionId())
+		require.Equal(t, int64(1), res.GetUser().GetId())
+		require.Equal(t, hashSecretToken(res.GetRefreshToken()), next)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reused refresh token", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectSession).WithArgs(hashSecretToken("old-token")).WillReturnRows(sqlmock.NewRows(sessionCols).
+			AddRow(hashSecretToken("old-token"), "john@example.com", false, time.Now(), time.Now().Add(time.Hour), "f1", "s2", time.Now(), "", "", nil))
+		mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE family_id=?").WithArgs("f1").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		_, err := srv.RenewToken(context.Background(), &pb.RenewTokenReq{RefreshToken: "old-token"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown refresh token", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectSession).WithArgs(hashSecretToken("forged")).WillReturnRows(sqlmock.NewRows(sessionCols))
+		mock.ExpectRollback()
+
+		_, err := srv.RenewToken(context.Background(), &pb.RenewTokenReq{RefreshToken: "forged"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no refresh token", func(t *testing.T) {
+		srv, _, _ := newMockServer(t)
+
+		_, err := srv.RenewToken(context.Background(), &pb.RenewTokenReq{})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
+
+func TestLogout(t *testing.T) {
+	t.Run("revokes session", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id=? AND is_revoked=0").WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		res, err := srv.Logout(userContext("f1"), &pb.LogoutReq{})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, res.GetRevoked())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("without a session", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+
+		res, err := srv.Logout(userContext(""), &pb.LogoutReq{})
+		require.NoError(t, err)
+		require.Zero(t, res.GetRevoked())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("api key", func(t *testing.T) {
+		srv, _, _ := newMockServer(t)
+		ctx := context.WithValue(context.Background(), claimsKey{}, &token.UserClaims{ID: 1, Email: "john@example.com", APIKeyPrefix: "partner"})
+
+		_, err := srv.Logout(ctx, &pb.LogoutReq{})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestWithCaller(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		ClientIPHeader, "203.0.113.7",
+		ClientUserAgentHeader, strings.Repeat("é", maxUserAgentLength),
+	))
+	ctx = context.WithValue(ctx, internalCallerKey{}, true)
+
+	s := withCaller(ctx, &storer.Session{})
+	require.Equal(t, "203.0.113.7", s.IPAddress)
+	require.LessOrEqual(t, len(s.UserAgent), maxUserAgentLength)
+	require.True(t, strings.HasPrefix(strings.Repeat("é", maxUserAgentLength), s.UserAgent))
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+)
+
+// issueUserToken stores a new single-use token of user in table and returns
+// baseURL with the token added as the token query parameter, to be mailed to
+// the user.
+func (s *Server) issueUserToken(ctx context.Context, table string, user *storer.User, baseURL string, ttl time.Duration) (string, error) {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing token url: %w", err)
+	}
+
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.storer.CreateUserToken(ctx, table, &storer.UserToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	return link.String(), nil
+}
+
+// newSecretToken returns a random token to hand out to a user and the hash it
+// is stored as.
+func newSecretToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashSecretToken(token), nil
+}
+
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
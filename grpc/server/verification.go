@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/abedsully/golang-microservice/mail"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// VerificationPolicy decides what users cannot do before they verified their
+// email address.
+type VerificationPolicy string
+
+const (
+	// VerificationOptional lets unverified users do everything.
+	VerificationOptional VerificationPolicy = "none"
+	// VerificationBeforeCheckout keeps unverified users from placing orders.
+	VerificationBeforeCheckout VerificationPolicy = "checkout"
+	// VerificationBeforeLogin keeps unverified users from logging in, and
+	// therefore from placing orders as well.
+	VerificationBeforeLogin VerificationPolicy = "login"
+)
+
+func ParseVerificationPolicy(s string) (VerificationPolicy, error) {
+	switch p := VerificationPolicy(s); p {
+	case VerificationOptional, VerificationBeforeCheckout, VerificationBeforeLogin:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown email verification policy %q, want none, checkout or login", s)
+	}
+}
+
+// EmailVerification configures the verification links mailed to new users.
+// The token is added to URL as the token query parameter and can be used once
+// within TTL.
+type EmailVerification struct {
+	URL     string
+	TTL     time.Duration
+	Require VerificationPolicy
+}
+
+var errEmailNotVerified = status.Error(codes.FailedPrecondition, "email address is not verified")
+
+// validateEmail accepts bare addresses only, without a display name.
+func validateEmail(email string) error {
+	addr, err := netmail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return status.Errorf(codes.InvalidArgument, "invalid email address %q", email)
+	}
+
+	return nil
+}
+
+func (s *Server) sendVerificationEmail(ctx context.Context, user *storer.User) error {
+	link, err := s.issueUserToken(ctx, storer.EmailVerificationTokens, user, s.cfg.EmailVerification.URL, s.cfg.EmailVerification.TTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nopen the link below within %s to verify your email address:\n\n%s\n",
+			user.Name, s.cfg.EmailVerification.TTL, link),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending verification mail: %w", err)
+	}
+
+	return nil
+}
+
+// requireVerifiedEmail fails with FailedPrecondition if the user has not
+// verified their email address.
+func requireVerifiedEmail(user *storer.User) error {
+	if user.EmailVerifiedAt == nil {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+// VerifyEmail marks the email address of the user a verification token was
+// mailed to as verified.
+func (s *Server) VerifyEmail(ctx context.Context, r *pb.EmailVerificationReq) (*pb.UserRes, error) {
+	if r.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	user, err := s.storer.VerifyEmail(ctx, hashSecretToken(r.GetToken()))
+	if errors.Is(err, storer.ErrInvalidToken) {
+		return nil, status.Error(codes.InvalidArgument, storer.ErrInvalidToken.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toPBUserRes(user), nil
+}
+
+// ResendVerificationEmail mails a new verification link to the user with the
+// given email. Unknown and already verified emails succeed without sending
+// anything, so that callers cannot tell which emails are registered.
+func (s *Server) ResendVerificationEmail(ctx context.Context, r *pb.EmailVerificationReq) (*pb.UserRes, error) {
+	user, err := s.storer.GetUser(ctx, r.GetEmail())
+	if errors.Is(err, sql.ErrNoRows) {
+		return &pb.UserRes{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return &pb.UserRes{}, nil
+	}
+
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &pb.UserRes{}, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/abedsully/golang-microservice/grpc/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateEmail(t *testing.T) {
+	for email, ok := range map[string]bool{
+		"john@example.com":         true,
+		"john.doe+shop@example.co": true,
+		"":                         false,
+		"john":                     false,
+		"john@":                    false,
+		"John <john@example.com>":  false,
+		" john@example.com":        false,
+	} {
+		err := validateEmail(email)
+		if ok {
+			require.NoError(t, err, email)
+		} else {
+			require.Equal(t, codes.InvalidArgument, status.Code(err), email)
+		}
+	}
+}
+
+func TestVerificationPolicy(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+	unverified := func() *sqlmock.Rows {
+		return sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", "hashed", 0, nil, nil, time.Now(), nil)
+	}
+
+	t.Run("checkout blocks orders", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		srv.cfg.EmailVerification.Require = VerificationBeforeCheckout
+
+		mock.ExpectQuery("SELECT * FROM users WHERE id=?").WithArgs(1).WillReturnRows(unverified())
+
+		_, err := srv.CreateOrder(userContext(""), &pb.OrderReq{})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("checkout allows login", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		srv.cfg.EmailVerification.Require = VerificationBeforeCheckout
+		hash, err := srv.cfg.Passwords.Hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		mock.ExpectQuery("SELECT * FROM users WHERE email=?").WithArgs("john@example.com").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", hash, 0, nil, nil, time.Now(), nil))
+		expectCreateSession(mock, "john@example.com")
+		expectNoAccess(mock)
+
+		_, err = srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("login blocks sessions", func(t *testing.T) {
+		srv, mock, _ := newMockServer(t)
+		srv.cfg.EmailVerification.Require = VerificationBeforeLogin
+		hash, err := srv.cfg.Passwords.Hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		mock.ExpectQuery("SELECT * FROM users WHERE email=?").WithArgs("john@example.com").
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John", "john@example.com", hash, 0, nil, nil, time.Now(), nil))
+
+		_, err = srv.Login(context.Background(), &pb.LoginReq{Email: "john@example.com", Password: "correct horse"})
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseVerificationPolicy(t *testing.T) {
+	p, err := ParseVerificationPolicy("login")
+	require.NoError(t, err)
+	require.Equal(t, VerificationBeforeLogin, p)
+
+	_, err = ParseVerificationPolicy("always")
+	require.Error(t, err)
+}
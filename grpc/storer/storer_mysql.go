@@ -2,7 +2,13 @@ package storer
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -59,7 +65,20 @@ func (ms *MySQLStorer) GetAllProducts(ctx context.Context) ([]*Product, error) {
 }
 
 func (ms *MySQLStorer) UpdateProduct(ctx context.Context, p *Product) (*Product, error) {
-	_, err := ms.db.NamedExecContext(ctx, "UPDATE products SET name=:name, image=:image, category=:category, description=:description, rating=:rating, num_reviews=:num_reviews, price=:price, count_in_stock=:count_in_stock, updated_at=:updated_at WHERE id=:id", p)
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, "UPDATE products SET name=:name, image=:image, category=:category, description=:description, rating=:rating, num_reviews=:num_reviews, price=:price, count_in_stock=:count_in_stock, updated_at=:updated_at WHERE id=:id", p)
+		if err != nil {
+			return fmt.Errorf("error updating product: %w", err)
+		}
+
+		return createOutboxEvent(ctx, tx, AggregateProduct, strconv.FormatInt(p.ID, 10), EventProductUpdated, ProductUpdatedPayload{
+			ProductID:    p.ID,
+			Name:         p.Name,
+			Category:     p.Category,
+			Price:        p.Price,
+			CountInStock: p.CountInStock,
+		})
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("error updating product: %w", err)
@@ -94,7 +113,8 @@ func (ms *MySQLStorer) CreateOrder(ctx context.Context, o *Order) (*Order, error
 				return fmt.Errorf("error creating order item: %w", err)
 			}
 		}
-		return nil
+
+		return createOutboxEvent(ctx, tx, AggregateOrder, strconv.FormatInt(order.ID, 10), EventOrderCreated, toOrderCreatedPayload(order))
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error creating order: %w", err)
@@ -103,6 +123,28 @@ func (ms *MySQLStorer) CreateOrder(ctx context.Context, o *Order) (*Order, error
 	return o, nil
 }
 
+func toOrderCreatedPayload(o *Order) OrderCreatedPayload {
+	items := make([]OrderItemPayload, 0, len(o.Items))
+	for _, oi := range o.Items {
+		items = append(items, OrderItemPayload{
+			ProductID: oi.ProductID,
+			Name:      oi.Name,
+			Quantity:  oi.Quantity,
+			Price:     oi.Price,
+		})
+	}
+
+	return OrderCreatedPayload{
+		OrderID:       o.ID,
+		UserID:        o.UserID,
+		PaymentMethod: o.PaymentMethod,
+		TaxPrice:      o.TaxPrice,
+		ShippingPrice: o.ShippingPrice,
+		TotalPrice:    o.TotalPrice,
+		Items:         items,
+	}
+}
+
 func createOrder(ctx context.Context, tx *sqlx.Tx, o *Order) (*Order, error) {
 	res, err := tx.NamedExecContext(ctx, "INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id) VALUES (:payment_method, :tax_price, :shipping_price, :total_price, :user_id)", o)
 	if err != nil {
@@ -114,6 +156,9 @@ func createOrder(ctx context.Context, tx *sqlx.Tx, o *Order) (*Order, error) {
 		return nil, fmt.Errorf("error getting last insert ID: %w", err)
 	}
 	o.ID = id
+	if o.Status == "" {
+		o.Status = OrderStatusPending
+	}
 
 	return o, nil
 }
@@ -179,6 +224,43 @@ func (ms *MySQLStorer) GetAllOrders(ctx context.Context) ([]*Order, error) {
 	return orders, nil
 }
 
+func (ms *MySQLStorer) UpdateOrderStatus(ctx context.Context, id int64, status string) (*Order, error) {
+	var o Order
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &o, "SELECT * FROM orders WHERE id=? FOR UPDATE", id)
+		if err != nil {
+			return fmt.Errorf("error getting order: %w", err)
+		}
+
+		if o.Status == status {
+			return nil
+		}
+
+		prev := o.Status
+		now := time.Now()
+		o.Status = status
+		o.UpdatedAt = &now
+
+		_, err = tx.NamedExecContext(ctx, "UPDATE orders SET status=:status, updated_at=:updated_at WHERE id=:id", &o)
+		if err != nil {
+			return fmt.Errorf("error updating order status: %w", err)
+		}
+
+		return createOutboxEvent(ctx, tx, AggregateOrder, strconv.FormatInt(o.ID, 10), EventOrderStatusChanged, OrderStatusChangedPayload{
+			OrderID:        o.ID,
+			UserID:         o.UserID,
+			PreviousStatus: prev,
+			Status:         status,
+		})
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error updating order status: %w", err)
+	}
+
+	return &o, nil
+}
+
 func (ms *MySQLStorer) DeleteOrder(ctx context.Context, id int64) error {
 	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
 		_, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id=?", id)
@@ -225,19 +307,29 @@ func (ms *MySQLStorer) execTx(ctx context.Context, fn func(*sqlx.Tx) error) erro
 }
 
 func (ms *MySQLStorer) CreateUser(ctx context.Context, u *User) (*User, error) {
-	res, err := ms.db.NamedExecContext(ctx, "INSERT INTO users (name, email, password, is_admin) VALUES (:name, :email, :password, :is_admin)", u)
-	if err != nil {
-		return nil, fmt.Errorf("error inserting user: %w", err)
-	}
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, "INSERT INTO users (name, email, password) VALUES (:name, :email, :password)", u)
+		if err != nil {
+			return fmt.Errorf("error inserting user: %w", err)
+		}
 
-	id, err := res.LastInsertId()
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last inserted id: %w", err)
+		}
+		u.ID = id
+
+		return createOutboxEvent(ctx, tx, AggregateUser, strconv.FormatInt(u.ID, 10), EventUserRegistered, UserRegisteredPayload{
+			UserID: u.ID,
+			Name:   u.Name,
+			Email:  u.Email,
+		})
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error getting last inserted id: %w", err)
+		return nil, fmt.Errorf("error creating user: %w", err)
 	}
 
-	u.ID = id
-
 	return u, nil
 }
 
@@ -252,6 +344,17 @@ func (ms *MySQLStorer) GetUser(ctx context.Context, email string) (*User, error)
 	return &u, nil
 }
 
+func (ms *MySQLStorer) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	var u User
+	err := ms.db.GetContext(ctx, &u, "SELECT * FROM users WHERE id=?", id)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	return &u, nil
+}
+
 func (ms *MySQLStorer) GetAllUsers(ctx context.Context) ([]*User, error) {
 	var users []*User
 	err := ms.db.SelectContext(ctx, &users, "SELECT * FROM users")
@@ -264,7 +367,7 @@ func (ms *MySQLStorer) GetAllUsers(ctx context.Context) ([]*User, error) {
 }
 
 func (ms *MySQLStorer) UpdateUser(ctx context.Context, u *User) (*User, error) {
-	_, err := ms.db.NamedExecContext(ctx, "UPDATE users SET name=:name, email=:email, password=:password, is_admin=:is_admin, updated_at=:updated_at WHERE id=:id", u)
+	_, err := ms.db.NamedExecContext(ctx, "UPDATE users SET name=:name, email=:email, password=:password, updated_at=:updated_at WHERE id=:id", u)
 
 	if err != nil {
 		return nil, fmt.Errorf("error updating user: %w", err)
@@ -273,6 +376,58 @@ func (ms *MySQLStorer) UpdateUser(ctx context.Context, u *User) (*User, error) {
 	return u, nil
 }
 
+// UpdatePasswordHash replaces the password hash of the user with a new hash
+// of the same password, unless the password was changed since oldHash was
+// read.
+func (ms *MySQLStorer) UpdatePasswordHash(ctx context.Context, id int64, oldHash, newHash string) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE users SET password=? WHERE id=? AND password=?", newHash, id, oldHash)
+	if err != nil {
+		return fmt.Errorf("error updating password hash: %w", err)
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the password hash of the user with newHash, unless
+// the password was changed since u was read, in which case
+// ErrPasswordChanged is returned. In the same transaction every session of
+// the user outside the family exceptFamilyID is revoked; their number is
+// returned.
+func (ms *MySQLStorer) ChangePassword(ctx context.Context, u *User, newHash, exceptFamilyID string) (int64, error) {
+	var revoked int64
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE users SET password=?, updated_at=? WHERE id=? AND password=?", newHash, time.Now(), u.ID, u.Password)
+		if err != nil {
+			return fmt.Errorf("error updating password: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+		if n == 0 {
+			return ErrPasswordChanged
+		}
+
+		res, err = tx.ExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id<>? AND is_revoked=0", u.Email, exceptFamilyID)
+		if err != nil {
+			return fmt.Errorf("error revoking sessions: %w", err)
+		}
+		revoked, err = res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("error changing password: %w", err)
+	}
+
+	return revoked, nil
+}
+
 func (ms *MySQLStorer) DeleteUser(ctx context.Context, id int64) error {
 	_, err := ms.db.ExecContext(ctx, "DELETE FROM users WHERE id=?", id)
 
@@ -283,44 +438,1139 @@ func (ms *MySQLStorer) DeleteUser(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (ms *MySQLStorer) CreateSession(ctx context.Context, s *Session) (*Session, error) {
-	_, err := ms.db.NamedExecContext(ctx, "INSERT INTO sessions (id, user_email, refresh_token, is_revoked, expires_at) VALUES (:id, :user_email, :refresh_token, :is_revoked, :expires_at)", s)
+// ListUserRoles returns the names of the roles assigned to the user.
+func (ms *MySQLStorer) ListUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	var roles []string
+	err := ms.db.SelectContext(ctx, &roles, "SELECT r.name FROM roles r JOIN user_roles ur ON ur.role_id=r.id WHERE ur.user_id=? ORDER BY r.name", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing user roles: %w", err)
+	}
+
+	return roles, nil
+}
 
+// ListUserPermissions returns the names of the permissions granted by any of
+// the user's roles.
+func (ms *MySQLStorer) ListUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	var permissions []string
+	err := ms.db.SelectContext(ctx, &permissions, "SELECT DISTINCT p.name FROM permissions p JOIN role_permissions rp ON rp.permission_id=p.id JOIN user_roles ur ON ur.role_id=rp.role_id WHERE ur.user_id=? ORDER BY p.name", userID)
 	if err != nil {
-		return nil, fmt.Errorf("error inserting sessions: %w", err)
+		return nil, fmt.Errorf("error listing user permissions: %w", err)
 	}
 
-	return s, nil
+	return permissions, nil
 }
 
-func (ms *MySQLStorer) GetSession(ctx context.Context, id string) (*Session, error) {
-	var s Session
+// SetUserRoles replaces the roles of the user with the named ones.
+// ErrUnknownRole is returned if any of them does not exist.
+func (ms *MySQLStorer) SetUserRoles(ctx context.Context, userID int64, roles []string) error {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		var ids []int64
+		if len(roles) > 0 {
+			query, args, err := sqlx.In("SELECT id FROM roles WHERE name IN (?)", roles)
+			if err != nil {
+				return fmt.Errorf("error building query: %w", err)
+			}
+			err = tx.SelectContext(ctx, &ids, tx.Rebind(query), args...)
+			if err != nil {
+				return fmt.Errorf("error getting roles: %w", err)
+			}
+			if len(ids) != len(roles) {
+				return ErrUnknownRole
+			}
+		}
 
-	err := ms.db.GetContext(ctx, &s, "SELECT * FROM sessions WHERE id=?", id)
+		_, err := tx.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id=?", userID)
+		if err != nil {
+			return fmt.Errorf("error deleting user roles: %w", err)
+		}
+
+		for _, id := range ids {
+			_, err = tx.ExecContext(ctx, "INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, id)
+			if err != nil {
+				return fmt.Errorf("error inserting user role: %w", err)
+			}
+		}
+
+		return nil
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("error getting session: %w", err)
+		return fmt.Errorf("error setting user roles: %w", err)
 	}
 
-	return &s, nil
+	return nil
 }
 
-func (ms *MySQLStorer) RevokeSession(ctx context.Context, id string) error {
-	_, err := ms.db.NamedExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE id=:id", map[string]interface{}{"id":id})
+// ListRoles returns every role with the permissions it grants.
+func (ms *MySQLStorer) ListRoles(ctx context.Context) ([]*Role, error) {
+	var roles []*Role
+	err := ms.db.SelectContext(ctx, &roles, "SELECT * FROM roles ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("error listing roles: %w", err)
+	}
 
+	var grants []struct {
+		RoleID     int64  `db:"role_id"`
+		Permission string `db:"name"`
+	}
+	err = ms.db.SelectContext(ctx, &grants, "SELECT rp.role_id, p.name FROM role_permissions rp JOIN permissions p ON p.id=rp.permission_id ORDER BY p.name")
 	if err != nil {
-		return fmt.Errorf("error updating session: %w", err)
+		return nil, fmt.Errorf("error listing role permissions: %w", err)
+	}
+
+	byID := make(map[int64]*Role, len(roles))
+	for _, r := range roles {
+		byID[r.ID] = r
+	}
+	for _, g := range grants {
+		if r, ok := byID[g.RoleID]; ok {
+			r.Permissions = append(r.Permissions, g.Permission)
+		}
+	}
+
+	return roles, nil
+}
+
+func (ms *MySQLStorer) CreateAPIKey(ctx context.Context, k *APIKey) (*APIKey, error) {
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+
+	res, err := ms.db.NamedExecContext(ctx, "INSERT INTO api_keys (name, prefix, key_hash, user_id, scopes, created_by, created_at, expires_at) VALUES (:name, :prefix, :key_hash, :user_id, :scopes, :created_by, :created_at, :expires_at)", k)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting api key: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error getting last inserted id: %w", err)
+	}
+	k.ID = id
+
+	return k, nil
+}
+
+func (ms *MySQLStorer) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	var k APIKey
+	err := ms.db.GetContext(ctx, &k, "SELECT * FROM api_keys WHERE prefix=?", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error getting api key: %w", err)
+	}
+
+	return &k, nil
+}
+
+func (ms *MySQLStorer) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	var keys []*APIKey
+	err := ms.db.SelectContext(ctx, &keys, "SELECT * FROM api_keys ORDER BY id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("error listing api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the key at now and returns it. sql.ErrNoRows is
+// returned if it does not exist. Revoking a key twice keeps the first time.
+func (ms *MySQLStorer) RevokeAPIKey(ctx context.Context, id int64, now time.Time) (*APIKey, error) {
+	var k APIKey
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &k, "SELECT * FROM api_keys WHERE id=? FOR UPDATE", id)
+		if err != nil {
+			return fmt.Errorf("error getting api key: %w", err)
+		}
+
+		if k.RevokedAt != nil {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at=? WHERE id=?", now, id)
+		if err != nil {
+			return fmt.Errorf("error revoking api key: %w", err)
+		}
+		k.RevokedAt = &now
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error revoking api key: %w", err)
+	}
+
+	return &k, nil
+}
+
+// TouchAPIKey records that the key was used at now.
+func (ms *MySQLStorer) TouchAPIKey(ctx context.Context, id int64, now time.Time) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at=? WHERE id=?", now, id)
+	if err != nil {
+		return fmt.Errorf("error updating api key: %w", err)
 	}
 
 	return nil
 }
 
-func (ms *MySQLStorer) DeleteSession(ctx context.Context, id string) error {
-	_, err := ms.db.ExecContext(ctx, "DELETE FROM sessions WHERE id=?", id)
+// RecordFailedLogin counts a failed login of the user and locks the account
+// for lockFor every time the count of consecutive failures reaches a multiple
+// of lockAfter. A lockAfter of 0 never locks.
+func (ms *MySQLStorer) RecordFailedLogin(ctx context.Context, id int64, lockAfter int64, lockFor time.Duration) (*User, error) {
+	var u User
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &u, "SELECT * FROM users WHERE id=? FOR UPDATE", id)
+		if err != nil {
+			return fmt.Errorf("error getting user: %w", err)
+		}
+
+		u.FailedLoginAttempts++
+		if lockAfter > 0 && u.FailedLoginAttempts%lockAfter == 0 {
+			lockedUntil := time.Now().Add(lockFor)
+			u.LockedUntil = &lockedUntil
+		}
+
+		_, err = tx.NamedExecContext(ctx, "UPDATE users SET failed_login_attempts=:failed_login_attempts, locked_until=:locked_until WHERE id=:id", &u)
+		if err != nil {
+			return fmt.Errorf("error updating failed logins: %w", err)
+		}
+
+		return nil
+	})
 
 	if err != nil {
-		return fmt.Errorf("error deleting session: %w", err)
+		return nil, fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	return &u, nil
+}
+
+// ResetFailedLogins clears the failed login count and any lock of the user,
+// after a successful login or when an admin unlocks the account.
+func (ms *MySQLStorer) ResetFailedLogins(ctx context.Context, id int64) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE users SET failed_login_attempts=0, locked_until=NULL WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("error resetting failed logins: %w", err)
+	}
+
+	return nil
+}
+
+// StartTOTPEnrollment stores the secret of an authenticator app the user is
+// enrolling, replacing that of an unconfirmed enrollment. ErrTOTPEnabled is
+// returned if the user already confirmed one.
+func (ms *MySQLStorer) StartTOTPEnrollment(ctx context.Context, userID int64, secret string) error {
+	res, err := ms.db.ExecContext(ctx, "UPDATE users SET totp_secret=?, totp_last_step=NULL WHERE id=? AND totp_enabled_at IS NULL", secret, userID)
+	if err != nil {
+		return fmt.Errorf("error storing totp secret: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrTOTPEnabled
+	}
+
+	return nil
+}
+
+// EnableTOTP confirms the enrollment of the user, recording step as used, and
+// replaces the user's recovery codes with codeHashes. ErrTOTPEnabled is
+// returned if it was confirmed before.
+func (ms *MySQLStorer) EnableTOTP(ctx context.Context, userID int64, step int64, codeHashes []string, now time.Time) error {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE users SET totp_enabled_at=?, totp_last_step=? WHERE id=? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL", now, step, userID)
+		if err != nil {
+			return fmt.Errorf("error enabling totp: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+		if n == 0 {
+			return ErrTOTPEnabled
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes, now)
+	})
+
+	if err != nil {
+		return fmt.Errorf("error enabling totp: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID int64, codeHashes []string, now time.Time) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id=?", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)", userID, hash, now)
+		if err != nil {
+			return fmt.Errorf("error inserting recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UseTOTPStep records that the user's code of step was used and reports
+// whether it was still unused, that is later than the last one used.
+func (ms *MySQLStorer) UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	res, err := ms.db.ExecContext(ctx, "UPDATE users SET totp_last_step=? WHERE id=? AND totp_enabled_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < ?)", step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error using totp step: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// UseRecoveryCode marks the user's unused recovery code with the hash as used
+// and reports whether there was one.
+func (ms *MySQLStorer) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, now time.Time) (bool, error) {
+	res, err := ms.db.ExecContext(ctx, "UPDATE mfa_recovery_codes SET used_at=? WHERE user_id=? AND code_hash=? AND used_at IS NULL", now, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// DisableTOTP removes the authenticator app and the recovery codes of the
+// user.
+func (ms *MySQLStorer) DisableTOTP(ctx context.Context, userID int64) error {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "UPDATE users SET totp_secret=NULL, totp_enabled_at=NULL, totp_last_step=NULL WHERE id=?", userID)
+		if err != nil {
+			return fmt.Errorf("error disabling totp: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id=?", userID)
+		if err != nil {
+			return fmt.Errorf("error deleting recovery codes: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error disabling totp: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// GetUserByIdentity returns the user linked to the subject at the provider.
+func (ms *MySQLStorer) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	var u User
+	err := ms.db.GetContext(ctx, &u, "SELECT u.* FROM users u JOIN user_identities i ON i.user_id=u.id WHERE i.provider=? AND i.subject=?", provider, subject)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	return &u, nil
+}
+
+const insertIdentityQuery = "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES (:user_id, :provider, :subject, :email, :created_at)"
+
+// LinkIdentity links the identity to its user.
+func (ms *MySQLStorer) LinkIdentity(ctx context.Context, i *Identity) error {
+	_, err := ms.db.NamedExecContext(ctx, insertIdentityQuery, i)
+	if err != nil {
+		return fmt.Errorf("error linking identity: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity creates a user without a password, whose email
+// address was verified by the provider of the identity, and links the
+// identity to it.
+func (ms *MySQLStorer) CreateUserWithIdentity(ctx context.Context, u *User, i *Identity) (*User, error) {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.NamedExecContext(ctx, "INSERT INTO users (name, email, password, email_verified_at) VALUES (:name, :email, :password, :email_verified_at)", u)
+		if err != nil {
+			return fmt.Errorf("error inserting user: %w", err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last inserted id: %w", err)
+		}
+		u.ID = id
+		i.UserID = id
+
+		if _, err := tx.NamedExecContext(ctx, insertIdentityQuery, i); err != nil {
+			return fmt.Errorf("error linking identity: %w", err)
+		}
+
+		return createOutboxEvent(ctx, tx, AggregateUser, strconv.FormatInt(u.ID, 10), EventUserRegistered, UserRegisteredPayload{
+			UserID: u.ID,
+			Name:   u.Name,
+			Email:  u.Email,
+		})
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error creating user: %w", err)
+	}
+
+	return u, nil
+}
+
+const insertSessionQuery = "INSERT INTO sessions (id, family_id, user_email, is_revoked, user_agent, ip_address, created_at, last_used_at, expires_at) VALUES (:id, :family_id, :user_email, :is_revoked, :user_agent, :ip_address, :created_at, :last_used_at, :expires_at)"
+
+// CreateSession stores a session. A session without a family starts a new
+// one named after itself.
+func (ms *MySQLStorer) CreateSession(ctx context.Context, s *Session) (*Session, error) {
+	if s.FamilyID == "" {
+		s.FamilyID = s.ID
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+
+	_, err := ms.db.NamedExecContext(ctx, insertSessionQuery, s)
+
+	if err != nil {
+		return nil, fmt.Errorf("error inserting sessions: %w", err)
+	}
+
+	return s, nil
+}
+
+func (ms *MySQLStorer) GetSession(ctx context.Context, id string) (*Session, error) {
+	var s Session
+
+	err := ms.db.GetContext(ctx, &s, "SELECT * FROM sessions WHERE id=?", id)
+
+	if err != nil {
+		return nil, fmt.Errorf("error getting session: %w", err)
+	}
+
+	return &s, nil
+}
+
+// RotateSession marks the session with the given id as used and stores next
+// in its family in its place. next keeps the user and creation time of the
+// session it replaces and is marked as last used now. Rotating a session that was already used means
+// its refresh token was presented twice, so every session of the family is
+// revoked and ErrRefreshTokenReused is returned. ErrInvalidSession is
+// returned for unknown, revoked or expired sessions.
+func (ms *MySQLStorer) RotateSession(ctx context.Context, id string, next *Session) (*Session, error) {
+	reused := false
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		var s Session
+		err := tx.GetContext(ctx, &s, "SELECT * FROM sessions WHERE id=? FOR UPDATE", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidSession
+		}
+		if err != nil {
+			return fmt.Errorf("error getting session: %w", err)
+		}
+
+		if s.IsRevoked {
+			return ErrInvalidSession
+		}
+
+		if s.UsedAt != nil {
+			// the revocation has to be committed, so the error is only
+			// returned once the transaction is done
+			_, err = tx.ExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE family_id=?", s.FamilyID)
+			if err != nil {
+				return fmt.Errorf("error revoking session family: %w", err)
+			}
+			reused = true
+			return nil
+		}
+
+		now := time.Now()
+		if !now.Before(s.ExpiresAt) {
+			return ErrInvalidSession
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE sessions SET used_at=?, replaced_by=? WHERE id=?", now, next.ID, s.ID)
+		if err != nil {
+			return fmt.Errorf("error updating session: %w", err)
+		}
+
+		next.UserEmail = s.UserEmail
+		next.FamilyID = s.FamilyID
+		next.CreatedAt = s.CreatedAt
+		next.LastUsedAt = &now
+		_, err = tx.NamedExecContext(ctx, insertSessionQuery, next)
+		if err != nil {
+			return fmt.Errorf("error inserting session: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error rotating session: %w", err)
+	}
+
+	if reused {
+		return nil, fmt.Errorf("error rotating session: %w", ErrRefreshTokenReused)
+	}
+
+	return next, nil
+}
+
+// ListSessions returns the sessions of the user that can still be renewed,
+// one per family, most recently created first.
+func (ms *MySQLStorer) ListSessions(ctx context.Context, email string, now time.Time) ([]*Session, error) {
+	var sessions []*Session
+
+	err := ms.db.SelectContext(ctx, &sessions, "SELECT * FROM sessions WHERE user_email=? AND is_revoked=0 AND used_at IS NULL AND expires_at>? ORDER BY created_at DESC", email, now)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSessionFamily revokes every session of the user in the given family
+// and returns how many were still active.
+func (ms *MySQLStorer) RevokeSessionFamily(ctx context.Context, email, familyID string) (int64, error) {
+	res, err := ms.db.ExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id=? AND is_revoked=0", email, familyID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking session family: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+// RevokeUserSessions revokes every session of the user outside the family
+// exceptFamilyID, or all of them if it is empty, and returns how many were
+// still active.
+func (ms *MySQLStorer) RevokeUserSessions(ctx context.Context, email, exceptFamilyID string) (int64, error) {
+	res, err := ms.db.ExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id<>? AND is_revoked=0", email, exceptFamilyID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+// DeleteExpiredSessions deletes sessions whose refresh token has expired.
+// RotateSession rejects sessions past their expires_at, so their refresh
+// tokens can not be renewed with anymore and the rows are no longer needed to
+// detect reuse.
+func (ms *MySQLStorer) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	res, err := ms.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at<=?", now)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+// DenyToken records that the token with the given ID must be rejected until
+// it expires. Denying a token twice keeps the later expiry.
+func (ms *MySQLStorer) DenyToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := ms.db.ExecContext(ctx, "INSERT INTO token_denylist (jti, expires_at) VALUES (?, ?) ON DUPLICATE KEY UPDATE expires_at=GREATEST(expires_at, VALUES(expires_at))", jti, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error denying token: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) IsTokenDenied(ctx context.Context, jti string, now time.Time) (bool, error) {
+	var n int
+	err := ms.db.GetContext(ctx, &n, "SELECT COUNT(*) FROM token_denylist WHERE jti=? AND expires_at>?", jti, now)
+	if err != nil {
+		return false, fmt.Errorf("error checking token denylist: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+// IsTokenRevoked reports whether the token with the given ID was denied or
+// the session family it was issued for was revoked. Tokens not bound to a
+// session have an empty familyID.
+func (ms *MySQLStorer) IsTokenRevoked(ctx context.Context, jti, familyID string, now time.Time) (bool, error) {
+	var revoked bool
+	err := ms.db.GetContext(ctx, &revoked, "SELECT EXISTS (SELECT 1 FROM token_denylist WHERE jti=? AND expires_at>?) OR EXISTS (SELECT 1 FROM sessions WHERE family_id=? AND is_revoked=1)", jti, now, familyID)
+	if err != nil {
+		return false, fmt.Errorf("error checking token revocation: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (ms *MySQLStorer) DeleteExpiredDeniedTokens(ctx context.Context, now time.Time) (int64, error) {
+	res, err := ms.db.ExecContext(ctx, "DELETE FROM token_denylist WHERE expires_at<=?", now)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired denied tokens: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+func (ms *MySQLStorer) RevokeSession(ctx context.Context, id string) error {
+	_, err := ms.db.NamedExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE id=:id", map[string]interface{}{"id":id})
+
+	if err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) DeleteSession(ctx context.Context, id string) error {
+	_, err := ms.db.ExecContext(ctx, "DELETE FROM sessions WHERE id=?", id)
+
+	if err != nil {
+		return fmt.Errorf("error deleting session: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUserToken stores a token of the user in table, one of
+// PasswordResetTokens and EmailVerificationTokens. Tokens of the user that
+// were used or have expired are deleted on the way.
+func (ms *MySQLStorer) CreateUserToken(ctx context.Context, table string, t *UserToken) error {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id=? AND (used_at IS NOT NULL OR expires_at<=?)", t.UserID, time.Now())
+		if err != nil {
+			return fmt.Errorf("error deleting stale tokens: %w", err)
+		}
+
+		_, err = tx.NamedExecContext(ctx, "INSERT INTO "+table+" (user_id, token_hash, expires_at) VALUES (:user_id, :token_hash, :expires_at)", t)
+		if err != nil {
+			return fmt.Errorf("error inserting token: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error creating user token: %w", err)
+	}
+
+	return nil
+}
+
+// useUserToken locks the token with the given hash and, if it is unused and
+// unexpired, marks it and every other token of the same user in table as
+// used. It returns the locked user the token belongs to.
+func useUserToken(ctx context.Context, tx *sqlx.Tx, table, tokenHash string, now time.Time) (*User, error) {
+	var t UserToken
+	err := tx.GetContext(ctx, &t, "SELECT * FROM "+table+" WHERE token_hash=? FOR UPDATE", tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting token: %w", err)
+	}
+
+	if t.UsedAt != nil || !now.Before(t.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE "+table+" SET used_at=? WHERE user_id=? AND used_at IS NULL", now, t.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error using tokens: %w", err)
+	}
+
+	var u User
+	err = tx.GetContext(ctx, &u, "SELECT * FROM users WHERE id=? FOR UPDATE", t.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	return &u, nil
+}
+
+// GetUserByToken returns the user an unused and unexpired token in table
+// belongs to without using the token up. ErrInvalidToken is returned if the
+// token cannot be used.
+func (ms *MySQLStorer) GetUserByToken(ctx context.Context, table, tokenHash string, now time.Time) (*User, error) {
+	var u User
+	err := ms.db.GetContext(ctx, &u, "SELECT u.* FROM users u JOIN "+table+" t ON t.user_id=u.id WHERE t.token_hash=? AND t.used_at IS NULL AND t.expires_at>?", tokenHash, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user by token: %w", err)
+	}
+
+	return &u, nil
+}
+
+// ResetPassword sets the password of the user an unused and unexpired reset
+// token belongs to to hashedPassword. In the same transaction every reset
+// token of the user is used up, any lockout is lifted and all sessions of the
+// user are revoked. ErrInvalidToken is returned if the token cannot be used.
+func (ms *MySQLStorer) ResetPassword(ctx context.Context, tokenHash, hashedPassword string) (*User, error) {
+	var u *User
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now()
+
+		var err error
+		u, err = useUserToken(ctx, tx, PasswordResetTokens, tokenHash, now)
+		if err != nil {
+			return err
+		}
+
+		u.Password = hashedPassword
+		u.FailedLoginAttempts = 0
+		u.LockedUntil = nil
+		u.UpdatedAt = &now
+		_, err = tx.NamedExecContext(ctx, "UPDATE users SET password=:password, failed_login_attempts=:failed_login_attempts, locked_until=:locked_until, updated_at=:updated_at WHERE id=:id", u)
+		if err != nil {
+			return fmt.Errorf("error updating password: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE sessions SET is_revoked=1 WHERE user_email=?", u.Email)
+		if err != nil {
+			return fmt.Errorf("error revoking sessions: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error resetting password: %w", err)
+	}
+
+	return u, nil
+}
+
+// VerifyEmail marks the email of the user an unused and unexpired
+// verification token belongs to as verified and uses up the user's
+// verification tokens. ErrInvalidToken is returned if the token cannot be
+// used.
+func (ms *MySQLStorer) VerifyEmail(ctx context.Context, tokenHash string) (*User, error) {
+	var u *User
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now()
+
+		var err error
+		u, err = useUserToken(ctx, tx, EmailVerificationTokens, tokenHash, now)
+		if err != nil {
+			return err
+		}
+
+		if u.EmailVerifiedAt != nil {
+			return nil
+		}
+
+		u.EmailVerifiedAt = &now
+		_, err = tx.ExecContext(ctx, "UPDATE users SET email_verified_at=? WHERE id=?", now, u.ID)
+		if err != nil {
+			return fmt.Errorf("error updating user: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error verifying email: %w", err)
+	}
+
+	return u, nil
+}
+
+// createOutboxEvent records a domain event in the outbox table. It must run in
+// the same transaction as the change it describes so that the event is stored
+// if and only if the change is committed.
+func createOutboxEvent(ctx context.Context, tx *sqlx.Tx, aggregateType, aggregateID, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding %s payload: %w", eventType, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)", aggregateType, aggregateID, eventType, data)
+	if err != nil {
+		return fmt.Errorf("error inserting outbox event: %w", err)
+	}
+
+	return nil
+}
+
+// ListPendingOutboxEvents returns unpublished events that are due at now, in
+// insertion order. An event is left out while an earlier pending event of the
+// same aggregate is still waiting for its retry time, so that events of the
+// same aggregate are published in order.
+func (ms *MySQLStorer) ListPendingOutboxEvents(ctx context.Context, now time.Time, limit int) ([]*OutboxEvent, error) {
+	var events []*OutboxEvent
+
+	err := ms.db.SelectContext(ctx, &events, "SELECT * FROM outbox o WHERE o.status=? AND o.available_at<=? AND NOT EXISTS (SELECT 1 FROM outbox e WHERE e.aggregate_type=o.aggregate_type AND e.aggregate_id=o.aggregate_id AND e.status=? AND e.id<o.id AND e.available_at>?) ORDER BY o.id LIMIT ?", OutboxStatusPending, now, OutboxStatusPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing pending outbox events: %w", err)
+	}
+
+	return events, nil
+}
+
+// outboxRelayLock is the name of the MySQL advisory lock held by the outbox
+// relay while it works through a batch.
+const outboxRelayLock = "golang_microservice.outbox_relay"
+
+// LockOutboxRelay takes the outbox relay lock without waiting. It returns
+// false if another relay holds it. The lock belongs to a dedicated connection
+// and is held until unlock is called.
+func (ms *MySQLStorer) LockOutboxRelay(ctx context.Context) (unlock func() error, ok bool, err error) {
+	conn, err := ms.db.Connx(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting connection for outbox relay lock: %w", err)
+	}
+
+	var acquired sql.NullInt64
+	err = conn.GetContext(ctx, &acquired, "SELECT GET_LOCK(?, 0)", outboxRelayLock)
+	if err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("error taking outbox relay lock: %w", err)
+	}
+
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock = func() error {
+		defer conn.Close()
+
+		_, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", outboxRelayLock)
+		if err != nil {
+			// drop the connection instead of returning it to the pool, so
+			// that MySQL releases the lock along with the session
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+			return fmt.Errorf("error releasing outbox relay lock: %w", err)
+		}
+
+		return nil
+	}
+
+	return unlock, true, nil
+}
+
+func (ms *MySQLStorer) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE outbox SET status=?, published_at=? WHERE id=?", OutboxStatusPublished, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error marking outbox event as published: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) MarkOutboxEventFailed(ctx context.Context, id int64, reason string, retryAt time.Time) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE outbox SET attempts=attempts+1, last_error=?, available_at=? WHERE id=?", reason, retryAt, id)
+	if err != nil {
+		return fmt.Errorf("error marking outbox event as failed: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) MarkOutboxEventDead(ctx context.Context, id int64, reason string) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE outbox SET status=?, attempts=attempts+1, last_error=? WHERE id=?", OutboxStatusDead, reason, id)
+	if err != nil {
+		return fmt.Errorf("error dead-lettering outbox event: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) CreateWebhookSubscription(ctx context.Context, ws *WebhookSubscription) (*WebhookSubscription, error) {
+	res, err := ms.db.NamedExecContext(ctx, "INSERT INTO webhook_subscriptions (url, event_types, secret, is_active) VALUES (:url, :event_types, :secret, :is_active)", ws)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting webhook subscription: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error getting last inserted id: %w", err)
+	}
+	ws.ID = id
+
+	return ws, nil
+}
+
+func (ms *MySQLStorer) GetWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	var ws WebhookSubscription
+
+	err := ms.db.GetContext(ctx, &ws, "SELECT * FROM webhook_subscriptions WHERE id=?", id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook subscription: %w", err)
+	}
+
+	return &ws, nil
+}
+
+func (ms *MySQLStorer) GetAllWebhookSubscriptions(ctx context.Context) ([]*WebhookSubscription, error) {
+	var subs []*WebhookSubscription
+
+	err := ms.db.SelectContext(ctx, &subs, "SELECT * FROM webhook_subscriptions")
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// GetActiveWebhookSubscriptions returns the active subscriptions interested in
+// eventType. event_types is stored as a comma-separated list.
+func (ms *MySQLStorer) GetActiveWebhookSubscriptions(ctx context.Context, eventType string) ([]*WebhookSubscription, error) {
+	var subs []*WebhookSubscription
+
+	err := ms.db.SelectContext(ctx, &subs, "SELECT * FROM webhook_subscriptions WHERE is_active=1 AND FIND_IN_SET(?, event_types)", eventType)
+	if err != nil {
+		return nil, fmt.Errorf("error listing active webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (ms *MySQLStorer) UpdateWebhookSubscription(ctx context.Context, ws *WebhookSubscription) (*WebhookSubscription, error) {
+	_, err := ms.db.NamedExecContext(ctx, "UPDATE webhook_subscriptions SET url=:url, event_types=:event_types, is_active=:is_active, consecutive_failures=:consecutive_failures, disabled_at=:disabled_at, updated_at=:updated_at WHERE id=:id", ws)
+	if err != nil {
+		return nil, fmt.Errorf("error updating webhook subscription: %w", err)
+	}
+
+	return ws, nil
+}
+
+func (ms *MySQLStorer) DeleteWebhookSubscription(ctx context.Context, id int64) error {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE subscription_id=?", id)
+		if err != nil {
+			return fmt.Errorf("error deleting webhook deliveries: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id=?", id)
+		if err != nil {
+			return fmt.Errorf("error deleting webhook subscription: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error deleting webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+// CreateWebhookDelivery schedules an event for delivery to a subscription.
+// Scheduling the same event twice for a subscription is a no-op, which makes
+// it safe to call from an at-least-once event consumer.
+func (ms *MySQLStorer) CreateWebhookDelivery(ctx context.Context, d *WebhookDelivery) error {
+	_, err := ms.db.NamedExecContext(ctx, "INSERT IGNORE INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at) VALUES (:subscription_id, :event_id, :event_type, :payload, :next_attempt_at)", d)
+	if err != nil {
+		return fmt.Errorf("error inserting webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) GetWebhookDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+
+	err := ms.db.GetContext(ctx, &d, "SELECT * FROM webhook_deliveries WHERE id=?", id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting webhook delivery: %w", err)
+	}
+
+	return &d, nil
+}
+
+func (ms *MySQLStorer) GetAllWebhookDeliveries(ctx context.Context, subscriptionID int64) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+
+	err := ms.db.SelectContext(ctx, &deliveries, "SELECT * FROM webhook_deliveries WHERE subscription_id=? ORDER BY id DESC", subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is due.
+// Deliveries of disabled subscriptions stay pending until they are re-enabled.
+func (ms *MySQLStorer) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+
+	err := ms.db.SelectContext(ctx, &deliveries, "SELECT d.* FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id=d.subscription_id WHERE d.status=? AND d.next_attempt_at<=? AND s.is_active=1 ORDER BY d.id LIMIT ?", WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing due webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookDeliveryAttempt stores the outcome of a delivery attempt and
+// updates the failure streak of its subscription, disabling the subscription
+// once the streak reaches disableAfter consecutive failures.
+func (ms *MySQLStorer) RecordWebhookDeliveryAttempt(ctx context.Context, d *WebhookDelivery, succeeded bool, disableAfter int64) error {
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExecContext(ctx, "UPDATE webhook_deliveries SET status=:status, attempts=:attempts, response_code=:response_code, last_error=:last_error, next_attempt_at=:next_attempt_at, delivered_at=:delivered_at WHERE id=:id", d)
+		if err != nil {
+			return fmt.Errorf("error updating webhook delivery: %w", err)
+		}
+
+		if succeeded {
+			_, err = tx.ExecContext(ctx, "UPDATE webhook_subscriptions SET consecutive_failures=0 WHERE id=?", d.SubscriptionID)
+			if err != nil {
+				return fmt.Errorf("error resetting webhook failures: %w", err)
+			}
+			return nil
+		}
+
+		var ws WebhookSubscription
+		err = tx.GetContext(ctx, &ws, "SELECT * FROM webhook_subscriptions WHERE id=? FOR UPDATE", d.SubscriptionID)
+		if err != nil {
+			return fmt.Errorf("error getting webhook subscription: %w", err)
+		}
+
+		ws.ConsecutiveFailures++
+		if ws.IsActive && disableAfter > 0 && ws.ConsecutiveFailures >= disableAfter {
+			now := time.Now()
+			ws.IsActive = false
+			ws.DisabledAt = &now
+		}
+
+		_, err = tx.NamedExecContext(ctx, "UPDATE webhook_subscriptions SET is_active=:is_active, consecutive_failures=:consecutive_failures, disabled_at=:disabled_at WHERE id=:id", &ws)
+		if err != nil {
+			return fmt.Errorf("error updating webhook failures: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("error recording webhook delivery attempt: %w", err)
+	}
+
+	return nil
+}
+
+// RedeliverWebhookDelivery resets a delivery so that it is retried from
+// scratch on the next dispatcher run.
+func (ms *MySQLStorer) RedeliverWebhookDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	_, err := ms.db.ExecContext(ctx, "UPDATE webhook_deliveries SET status=?, attempts=0, last_error=NULL, next_attempt_at=? WHERE id=?", WebhookDeliveryPending, time.Now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("error scheduling webhook redelivery: %w", err)
+	}
+
+	return ms.GetWebhookDelivery(ctx, id)
+}
+
+// ReserveIdempotencyKey claims k for the caller. If an unexpired record for
+// the same method, caller and key already exists it is returned instead and
+// nothing is written; an expired record is replaced.
+func (ms *MySQLStorer) ReserveIdempotencyKey(ctx context.Context, k *IdempotencyKey) (*IdempotencyKey, error) {
+	var existing *IdempotencyKey
+
+	err := ms.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE method=? AND caller=? AND idempotency_key=? AND expires_at<=?", k.Method, k.Caller, k.Key, time.Now())
+		if err != nil {
+			return fmt.Errorf("error deleting expired idempotency key: %w", err)
+		}
+
+		res, err := tx.NamedExecContext(ctx, "INSERT IGNORE INTO idempotency_keys (method, caller, idempotency_key, fingerprint, status, expires_at) VALUES (:method, :caller, :idempotency_key, :fingerprint, :status, :expires_at)", k)
+		if err != nil {
+			return fmt.Errorf("error inserting idempotency key: %w", err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+
+		if n > 0 {
+			return nil
+		}
+
+		var ik IdempotencyKey
+		err = tx.GetContext(ctx, &ik, "SELECT * FROM idempotency_keys WHERE method=? AND caller=? AND idempotency_key=?", k.Method, k.Caller, k.Key)
+		if err != nil {
+			return fmt.Errorf("error getting idempotency key: %w", err)
+		}
+		existing = &ik
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error reserving idempotency key: %w", err)
+	}
+
+	return existing, nil
+}
+
+func (ms *MySQLStorer) CompleteIdempotencyKey(ctx context.Context, method, caller, key string, response []byte) error {
+	_, err := ms.db.ExecContext(ctx, "UPDATE idempotency_keys SET status=?, response=? WHERE method=? AND caller=? AND idempotency_key=?", IdempotencyStatusCompleted, response, method, caller, key)
+	if err != nil {
+		return fmt.Errorf("error completing idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) DeleteIdempotencyKey(ctx context.Context, method, caller, key string) error {
+	_, err := ms.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE method=? AND caller=? AND idempotency_key=?", method, caller, key)
+	if err != nil {
+		return fmt.Errorf("error deleting idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (ms *MySQLStorer) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	res, err := ms.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at<=?", now)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
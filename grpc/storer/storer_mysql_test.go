@@ -2,8 +2,10 @@ package storer
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
@@ -225,7 +227,10 @@ func TestUpdateProduct(t *testing.T) {
 				require.NoError(t, err)
 				require.Equal(t, int64(1), cp.ID)
 
-				mock.ExpectExec("UPDATE products SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=? updated_at=? WHERE id=?").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE products SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=? WHERE id=?").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WithArgs(AggregateProduct, "1", EventProductUpdated, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
 
 				up, err := st.UpdateProduct(context.Background(), new_p)
 				require.NoError(t, err)
@@ -239,7 +244,9 @@ func TestUpdateProduct(t *testing.T) {
 		{
 			name: "failed updating product",
 			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
-				mock.ExpectExec("UPDATE products SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=? updated_at=? WHERE id=?").WillReturnError(fmt.Errorf("error updating product"))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE products SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=? WHERE id=?").WillReturnError(fmt.Errorf("error updating product"))
+				mock.ExpectRollback()
 
 				_, err := st.UpdateProduct(context.Background(), p)
 
@@ -248,6 +255,21 @@ func TestUpdateProduct(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "failed creating outbox event",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE products SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=? WHERE id=?").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WillReturnError(fmt.Errorf("error inserting outbox event"))
+				mock.ExpectRollback()
+
+				_, err := st.UpdateProduct(context.Background(), p)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 	}
 
 	for _, tc := range tcs {
@@ -331,9 +353,10 @@ func TestCreateOrder(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id) VALUES (?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WithArgs(AggregateOrder, "1", EventOrderCreated, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit()
 
 				co, err := st.CreateOrder(context.Background(), o)
@@ -348,7 +371,7 @@ func TestCreateOrder(t *testing.T) {
 			name: "failed creating order",
 			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order"))
+				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id) VALUES (?, ?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order"))
 				mock.ExpectRollback()
 				_, err := st.CreateOrder(context.Background(), o)
 				require.Error(t, err)
@@ -361,7 +384,7 @@ func TestCreateOrder(t *testing.T) {
 			name: "failed creating order item",
 			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id) VALUES (?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order item"))
 				mock.ExpectRollback()
 
@@ -372,13 +395,31 @@ func TestCreateOrder(t *testing.T) {
 
 			},
 		},
+		{
+			name: "failed creating outbox event",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id) VALUES (?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WillReturnError(fmt.Errorf("error inserting outbox event"))
+				mock.ExpectRollback()
+
+				_, err := st.CreateOrder(context.Background(), o)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 		{
 			name: "failed committing transaction",
 			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id) VALUES (?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WithArgs(AggregateOrder, "1", EventOrderCreated, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectCommit().WillReturnError(fmt.Errorf("error committing transaction"))
 
 				_, err := st.CreateOrder(context.Background(), o)
@@ -629,3 +670,1050 @@ func TestDeleteOrder(t *testing.T) {
 		})
 	}
 }
+
+
+func TestUpdateOrderStatus(t *testing.T) {
+	orderCols := []string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "user_id", "status", "created_at", "updated_at"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(orderCols).AddRow(1, "QRIS", 10.0, 20.0, 200.0, 1, OrderStatusPending, time.Now(), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM orders WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectExec("UPDATE orders SET status=?, updated_at=? WHERE id=?").WithArgs(OrderStatusShipped, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WithArgs(AggregateOrder, "1", EventOrderStatusChanged, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				o, err := st.UpdateOrderStatus(context.Background(), 1, OrderStatusShipped)
+				require.NoError(t, err)
+				require.Equal(t, OrderStatusShipped, o.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unchanged status emits no event",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(orderCols).AddRow(1, "QRIS", 10.0, 20.0, 200.0, 1, OrderStatusShipped, time.Now(), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM orders WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectCommit()
+
+				_, err := st.UpdateOrderStatus(context.Background(), 1, OrderStatusShipped)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed updating order",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(orderCols).AddRow(1, "QRIS", 10.0, 20.0, 200.0, 1, OrderStatusPending, time.Now(), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM orders WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectExec("UPDATE orders SET status=?, updated_at=? WHERE id=?").WillReturnError(fmt.Errorf("error updating order"))
+				mock.ExpectRollback()
+
+				_, err := st.UpdateOrderStatus(context.Background(), 1, OrderStatusShipped)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	u := &User{
+		Name:     "John Doe",
+		Email:    "john@example.com",
+		Password: "hashed",
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO users (name, email, password) VALUES (?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WithArgs(AggregateUser, "1", EventUserRegistered, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				cu, err := st.CreateUser(context.Background(), u)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), cu.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed inserting user",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO users (name, email, password) VALUES (?, ?, ?)").WillReturnError(fmt.Errorf("error inserting user"))
+				mock.ExpectRollback()
+
+				_, err := st.CreateUser(context.Background(), u)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+
+	tcs := []struct {
+		name       string
+		attempts   int64
+		wantLocked bool
+	}{
+		{name: "below threshold", attempts: 1, wantLocked: false},
+		{name: "locks at threshold", attempts: 2, wantLocked: true},
+		{name: "locks again at the next multiple", attempts: 5, wantLocked: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				rows := sqlmock.NewRows(userCols).AddRow(1, "John Doe", "john@example.com", "hashed", tc.attempts, nil, nil, time.Now(), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM users WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectExec("UPDATE users SET failed_login_attempts=?, locked_until=? WHERE id=?").WithArgs(tc.attempts+1, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				u, err := st.RecordFailedLogin(context.Background(), 1, 3, time.Minute)
+				require.NoError(t, err)
+				require.Equal(t, tc.attempts+1, u.FailedLoginAttempts)
+				if tc.wantLocked {
+					require.NotNil(t, u.LockedUntil)
+					require.WithinDuration(t, time.Now().Add(time.Minute), *u.LockedUntil, time.Second)
+				} else {
+					require.Nil(t, u.LockedUntil)
+				}
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestGetUserByToken(t *testing.T) {
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+	query := "SELECT u.* FROM users u JOIN password_reset_tokens t ON t.user_id=u.id WHERE t.token_hash=? AND t.used_at IS NULL AND t.expires_at>?"
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		now := time.Now()
+
+		mock.ExpectQuery(query).WithArgs("hash", now).
+			WillReturnRows(sqlmock.NewRows(userCols).AddRow(1, "John Doe", "john@example.com", "old", 0, nil, nil, time.Now(), nil))
+		mock.ExpectQuery(query).WithArgs("used", now).WillReturnRows(sqlmock.NewRows(userCols))
+
+		u, err := st.GetUserByToken(context.Background(), PasswordResetTokens, "hash", now)
+		require.NoError(t, err)
+		require.Equal(t, "john@example.com", u.Email)
+
+		_, err = st.GetUserByToken(context.Background(), PasswordResetTokens, "used", now)
+		require.ErrorIs(t, err, ErrInvalidToken)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	tokenCols := []string{"id", "user_id", "token_hash", "created_at", "expires_at", "used_at"}
+	userCols := []string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				tokenRows := sqlmock.NewRows(tokenCols).AddRow(1, 1, "hash", time.Now(), time.Now().Add(time.Hour), nil)
+				userRows := sqlmock.NewRows(userCols).AddRow(1, "John Doe", "john@example.com", "old", 4, time.Now().Add(time.Hour), nil, time.Now(), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM password_reset_tokens WHERE token_hash=? FOR UPDATE").WithArgs("hash").WillReturnRows(tokenRows)
+				mock.ExpectExec("UPDATE password_reset_tokens SET used_at=? WHERE user_id=? AND used_at IS NULL").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT * FROM users WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(userRows)
+				mock.ExpectExec("UPDATE users SET password=?, failed_login_attempts=?, locked_until=?, updated_at=? WHERE id=?").WithArgs("new", 0, nil, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=?").WithArgs("john@example.com").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				u, err := st.ResetPassword(context.Background(), "hash", "new")
+				require.NoError(t, err)
+				require.Equal(t, "new", u.Password)
+				require.Nil(t, u.LockedUntil)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "used token",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				tokenRows := sqlmock.NewRows(tokenCols).AddRow(1, 1, "hash", time.Now(), time.Now().Add(time.Hour), time.Now())
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM password_reset_tokens WHERE token_hash=? FOR UPDATE").WithArgs("hash").WillReturnRows(tokenRows)
+				mock.ExpectRollback()
+
+				_, err := st.ResetPassword(context.Background(), "hash", "new")
+				require.ErrorIs(t, err, ErrInvalidToken)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "expired token",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				tokenRows := sqlmock.NewRows(tokenCols).AddRow(1, 1, "hash", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM password_reset_tokens WHERE token_hash=? FOR UPDATE").WithArgs("hash").WillReturnRows(tokenRows)
+				mock.ExpectRollback()
+
+				_, err := st.ResetPassword(context.Background(), "hash", "new")
+				require.ErrorIs(t, err, ErrInvalidToken)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown token",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM password_reset_tokens WHERE token_hash=? FOR UPDATE").WithArgs("hash").WillReturnRows(sqlmock.NewRows(tokenCols))
+				mock.ExpectRollback()
+
+				_, err := st.ResetPassword(context.Background(), "hash", "new")
+				require.ErrorIs(t, err, ErrInvalidToken)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	user := &User{ID: 1, Email: "john@example.com", Password: "old"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE users SET password=?, updated_at=? WHERE id=? AND password=?").WithArgs("new", sqlmock.AnyArg(), 1, "old").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id<>? AND is_revoked=0").WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				revoked, err := st.ChangePassword(context.Background(), user, "new", "f1")
+				require.NoError(t, err)
+				require.EqualValues(t, 2, revoked)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "changed meanwhile",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE users SET password=?, updated_at=? WHERE id=? AND password=?").WithArgs("new", sqlmock.AnyArg(), 1, "old").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				_, err := st.ChangePassword(context.Background(), user, "new", "f1")
+				require.ErrorIs(t, err, ErrPasswordChanged)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		tokenRows := sqlmock.NewRows([]string{"id", "user_id", "token_hash", "created_at", "expires_at", "used_at"}).AddRow(1, 1, "hash", time.Now(), time.Now().Add(time.Hour), nil)
+		userRows := sqlmock.NewRows([]string{"id", "name", "email", "password", "failed_login_attempts", "locked_until", "email_verified_at", "created_at", "updated_at"}).
+			AddRow(1, "John Doe", "john@example.com", "hashed", 0, nil, nil, time.Now(), nil)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM email_verification_tokens WHERE token_hash=? FOR UPDATE").WithArgs("hash").WillReturnRows(tokenRows)
+		mock.ExpectExec("UPDATE email_verification_tokens SET used_at=? WHERE user_id=? AND used_at IS NULL").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT * FROM users WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(userRows)
+		mock.ExpectExec("UPDATE users SET email_verified_at=? WHERE id=?").WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		u, err := st.VerifyEmail(context.Background(), "hash")
+		require.NoError(t, err)
+		require.NotNil(t, u.EmailVerifiedAt)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestRotateSession(t *testing.T) {
+	sessionCols := []string{"id", "user_email", "is_revoked", "created_at", "expires_at", "family_id", "replaced_by", "used_at", "user_agent", "ip_address", "last_used_at"}
+	next := func() *Session {
+		return &Session{
+			ID:        "new",
+			ExpiresAt: time.Now().Add(24 * time.Hour),
+		}
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				createdAt := time.Now().Add(-time.Hour)
+				rows := sqlmock.NewRows(sessionCols).AddRow("old", "john@example.com", false, createdAt, time.Now().Add(time.Hour), "family", nil, nil, "curl/8.0", "10.0.0.1", nil)
+				n := next()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM sessions WHERE id=? FOR UPDATE").WithArgs("old").WillReturnRows(rows)
+				mock.ExpectExec("UPDATE sessions SET used_at=?, replaced_by=? WHERE id=?").WithArgs(sqlmock.AnyArg(), "new", "old").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO sessions (id, family_id, user_email, is_revoked, user_agent, ip_address, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+					WithArgs("new", "family", "john@example.com", false, "", "", createdAt, sqlmock.AnyArg(), n.ExpiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				s, err := st.RotateSession(context.Background(), "old", n)
+				require.NoError(t, err)
+				require.Equal(t, "family", s.FamilyID)
+				require.Equal(t, "john@example.com", s.UserEmail)
+				require.Equal(t, createdAt, s.CreatedAt)
+				require.NotNil(t, s.LastUsedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "reused refresh token",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(sessionCols).AddRow("old", "john@example.com", false, time.Now(), time.Now().Add(time.Hour), "family", "newer", time.Now(), "curl/8.0", "10.0.0.1", nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM sessions WHERE id=? FOR UPDATE").WithArgs("old").WillReturnRows(rows)
+				mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE family_id=?").WithArgs("family").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				_, err := st.RotateSession(context.Background(), "old", next())
+				require.ErrorIs(t, err, ErrRefreshTokenReused)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "revoked session",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(sessionCols).AddRow("old", "john@example.com", true, time.Now(), time.Now().Add(time.Hour), "family", nil, nil, "curl/8.0", "10.0.0.1", nil)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM sessions WHERE id=? FOR UPDATE").WithArgs("old").WillReturnRows(rows)
+				mock.ExpectRollback()
+
+				_, err := st.RotateSession(context.Background(), "old", next())
+				require.ErrorIs(t, err, ErrInvalidSession)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown session",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM sessions WHERE id=? FOR UPDATE").WithArgs("old").WillReturnRows(sqlmock.NewRows(sessionCols))
+				mock.ExpectRollback()
+
+				_, err := st.RotateSession(context.Background(), "old", next())
+				require.ErrorIs(t, err, ErrInvalidSession)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		now := time.Now()
+		rows := sqlmock.NewRows([]string{"id", "user_email", "is_revoked", "created_at", "expires_at", "family_id", "replaced_by", "used_at", "user_agent", "ip_address", "last_used_at"}).
+			AddRow("s2", "john@example.com", false, now, now.Add(time.Hour), "f2", nil, nil, "curl/8.0", "10.0.0.2", nil).
+			AddRow("s1", "john@example.com", false, now.Add(-time.Hour), now.Add(time.Hour), "f1", nil, nil, "Firefox", "10.0.0.1", now)
+
+		mock.ExpectQuery("SELECT * FROM sessions WHERE user_email=? AND is_revoked=0 AND used_at IS NULL AND expires_at>? ORDER BY created_at DESC").WithArgs("john@example.com", now).WillReturnRows(rows)
+
+		sessions, err := st.ListSessions(context.Background(), "john@example.com", now)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+		require.Equal(t, "f2", sessions[0].FamilyID)
+		require.Equal(t, "Firefox", sessions[1].UserAgent)
+		require.NotNil(t, sessions[1].LastUsedAt)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestRevokeSessions(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "family",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id=? AND is_revoked=0").WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+				n, err := st.RevokeSessionFamily(context.Background(), "john@example.com", "f1")
+				require.NoError(t, err)
+				require.EqualValues(t, 1, n)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "all but one family",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE sessions SET is_revoked=1 WHERE user_email=? AND family_id<>? AND is_revoked=0").WithArgs("john@example.com", "f1").WillReturnResult(sqlmock.NewResult(0, 3))
+
+				n, err := st.RevokeUserSessions(context.Background(), "john@example.com", "f1")
+				require.NoError(t, err)
+				require.EqualValues(t, 3, n)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		now := time.Now()
+		mock.ExpectExec("DELETE FROM sessions WHERE expires_at<=?").WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 5))
+
+		n, err := st.DeleteExpiredSessions(context.Background(), now)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, n)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestTokenDenylist(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		now := time.Now()
+		expiresAt := now.Add(15 * time.Minute)
+
+		mock.ExpectExec("INSERT INTO token_denylist (jti, expires_at) VALUES (?, ?) ON DUPLICATE KEY UPDATE expires_at=GREATEST(expires_at, VALUES(expires_at))").WithArgs("jti", expiresAt).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM token_denylist WHERE jti=? AND expires_at>?").WithArgs("jti", now).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM token_denylist WHERE jti=? AND expires_at>?").WithArgs("other", now).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		err := st.DenyToken(context.Background(), "jti", expiresAt)
+		require.NoError(t, err)
+
+		denied, err := st.IsTokenDenied(context.Background(), "jti", now)
+		require.NoError(t, err)
+		require.True(t, denied)
+
+		denied, err = st.IsTokenDenied(context.Background(), "other", now)
+		require.NoError(t, err)
+		require.False(t, denied)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		now := time.Now()
+		query := "SELECT EXISTS (SELECT 1 FROM token_denylist WHERE jti=? AND expires_at>?) OR EXISTS (SELECT 1 FROM sessions WHERE family_id=? AND is_revoked=1)"
+
+		mock.ExpectQuery(query).WithArgs("jti", now, "f1").WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(1))
+		mock.ExpectQuery(query).WithArgs("other", now, "f2").WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(0))
+
+		revoked, err := st.IsTokenRevoked(context.Background(), "jti", "f1", now)
+		require.NoError(t, err)
+		require.True(t, revoked)
+
+		revoked, err = st.IsTokenRevoked(context.Background(), "other", "f2", now)
+		require.NoError(t, err)
+		require.False(t, revoked)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestOutboxEvents(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "list pending",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "aggregate_type", "aggregate_id", "event_type", "payload", "status", "attempts", "last_error", "available_at", "created_at", "published_at"}).
+					AddRow(1, AggregateOrder, "1", EventOrderCreated, []byte(`{"order_id":1}`), OutboxStatusPending, 0, nil, time.Now(), time.Now(), nil)
+				now := time.Now()
+				mock.ExpectQuery("SELECT * FROM outbox o WHERE o.status=? AND o.available_at<=? AND NOT EXISTS (SELECT 1 FROM outbox e WHERE e.aggregate_type=o.aggregate_type AND e.aggregate_id=o.aggregate_id AND e.status=? AND e.id<o.id AND e.available_at>?) ORDER BY o.id LIMIT ?").
+					WithArgs(OutboxStatusPending, now, OutboxStatusPending, now, 10).WillReturnRows(rows)
+
+				events, err := st.ListPendingOutboxEvents(context.Background(), now, 10)
+				require.NoError(t, err)
+				require.Len(t, events, 1)
+				require.JSONEq(t, `{"order_id":1}`, string(events[0].Payload))
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "relay lock",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT GET_LOCK(?, 0)").WithArgs(outboxRelayLock).WillReturnRows(sqlmock.NewRows([]string{"GET_LOCK"}).AddRow(1))
+				mock.ExpectExec("DO RELEASE_LOCK(?)").WithArgs(outboxRelayLock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				unlock, ok, err := st.LockOutboxRelay(context.Background())
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.NoError(t, unlock())
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "relay lock held elsewhere",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT GET_LOCK(?, 0)").WithArgs(outboxRelayLock).WillReturnRows(sqlmock.NewRows([]string{"GET_LOCK"}).AddRow(0))
+
+				_, ok, err := st.LockOutboxRelay(context.Background())
+				require.NoError(t, err)
+				require.False(t, ok)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "mark published",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE outbox SET status=?, published_at=? WHERE id=?").WithArgs(OutboxStatusPublished, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+
+				err := st.MarkOutboxEventPublished(context.Background(), 1)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "mark dead",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE outbox SET status=?, attempts=attempts+1, last_error=? WHERE id=?").WithArgs(OutboxStatusDead, "boom", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+
+				err := st.MarkOutboxEventDead(context.Background(), 1, "boom")
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestRecordWebhookDeliveryAttempt(t *testing.T) {
+	subCols := []string{"id", "url", "event_types", "secret", "is_active", "consecutive_failures", "disabled_at", "created_at", "updated_at"}
+	d := &WebhookDelivery{ID: 1, SubscriptionID: 1, Status: WebhookDeliveryPending, Attempts: 1}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success resets failures",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE webhook_deliveries SET status=?, attempts=?, response_code=?, last_error=?, next_attempt_at=?, delivered_at=? WHERE id=?").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE webhook_subscriptions SET consecutive_failures=0 WHERE id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				err := st.RecordWebhookDeliveryAttempt(context.Background(), d, true, 3)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failure disables subscription at threshold",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(subCols).AddRow(1, "https://example.com/hook", EventOrderStatusChanged, "secret", true, 2, nil, time.Now(), nil)
+
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE webhook_deliveries SET status=?, attempts=?, response_code=?, last_error=?, next_attempt_at=?, delivered_at=? WHERE id=?").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("SELECT * FROM webhook_subscriptions WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectExec("UPDATE webhook_subscriptions SET is_active=?, consecutive_failures=?, disabled_at=? WHERE id=?").WithArgs(false, 3, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				err := st.RecordWebhookDeliveryAttempt(context.Background(), d, false, 3)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	k := &IdempotencyKey{
+		Method:      "/pb.golang_microservice/CreateOrder",
+		Caller:      "user:1",
+		Key:         "key-1",
+		Fingerprint: "abc",
+		Status:      IdempotencyStatusProcessing,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "reserved",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM idempotency_keys WHERE method=? AND caller=? AND idempotency_key=? AND expires_at<=?").WithArgs(k.Method, k.Caller, k.Key, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT IGNORE INTO idempotency_keys (method, caller, idempotency_key, fingerprint, status, expires_at) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				existing, err := st.ReserveIdempotencyKey(context.Background(), k)
+				require.NoError(t, err)
+				require.Nil(t, existing)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "already exists",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"method", "caller", "idempotency_key", "fingerprint", "status", "response", "created_at", "expires_at"}).
+					AddRow(k.Method, k.Caller, k.Key, "abc", IdempotencyStatusCompleted, []byte("res"), time.Now(), k.ExpiresAt)
+
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM idempotency_keys WHERE method=? AND caller=? AND idempotency_key=? AND expires_at<=?").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT IGNORE INTO idempotency_keys (method, caller, idempotency_key, fingerprint, status, expires_at) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT * FROM idempotency_keys WHERE method=? AND caller=? AND idempotency_key=?").WithArgs(k.Method, k.Caller, k.Key).WillReturnRows(rows)
+				mock.ExpectCommit()
+
+				existing, err := st.ReserveIdempotencyKey(context.Background(), k)
+				require.NoError(t, err)
+				require.Equal(t, IdempotencyStatusCompleted, existing.Status)
+				require.Equal(t, []byte("res"), existing.Response)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestSetUserRoles(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT id FROM roles WHERE name IN (?, ?)").WithArgs("superuser", "warehouse").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+				mock.ExpectExec("DELETE FROM user_roles WHERE user_id=?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)").WithArgs(7, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO user_roles (user_id, role_id) VALUES (?, ?)").WithArgs(7, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := st.SetUserRoles(context.Background(), 7, []string{"superuser", "warehouse"})
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "no roles",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM user_roles WHERE user_id=?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				err := st.SetUserRoles(context.Background(), 7, nil)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown role",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT id FROM roles WHERE name IN (?, ?)").WithArgs("pirate", "warehouse").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectRollback()
+
+				err := st.SetUserRoles(context.Background(), 7, []string{"pirate", "warehouse"})
+				require.ErrorIs(t, err, ErrUnknownRole)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+				err := mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestListRoles(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySqlStorer(db)
+		mock.ExpectQuery("SELECT * FROM roles ORDER BY name").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "created_at"}).
+			AddRow(1, "superuser", "Every permission", time.Now()).
+			AddRow(2, "warehouse", "Fulfils orders", time.Now()))
+		mock.ExpectQuery("SELECT rp.role_id, p.name FROM role_permissions rp JOIN permissions p ON p.id=rp.permission_id ORDER BY p.name").WillReturnRows(sqlmock.NewRows([]string{"role_id", "name"}).
+			AddRow(1, "orders:read_all").
+			AddRow(2, "orders:read_all").
+			AddRow(1, "users:delete"))
+
+		roles, err := st.ListRoles(context.Background())
+		require.NoError(t, err)
+		require.Len(t, roles, 2)
+		require.Equal(t, []string{"orders:read_all", "users:delete"}, roles[0].Permissions)
+		require.Equal(t, []string{"orders:read_all"}, roles[1].Permissions)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	keyCols := []string{"id", "name", "prefix", "key_hash", "user_id", "scopes", "created_by", "created_at", "expires_at", "last_used_at", "revoked_at"}
+	now := time.Now()
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM api_keys WHERE id=? FOR UPDATE").WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(keyCols).AddRow(1, "partner", "0123456789abcdef", "hash", 3, "orders:read_all", 2, now, nil, nil, nil))
+				mock.ExpectExec("UPDATE api_keys SET revoked_at=? WHERE id=?").WithArgs(now, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				k, err := st.RevokeAPIKey(context.Background(), 1, now)
+				require.NoError(t, err)
+				require.Equal(t, now, *k.RevokedAt)
+			},
+		},
+		{
+			name: "already revoked",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				revokedAt := now.Add(-time.Hour)
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM api_keys WHERE id=? FOR UPDATE").WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(keyCols).AddRow(1, "partner", "0123456789abcdef", "hash", 3, "orders:read_all", 2, now, nil, nil, revokedAt))
+				mock.ExpectCommit()
+
+				k, err := st.RevokeAPIKey(context.Background(), 1, now)
+				require.NoError(t, err)
+				require.Equal(t, revokedAt, *k.RevokedAt)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT * FROM api_keys WHERE id=? FOR UPDATE").WithArgs(1).WillReturnRows(sqlmock.NewRows(keyCols))
+				mock.ExpectRollback()
+
+				_, err := st.RevokeAPIKey(context.Background(), 1, now)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+				err := mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestEnableTOTP(t *testing.T) {
+	now := time.Now()
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE users SET totp_enabled_at=?, totp_last_step=? WHERE id=? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL").
+					WithArgs(now, 42, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM mfa_recovery_codes WHERE user_id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)").
+					WithArgs(1, "hash1", now).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)").
+					WithArgs(1, "hash2", now).WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+
+				err := st.EnableTOTP(context.Background(), 1, 42, []string{"hash1", "hash2"}, now)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "already enabled",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE users SET totp_enabled_at=?, totp_last_step=? WHERE id=? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL").
+					WithArgs(now, 42, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.EnableTOTP(context.Background(), 1, 42, []string{"hash1"}, now)
+				require.ErrorIs(t, err, ErrTOTPEnabled)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+				err := mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	tcs := []struct {
+		name     string
+		affected int64
+		want     bool
+	}{
+		{name: "unused", affected: 1, want: true},
+		{name: "used before", affected: 0, want: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				mock.ExpectExec("UPDATE users SET totp_last_step=? WHERE id=? AND totp_enabled_at IS NOT NULL AND (totp_last_step IS NULL OR totp_last_step < ?)").
+					WithArgs(42, 1, 42).WillReturnResult(sqlmock.NewResult(0, tc.affected))
+
+				ok, err := st.UseTOTPStep(context.Background(), 1, 42)
+				require.NoError(t, err)
+				require.Equal(t, tc.want, ok)
+				require.NoError(t, mock.ExpectationsWereMet())
+			})
+		})
+	}
+}
+
+func TestCreateUserWithIdentity(t *testing.T) {
+	now := time.Now()
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStorer, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO users (name, email, password, email_verified_at) VALUES (?, ?, ?, ?)").
+					WithArgs("John", "john@example.com", "", now).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)").
+					WithArgs(1, "google", "1234567890", "john@example.com", now).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload) VALUES (?, ?, ?, ?)").WithArgs(AggregateUser, "1", EventUserRegistered, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				i := &Identity{Provider: "google", Subject: "1234567890", Email: "john@example.com", CreatedAt: now}
+				u, err := st.CreateUserWithIdentity(context.Background(), &User{Name: "John", Email: "john@example.com", EmailVerifiedAt: &now}, i)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), u.ID)
+				require.Equal(t, int64(1), i.UserID)
+			},
+		},
+		{
+			name: "identity already linked",
+			test: func(t *testing.T, st *MySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("INSERT INTO users (name, email, password, email_verified_at) VALUES (?, ?, ?, ?)").
+					WithArgs("John", "john@example.com", "", now).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)").
+					WithArgs(1, "google", "1234567890", "john@example.com", now).WillReturnError(fmt.Errorf("duplicate entry"))
+				mock.ExpectRollback()
+
+				i := &Identity{Provider: "google", Subject: "1234567890", Email: "john@example.com", CreatedAt: now}
+				_, err := st.CreateUserWithIdentity(context.Background(), &User{Name: "John", Email: "john@example.com", EmailVerifiedAt: &now}, i)
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySqlStorer(db)
+				tc.test(t, st, mock)
+				err := mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
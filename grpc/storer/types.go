@@ -1,6 +1,10 @@
 package storer
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
 
 type Product struct {
 	ID           int64      `db:"id"`
@@ -23,6 +27,7 @@ type Order struct {
 	ShippingPrice float32    `db:"shipping_price"`
 	TotalPrice    float32    `db:"total_price"`
 	UserID        int64      `db:"user_id"`
+	Status        string     `db:"status"`
 	CreatedAt     time.Time  `db:"created_at"`
 	UpdatedAt     *time.Time `db:"updated_at"`
 	Items         []OrderItem
@@ -39,20 +44,261 @@ type OrderItem struct {
 }
 
 type User struct {
-	ID        int64      `db:"id"`
-	Name      string     `db:"name"`
-	Email     string     `db:"email"`
-	Password  string     `db:"password"`
-	IsAdmin   bool       `db:"is_admin"`
-	CreatedAt time.Time  `db:"created_at"`
-	UpdatedAt *time.Time `db:"updated_at"`
+	ID                  int64      `db:"id"`
+	Name                string     `db:"name"`
+	Email               string     `db:"email"`
+	Password            string     `db:"password"`
+	FailedLoginAttempts int64      `db:"failed_login_attempts"`
+	LockedUntil         *time.Time `db:"locked_until"`
+	EmailVerifiedAt     *time.Time `db:"email_verified_at"`
+	CreatedAt           time.Time  `db:"created_at"`
+	UpdatedAt           *time.Time `db:"updated_at"`
+	// TOTPSecret is set once the user starts enrolling an authenticator app,
+	// TOTPEnabledAt once the enrollment is confirmed with a first code.
+	TOTPSecret    *string    `db:"totp_secret"`
+	TOTPEnabledAt *time.Time `db:"totp_enabled_at"`
+	// TOTPLastStep is the time step of the last accepted code, so that a code
+	// can not be used twice.
+	TOTPLastStep *int64 `db:"totp_last_step"`
+}
+
+// Identity links a user to an account at an OpenID Connect provider, which
+// the user can log in with.
+type Identity struct {
+	ID       int64  `db:"id"`
+	UserID   int64  `db:"user_id"`
+	Provider string `db:"provider"`
+	// Subject identifies the account at the provider.
+	Subject   string    `db:"subject"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Role grants its permissions to the users it is assigned to.
+type Role struct {
+	ID          int64     `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+	Permissions []string  `db:"-"`
 }
 
+// APIKey lets a partner or another service act as UserID with the
+// permissions in Scopes. Only the hash of the key is stored, Prefix
+// identifies it.
+type APIKey struct {
+	ID         int64      `db:"id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash"`
+	UserID     int64      `db:"user_id"`
+	Scopes     string     `db:"scopes"`
+	CreatedBy  int64      `db:"created_by"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+// Session is a refresh token. Its ID is the hash of the token, the token
+// itself is only known to the client.
 type Session struct {
-	ID           string    `db:"id"`
-	UserEmail    string    `db:"user_email"`
-	RefreshToken string    `db:"refresh_token"`
-	IsRevoked    bool      `db:"is_revoked"`
-	CreatedAt    time.Time `db:"created_at"`
-	ExpiresAt    time.Time `db:"expires_at"`
+	ID         string     `db:"id"`
+	UserEmail  string     `db:"user_email"`
+	IsRevoked  bool       `db:"is_revoked"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	FamilyID   string     `db:"family_id"`
+	ReplacedBy *string    `db:"replaced_by"`
+	UsedAt     *time.Time `db:"used_at"`
+	UserAgent  string     `db:"user_agent"`
+	IPAddress  string     `db:"ip_address"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+}
+
+
+type OutboxEvent struct {
+	ID            int64           `db:"id"`
+	AggregateType string          `db:"aggregate_type"`
+	AggregateID   string          `db:"aggregate_id"`
+	EventType     string          `db:"event_type"`
+	Payload       json.RawMessage `db:"payload"`
+	Status        string          `db:"status"`
+	Attempts      int64           `db:"attempts"`
+	LastError     *string         `db:"last_error"`
+	AvailableAt   time.Time       `db:"available_at"`
+	CreatedAt     time.Time       `db:"created_at"`
+	PublishedAt   *time.Time      `db:"published_at"`
+}
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+)
+
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusShipped, OrderStatusDelivered:
+		return true
+	}
+	return false
+}
+
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusPublished = "published"
+	OutboxStatusDead      = "dead"
+)
+
+const (
+	AggregateOrder   = "order"
+	AggregateProduct = "product"
+	AggregateUser    = "user"
+)
+
+const (
+	EventOrderCreated       = "OrderCreated"
+	EventOrderStatusChanged = "OrderStatusChanged"
+	EventProductUpdated     = "ProductUpdated"
+	EventUserRegistered     = "UserRegistered"
+)
+
+func IsKnownEventType(eventType string) bool {
+	switch eventType {
+	case EventOrderCreated, EventOrderStatusChanged, EventProductUpdated, EventUserRegistered:
+		return true
+	}
+	return false
+}
+
+// Event payloads are what ends up in outbox.payload; they are kept separate
+// from the db models so that adding a column never leaks into published events.
+
+type OrderCreatedPayload struct {
+	OrderID       int64              `json:"order_id"`
+	UserID        int64              `json:"user_id"`
+	PaymentMethod string             `json:"payment_method"`
+	TaxPrice      float32            `json:"tax_price"`
+	ShippingPrice float32            `json:"shipping_price"`
+	TotalPrice    float32            `json:"total_price"`
+	Items         []OrderItemPayload `json:"items"`
+}
+
+type OrderItemPayload struct {
+	ProductID int64   `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  int64   `json:"quantity"`
+	Price     float32 `json:"price"`
+}
+
+type OrderStatusChangedPayload struct {
+	OrderID        int64  `json:"order_id"`
+	UserID         int64  `json:"user_id"`
+	PreviousStatus string `json:"previous_status"`
+	Status         string `json:"status"`
+}
+
+type ProductUpdatedPayload struct {
+	ProductID    int64   `json:"product_id"`
+	Name         string  `json:"name"`
+	Category     string  `json:"category"`
+	Price        float32 `json:"price"`
+	CountInStock int64   `json:"count_in_stock"`
+}
+
+type UserRegisteredPayload struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+}
+
+type WebhookSubscription struct {
+	ID                  int64      `db:"id"`
+	URL                 string     `db:"url"`
+	EventTypes          string     `db:"event_types"`
+	Secret              string     `db:"secret"`
+	IsActive            bool       `db:"is_active"`
+	ConsecutiveFailures int64      `db:"consecutive_failures"`
+	DisabledAt          *time.Time `db:"disabled_at"`
+	CreatedAt           time.Time  `db:"created_at"`
+	UpdatedAt           *time.Time `db:"updated_at"`
+}
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	ID             int64           `db:"id"`
+	SubscriptionID int64           `db:"subscription_id"`
+	EventID        int64           `db:"event_id"`
+	EventType      string          `db:"event_type"`
+	Payload        json.RawMessage `db:"payload"`
+	Status         string          `db:"status"`
+	Attempts       int64           `db:"attempts"`
+	ResponseCode   *int64          `db:"response_code"`
+	LastError      *string         `db:"last_error"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at"`
+	CreatedAt      time.Time       `db:"created_at"`
+	DeliveredAt    *time.Time      `db:"delivered_at"`
+}
+
+const (
+	IdempotencyStatusProcessing = "processing"
+	IdempotencyStatusCompleted  = "completed"
+)
+
+type IdempotencyKey struct {
+	Method      string    `db:"method"`
+	Caller      string    `db:"caller"`
+	Key         string    `db:"idempotency_key"`
+	Fingerprint string    `db:"fingerprint"`
+	Status      string    `db:"status"`
+	Response    []byte    `db:"response"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+// ErrInvalidToken is returned for single-use tokens that do not exist, were
+// already used or have expired.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ErrUnknownRole is returned when assigning a role that does not exist.
+var ErrUnknownRole = errors.New("unknown role")
+
+// ErrPasswordChanged is returned when changing a password that was changed
+// since it was read.
+var ErrPasswordChanged = errors.New("password changed")
+
+// ErrTOTPEnabled is returned when enrolling a user whose enrollment was
+// already confirmed, or confirming it again.
+var ErrTOTPEnabled = errors.New("totp already enabled")
+
+var (
+	// ErrInvalidSession is returned when rotating a session that does not
+	// exist, was revoked or has expired.
+	ErrInvalidSession = errors.New("invalid session")
+	// ErrRefreshTokenReused is returned when rotating a session that was
+	// already rotated. The whole family has been revoked by then.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// Tables of single-use tokens mailed to users. They share the UserToken
+// layout.
+const (
+	PasswordResetTokens     = "password_reset_tokens"
+	EmailVerificationTokens = "email_verification_tokens"
+)
+
+// UserToken is a single-use token mailed to a user. Only its hash is stored.
+type UserToken struct {
+	ID        int64      `db:"id"`
+	UserID    int64      `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
 }
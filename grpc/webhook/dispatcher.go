@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+)
+
+// Store is the subset of the storer the dispatcher needs. *storer.MySQLStorer
+// satisfies it.
+type Store interface {
+	GetActiveWebhookSubscriptions(ctx context.Context, eventType string) ([]*storer.WebhookSubscription, error)
+	GetWebhookSubscription(ctx context.Context, id int64) (*storer.WebhookSubscription, error)
+	CreateWebhookDelivery(ctx context.Context, d *storer.WebhookDelivery) error
+	GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*storer.WebhookDelivery, error)
+	RecordWebhookDeliveryAttempt(ctx context.Context, d *storer.WebhookDelivery, succeeded bool, disableAfter int64) error
+}
+
+type Config struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Timeout      time.Duration
+	MaxAttempts  int64
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// DisableAfter is the number of consecutive failed attempts after which
+	// a subscription is disabled. Zero never disables.
+	DisableAfter int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		BatchSize:    50,
+		Timeout:      10 * time.Second,
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		DisableAfter: 25,
+	}
+}
+
+// Envelope is the JSON body POSTed to subscribers.
+type Envelope struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Dispatcher fans outbox events out to webhook subscriptions and delivers
+// them. Enqueue is meant to be subscribed to the outbox in-process publisher;
+// Run performs the HTTP deliveries with retries.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    Config
+	now    func() time.Time
+}
+
+func NewDispatcher(store Store, cfg Config) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// Enqueue schedules a delivery of e for every active subscription interested
+// in its event type. It is idempotent per event and subscription.
+func (d *Dispatcher) Enqueue(ctx context.Context, e *storer.OutboxEvent) error {
+	subs, err := d.store.GetActiveWebhookSubscriptions(ctx, e.EventType)
+	if err != nil {
+		return err
+	}
+
+	if len(subs) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(Envelope{
+		ID:        e.ID,
+		Type:      e.EventType,
+		CreatedAt: e.CreatedAt,
+		Data:      e.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %w", err)
+	}
+
+	for _, sub := range subs {
+		err := d.store.CreateWebhookDelivery(ctx, &storer.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.EventType,
+			Payload:        body,
+			NextAttemptAt:  d.now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run delivers due webhooks until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DeliverBatch(ctx); err != nil {
+			slog.ErrorContext(ctx, "webhook dispatcher failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverBatch attempts one batch of due deliveries and returns how many
+// succeeded.
+func (d *Dispatcher) DeliverBatch(ctx context.Context) (int, error) {
+	deliveries, err := d.store.GetDueWebhookDeliveries(ctx, d.now(), d.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	subs := make(map[int64]*storer.WebhookSubscription)
+	succeeded := 0
+
+	for _, del := range deliveries {
+		sub, ok := subs[del.SubscriptionID]
+		if !ok {
+			sub, err = d.store.GetWebhookSubscription(ctx, del.SubscriptionID)
+			if err != nil {
+				return succeeded, err
+			}
+			subs[del.SubscriptionID] = sub
+		}
+
+		// an earlier delivery in this batch may have disabled the subscription
+		if !sub.IsActive {
+			continue
+		}
+
+		code, err := d.send(ctx, sub, del)
+		ok = d.record(del, code, err)
+		if ok {
+			succeeded++
+		} else {
+			sub.ConsecutiveFailures++
+			if d.cfg.DisableAfter > 0 && sub.ConsecutiveFailures >= d.cfg.DisableAfter {
+				sub.IsActive = false
+			}
+		}
+
+		if err := d.store.RecordWebhookDeliveryAttempt(ctx, del, ok, d.cfg.DisableAfter); err != nil {
+			return succeeded, err
+		}
+	}
+
+	return succeeded, nil
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub *storer.WebhookSubscription, del *storer.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, del.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(del.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, d.now(), del.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// record applies the outcome of an attempt to del and reports whether it
+// succeeded.
+func (d *Dispatcher) record(del *storer.WebhookDelivery, code int, err error) bool {
+	now := d.now()
+	del.Attempts++
+	del.ResponseCode = nil
+	if code != 0 {
+		c := int64(code)
+		del.ResponseCode = &c
+	}
+
+	if err == nil {
+		del.Status = storer.WebhookDeliverySucceeded
+		del.LastError = nil
+		del.DeliveredAt = &now
+		return true
+	}
+
+	reason := err.Error()
+	del.LastError = &reason
+	if del.Attempts >= d.cfg.MaxAttempts {
+		del.Status = storer.WebhookDeliveryFailed
+	} else {
+		del.NextAttemptAt = now.Add(d.backoff(del.Attempts))
+	}
+
+	return false
+}
+
+// backoff doubles the base delay with every attempt, capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempts int64) time.Duration {
+	delay := d.cfg.BaseBackoff
+	for i := int64(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+
+	return delay
+}
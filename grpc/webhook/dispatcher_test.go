@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abedsully/golang-microservice/grpc/storer"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	subs       map[int64]*storer.WebhookSubscription
+	deliveries []*storer.WebhookDelivery
+}
+
+func (s *fakeStore) GetActiveWebhookSubscriptions(ctx context.Context, eventType string) ([]*storer.WebhookSubscription, error) {
+	var res []*storer.WebhookSubscription
+	for _, sub := range s.subs {
+		if sub.IsActive && sub.EventTypes == eventType {
+			res = append(res, sub)
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeStore) GetWebhookSubscription(ctx context.Context, id int64) (*storer.WebhookSubscription, error) {
+	sub := *s.subs[id]
+	return &sub, nil
+}
+
+func (s *fakeStore) CreateWebhookDelivery(ctx context.Context, d *storer.WebhookDelivery) error {
+	d.ID = int64(len(s.deliveries) + 1)
+	d.Status = storer.WebhookDeliveryPending
+	s.deliveries = append(s.deliveries, d)
+	return nil
+}
+
+func (s *fakeStore) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]*storer.WebhookDelivery, error) {
+	var res []*storer.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == storer.WebhookDeliveryPending && !d.NextAttemptAt.After(now) && s.subs[d.SubscriptionID].IsActive {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeStore) RecordWebhookDeliveryAttempt(ctx context.Context, d *storer.WebhookDelivery, succeeded bool, disableAfter int64) error {
+	sub := s.subs[d.SubscriptionID]
+	if succeeded {
+		sub.ConsecutiveFailures = 0
+		return nil
+	}
+	sub.ConsecutiveFailures++
+	if disableAfter > 0 && sub.ConsecutiveFailures >= disableAfter {
+		sub.IsActive = false
+	}
+	return nil
+}
+
+func newTestDispatcher(st Store, now *time.Time) *Dispatcher {
+	cfg := DefaultConfig()
+	cfg.MaxAttempts = 3
+	cfg.DisableAfter = 5
+	d := NewDispatcher(st, cfg)
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func TestDispatcherDeliversSignedPayload(t *testing.T) {
+	const secret = "whsec_test"
+
+	var received Envelope
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, Verify(secret, r.Header.Get(SignatureHeader), body, time.Minute))
+		require.Equal(t, storer.EventOrderStatusChanged, r.Header.Get(EventHeader))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	st := &fakeStore{subs: map[int64]*storer.WebhookSubscription{
+		1: {ID: 1, URL: srv.URL, EventTypes: storer.EventOrderStatusChanged, Secret: secret, IsActive: true},
+	}}
+	now := time.Now()
+	d := newTestDispatcher(st, &now)
+
+	err := d.Enqueue(context.Background(), &storer.OutboxEvent{
+		ID:        7,
+		EventType: storer.EventOrderStatusChanged,
+		Payload:   json.RawMessage(`{"order_id":1,"status":"shipped"}`),
+	})
+	require.NoError(t, err)
+	require.Len(t, st.deliveries, 1)
+
+	n, err := d.DeliverBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	del := st.deliveries[0]
+	require.Equal(t, storer.WebhookDeliverySucceeded, del.Status)
+	require.Equal(t, int64(http.StatusNoContent), *del.ResponseCode)
+	require.Equal(t, int64(7), received.ID)
+	require.JSONEq(t, `{"order_id":1,"status":"shipped"}`, string(received.Data))
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	st := &fakeStore{subs: map[int64]*storer.WebhookSubscription{
+		1: {ID: 1, URL: srv.URL, EventTypes: storer.EventOrderCreated, Secret: "s", IsActive: true},
+	}}
+	now := time.Now()
+	d := newTestDispatcher(st, &now)
+
+	require.NoError(t, d.Enqueue(context.Background(), &storer.OutboxEvent{ID: 1, EventType: storer.EventOrderCreated, Payload: json.RawMessage(`{}`)}))
+
+	_, err := d.DeliverBatch(context.Background())
+	require.NoError(t, err)
+
+	del := st.deliveries[0]
+	require.Equal(t, storer.WebhookDeliveryPending, del.Status)
+	require.Equal(t, int64(http.StatusInternalServerError), *del.ResponseCode)
+	require.Equal(t, now.Add(d.cfg.BaseBackoff), del.NextAttemptAt)
+
+	// not due yet
+	_, err = d.DeliverBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+
+	for i := 0; i < 2; i++ {
+		now = del.NextAttemptAt
+		_, err = d.DeliverBatch(context.Background())
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 3, calls)
+	require.Equal(t, storer.WebhookDeliveryFailed, del.Status)
+	require.Equal(t, int64(3), del.Attempts)
+}
+
+func TestDispatcherDisablesFailingSubscription(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	st := &fakeStore{subs: map[int64]*storer.WebhookSubscription{
+		1: {ID: 1, URL: srv.URL, EventTypes: storer.EventOrderCreated, Secret: "s", IsActive: true},
+	}}
+	now := time.Now()
+	d := newTestDispatcher(st, &now)
+
+	for i := int64(1); i <= 6; i++ {
+		require.NoError(t, d.Enqueue(context.Background(), &storer.OutboxEvent{ID: i, EventType: storer.EventOrderCreated, Payload: json.RawMessage(`{}`)}))
+	}
+
+	_, err := d.DeliverBatch(context.Background())
+	require.NoError(t, err)
+
+	require.False(t, st.subs[1].IsActive)
+	require.Equal(t, int64(5), st.subs[1].ConsecutiveFailures)
+	require.Equal(t, int64(0), st.deliveries[5].Attempts)
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	header := Sign("secret", time.Now(), body)
+
+	require.NoError(t, Verify("secret", header, body, time.Minute))
+	require.Error(t, Verify("other", header, body, time.Minute))
+	require.Error(t, Verify("secret", header, []byte(`{"id":2}`), time.Minute))
+	require.Error(t, Verify("secret", Sign("secret", time.Now().Add(-time.Hour), body), body, time.Minute))
+	require.Error(t, Verify("secret", "garbage", body, time.Minute))
+}
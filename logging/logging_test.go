@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	for _, tc := range []struct {
+		format string
+		level  string
+		ok     bool
+	}{
+		{format: "json", level: "info", ok: true},
+		{format: "TEXT", level: "debug", ok: true},
+		{format: "xml", level: "info", ok: false},
+		{format: "json", level: "loud", ok: false},
+	} {
+		_, err := Setup(&bytes.Buffer{}, tc.format, tc.level)
+		if tc.ok {
+			require.NoError(t, err, tc)
+		} else {
+			require.Error(t, err, tc)
+		}
+	}
+}
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(ContextHandler{Handler: slog.NewJSONHandler(&buf, nil)})
+
+	traceID := trace.TraceID{1, 2, 3}
+	ctx := trace.ContextWithSpanContext(WithRequestID(context.Background(), "req-1"), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{4},
+	}))
+	logger.With("component", "test").InfoContext(ctx, "hello")
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.Equal(t, "req-1", rec["request_id"])
+	require.Equal(t, traceID.String(), rec["trace_id"])
+	require.Equal(t, "test", rec["component"])
+
+	buf.Reset()
+	logger.Info("no context")
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec))
+	require.NotContains(t, buf.String(), "request_id")
+	require.NotContains(t, buf.String(), "trace_id")
+}
@@ -0,0 +1,164 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages to users. LogSender and FileSender are meant for
+// development; an SMTP or provider API sender can be plugged in instead.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Kinds of senders NewSender can create.
+const (
+	SenderLog  = "log"
+	SenderFile = "file"
+)
+
+// NewSender returns a sender of the given kind. file is only used by the
+// file sender.
+func NewSender(kind, file string) (Sender, error) {
+	switch kind {
+	case SenderLog:
+		return LogSender{}, nil
+	case SenderFile:
+		return NewFileSender(file)
+	default:
+		return nil, fmt.Errorf("unknown mail sender %q", kind)
+	}
+}
+
+// LogSender writes messages to the log, body included.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, m Message) error {
+	slog.InfoContext(ctx, "mail sent", "to", m.To, "subject", m.Subject, "body", m.Body)
+	return nil
+}
+
+// FileSender appends every message as a JSON line to a file.
+type FileSender struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+type fileMessage struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	SentAt  string `json:"sent_at"`
+}
+
+func NewFileSender(path string) (*FileSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening mail file: %w", err)
+	}
+
+	return &FileSender{f: f}, nil
+}
+
+func (s *FileSender) Send(ctx context.Context, m Message) error {
+	line, err := json.Marshal(fileMessage{
+		To:      m.To,
+		Subject: m.Subject,
+		Body:    m.Body,
+		SentAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding message: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+
+	return s.f.Sync()
+}
+
+func (s *FileSender) Close() error {
+	return s.f.Close()
+}
+
+// ErrQueueFull is returned by AsyncSender.Send when too many messages are
+// waiting to be delivered.
+var ErrQueueFull = errors.New("mail queue is full")
+
+// asyncSendTimeout bounds the delivery of a single message by AsyncSender.
+const asyncSendTimeout = 30 * time.Second
+
+type queuedMessage struct {
+	ctx context.Context
+	m   Message
+}
+
+// AsyncSender delivers messages with another Sender in the background, so
+// that callers neither wait for the delivery nor can be timed by it. Failed
+// deliveries are logged.
+type AsyncSender struct {
+	sender Sender
+	queue  chan queuedMessage
+	done   chan struct{}
+}
+
+// NewAsyncSender starts delivering messages with sender, keeping up to size
+// messages waiting.
+func NewAsyncSender(sender Sender, size int) *AsyncSender {
+	s := &AsyncSender{
+		sender: sender,
+		queue:  make(chan queuedMessage, size),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+// Send queues m. The context only carries values, such as the request ID, to
+// the delivery; cancelling it does not cancel the delivery.
+func (s *AsyncSender) Send(ctx context.Context, m Message) error {
+	select {
+	case s.queue <- queuedMessage{ctx: context.WithoutCancel(ctx), m: m}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close delivers the queued messages and stops. Send must not be called
+// afterwards.
+func (s *AsyncSender) Close() error {
+	close(s.queue)
+	<-s.done
+
+	return nil
+}
+
+func (s *AsyncSender) run() {
+	defer close(s.done)
+
+	for qm := range s.queue {
+		ctx, cancel := context.WithTimeout(qm.ctx, asyncSendTimeout)
+		if err := s.sender.Send(ctx, qm.m); err != nil {
+			slog.ErrorContext(ctx, "error sending mail", "subject", qm.m.Subject, "error", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.jsonl")
+
+	s, err := NewSender(SenderFile, path)
+	require.NoError(t, err)
+	defer s.(*FileSender).Close()
+
+	for _, to := range []string{"a@example.com", "b@example.com"} {
+		require.NoError(t, s.Send(context.Background(), Message{To: to, Subject: "Hello", Body: "Hi there"}))
+	}
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+
+	var m fileMessage
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &m))
+	require.Equal(t, "b@example.com", m.To)
+	require.Equal(t, "Hello", m.Subject)
+	require.Equal(t, "Hi there", m.Body)
+}
+
+func TestNewSenderUnknown(t *testing.T) {
+	_, err := NewSender("smtp", "")
+	require.Error(t, err)
+}
+
+// blockingSender records messages once unblock is closed.
+type blockingSender struct {
+	mu      sync.Mutex
+	sent    []Message
+	unblock chan struct{}
+}
+
+func (s *blockingSender) Send(ctx context.Context, m Message) error {
+	<-s.unblock
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestAsyncSender(t *testing.T) {
+	sender := &blockingSender{unblock: make(chan struct{})}
+	s := NewAsyncSender(sender, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// the first message is taken by the worker, which blocks on it, and the
+	// second one waits in the queue
+	require.NoError(t, s.Send(ctx, Message{To: "a@example.com"}))
+	require.Eventually(t, func() bool { return len(s.queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, s.Send(ctx, Message{To: "b@example.com"}))
+	require.ErrorIs(t, s.Send(ctx, Message{To: "c@example.com"}), ErrQueueFull)
+	cancel()
+
+	close(sender.unblock)
+	require.NoError(t, s.Close())
+	require.Equal(t, []Message{{To: "a@example.com"}, {To: "b@example.com"}}, sender.sent)
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ordersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders successfully created.",
+	})
+
+	ordersRevenue = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_revenue_total",
+		Help: "Sum of the total price of created orders.",
+	})
+
+	loginFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "login_failures_total",
+		Help: "Failed login attempts, by reason.",
+	}, []string{"reason"})
+)
+
+// Reasons a login can fail with.
+const (
+	LoginFailureUnknownUser   = "unknown_user"
+	LoginFailureWrongPassword = "wrong_password"
+	LoginFailureThrottled     = "throttled"
+	LoginFailureLocked        = "locked"
+	LoginFailureWrongMFACode  = "wrong_mfa_code"
+	LoginFailureSSO           = "sso"
+)
+
+// OrderCreated records a created order and its total price.
+func OrderCreated(totalPrice float64) {
+	ordersCreated.Inc()
+	if totalPrice > 0 {
+		ordersRevenue.Add(totalPrice)
+	}
+}
+
+// LoginFailed records a failed login attempt.
+func LoginFailed(reason string) {
+	loginFailures.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcServerHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, by full method name and status code.",
+	}, []string{"grpc_method", "grpc_code"})
+
+	grpcServerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Latency of RPCs handled by the server, by full method name and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_method", "grpc_code"})
+
+	grpcClientHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_handled_total",
+		Help: "RPCs completed by the client, by full method name and status code.",
+	}, []string{"grpc_method", "grpc_code"})
+
+	grpcClientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_client_handling_seconds",
+		Help:    "Latency of RPCs made by the client, by full method name and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_method", "grpc_code"})
+)
+
+// UnaryServerInterceptor records metrics for every unary RPC. It should be the
+// first interceptor in the chain so that calls rejected by later ones, such as
+// the authenticator, are counted too.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		code := status.Code(err).String()
+		grpcServerHandled.WithLabelValues(info.FullMethod, code).Inc()
+		grpcServerDuration.WithLabelValues(info.FullMethod, code).Observe(time.Since(start).Seconds())
+
+		return res, err
+	}
+}
+
+// StreamServerInterceptor records metrics for every streaming RPC once the
+// stream is finished.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+
+		code := status.Code(err).String()
+		grpcServerHandled.WithLabelValues(info.FullMethod, code).Inc()
+		grpcServerDuration.WithLabelValues(info.FullMethod, code).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor records metrics for every unary RPC made through the
+// connection.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		code := status.Code(err).String()
+		grpcClientHandled.WithLabelValues(method, code).Inc()
+		grpcClientDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
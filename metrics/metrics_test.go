@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPMiddlewareUsesRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Route("/orders", func(r chi.Router) {
+		r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	for _, path := range []string{"/orders/1", "/orders/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, path, nil))
+	}
+
+	require.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodDelete, "/orders/{id}", "204")))
+	require.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodDelete, "unmatched", "404")))
+}
+
+func TestUnaryServerInterceptorRecordsCode(t *testing.T) {
+	const method = "/pb.golang_microservice/Test"
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: method}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	require.Error(t, err)
+
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 1.0, testutil.ToFloat64(grpcServerHandled.WithLabelValues(method, codes.NotFound.String())))
+	require.Equal(t, 1.0, testutil.ToFloat64(grpcServerHandled.WithLabelValues(method, codes.OK.String())))
+}
+
+func TestOrderCreated(t *testing.T) {
+	before := testutil.ToFloat64(ordersRevenue)
+
+	OrderCreated(12.5)
+	OrderCreated(0)
+
+	require.Equal(t, 12.5, testutil.ToFloat64(ordersRevenue)-before)
+}
@@ -0,0 +1,184 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// DefaultArgon2MemoryLimit is the memory, in KiB, that argon2id hashes and
+// checks running at the same time may use together: four hashes with the
+// default parameters.
+const DefaultArgon2MemoryLimit = 4 * 64 * 1024
+
+// argon2Memory limits the memory of all argon2id hashes and checks of the
+// process, as every one of them allocates the full memory parameter.
+var argon2Memory = newMemoryLimit(DefaultArgon2MemoryLimit)
+
+// SetArgon2MemoryLimit sets the memory, in KiB, that argon2id hashes and
+// checks running at the same time may use together. Further ones wait until
+// enough memory is released. A hash needing more than the limit runs alone;
+// 0 removes the limit.
+func SetArgon2MemoryLimit(kib uint64) {
+	argon2Memory.setBudget(kib)
+}
+
+// memoryLimit is a semaphore weighted by memory.
+type memoryLimit struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	budget uint64
+	used   uint64
+}
+
+func newMemoryLimit(budget uint64) *memoryLimit {
+	l := &memoryLimit{budget: budget}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *memoryLimit) setBudget(budget uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.budget = budget
+	l.cond.Broadcast()
+}
+
+// acquire waits until kib can be used within the budget and returns what has
+// to be passed to release.
+func (l *memoryLimit) acquire(kib uint64) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.budget == 0 {
+		return 0
+	}
+
+	kib = min(kib, l.budget)
+	for l.used+kib > l.budget {
+		l.cond.Wait()
+	}
+	l.used += kib
+
+	return kib
+}
+
+func (l *memoryLimit) release(kib uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used -= kib
+	l.cond.Broadcast()
+}
+
+// idKey derives an argon2id key within the memory limit of the process.
+func idKey(password, salt []byte, iterations, memory uint32, parallelism uint8, keyLength uint32) []byte {
+	reserved := argon2Memory.acquire(uint64(memory))
+	defer argon2Memory.release(reserved)
+
+	return argon2.IDKey(password, salt, iterations, memory, parallelism, keyLength)
+}
+
+// Argon2id hashes passwords with Argon2id (RFC 9106) into the PHC string
+// format, e.g. $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2id struct {
+	// Memory is the memory used per hash, in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id returns the second recommended option of RFC 9106 with
+// 64 MiB of memory.
+func DefaultArgon2id() Argon2id {
+	return Argon2id{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 4,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+
+	key := idKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a Argon2id) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory != a.Memory || params.Iterations != a.Iterations || params.Parallelism != a.Parallelism ||
+		uint32(len(salt)) != a.SaltLength || uint32(len(key)) != a.KeyLength
+}
+
+func verifyArgon2id(password, hash string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := idKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+func decodeArgon2id(hash string) (Argon2id, []byte, []byte, error) {
+	var a Argon2id
+
+	parts := strings.Split(strings.TrimPrefix(hash, argon2idPrefix), "$")
+	if len(parts) != 4 {
+		return a, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil {
+		return a, nil, nil, fmt.Errorf("malformed argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return a, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &a.Memory, &a.Iterations, &a.Parallelism); err != nil {
+		return a, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if a.Memory == 0 || a.Iterations == 0 || a.Parallelism == 0 {
+		return a, nil, nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return a, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return a, nil, nil, fmt.Errorf("malformed argon2id key")
+	}
+	a.SaltLength = uint32(len(salt))
+	a.KeyLength = uint32(len(key))
+
+	return a, salt, key, nil
+}
@@ -0,0 +1,60 @@
+// Package password hashes and checks user passwords.
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Algorithms a Hasher can be created for.
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	// ErrMismatch is returned by Verify if the password does not match.
+	ErrMismatch = errors.New("password does not match")
+	// ErrUnknownHash is returned by Verify for hashes of no supported
+	// algorithm.
+	ErrUnknownHash = errors.New("unknown password hash")
+)
+
+// Hasher hashes new passwords. The hash encodes the algorithm and its
+// parameters, so Verify can check passwords whatever hasher made the hash.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// NeedsRehash reports whether hash was made with another algorithm or
+	// other parameters, and should be replaced with a new hash once the
+	// password is known.
+	NeedsRehash(hash string) bool
+}
+
+// Verify checks password against a hash made by any of the hashers of this
+// package. It returns ErrMismatch if the password is wrong. Users without a
+// password have an empty hash, which matches nothing.
+func Verify(password, hash string) error {
+	switch {
+	case hash == "":
+		return ErrMismatch
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return verifyArgon2id(password, hash)
+	case isBcrypt(hash):
+		return verifyBcrypt(password, hash)
+	default:
+		return ErrUnknownHash
+	}
+}
+
+// NewHasher returns the hasher of the algorithm with its default parameters.
+func NewHasher(algorithm string) (Hasher, error) {
+	switch algorithm {
+	case AlgorithmArgon2id:
+		return DefaultArgon2id(), nil
+	case AlgorithmBcrypt:
+		return DefaultBcrypt(), nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", algorithm)
+	}
+}
@@ -0,0 +1,127 @@
+package password
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashers(t *testing.T) {
+	hashers := map[string]Hasher{
+		"argon2id": Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		"bcrypt":   Bcrypt{Cost: bcrypt.MinCost},
+	}
+
+	for name, h := range hashers {
+		t.Run(name, func(t *testing.T) {
+			hash, err := h.Hash("correct horse")
+			require.NoError(t, err)
+			require.NoError(t, Verify("correct horse", hash))
+			require.ErrorIs(t, Verify("wrong horse", hash), ErrMismatch)
+			require.False(t, h.NeedsRehash(hash))
+
+			other, err := h.Hash("correct horse")
+			require.NoError(t, err)
+			require.NotEqual(t, hash, other, "salted")
+		})
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	// test vector of golang.org/x/crypto/argon2 in the PHC string format
+	hash := "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7"
+	require.NoError(t, Verify("password", hash))
+	require.ErrorIs(t, Verify("Password", hash), ErrMismatch)
+
+	h := Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hash, err := h.Hash("password")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"), hash)
+
+	for _, malformed := range []string{
+		"$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ",
+		"$argon2id$v=16$m=1024,t=1,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub",
+		"$argon2id$v=19$m=0,t=1,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub",
+		"$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ$",
+	} {
+		err := Verify("password", malformed)
+		require.Error(t, err, malformed)
+		require.NotErrorIs(t, err, ErrMismatch, malformed)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weak := Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	argonHash, err := weak.Hash("password")
+	require.NoError(t, err)
+	bcryptHash, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("password")
+	require.NoError(t, err)
+
+	strong := weak
+	strong.Iterations = 2
+	require.True(t, strong.NeedsRehash(argonHash))
+	require.True(t, strong.NeedsRehash(bcryptHash))
+	require.True(t, strong.NeedsRehash(""))
+
+	require.True(t, Bcrypt{Cost: bcrypt.MinCost + 1}.NeedsRehash(bcryptHash))
+	require.True(t, Bcrypt{Cost: bcrypt.MinCost}.NeedsRehash(argonHash))
+}
+
+func TestVerifyUnknownHashes(t *testing.T) {
+	require.ErrorIs(t, Verify("", ""), ErrMismatch)
+	require.ErrorIs(t, Verify("password", ""), ErrMismatch)
+	require.ErrorIs(t, Verify("password", "password"), ErrUnknownHash)
+	require.ErrorIs(t, Verify("password", "$scrypt$ln=16,r=8,p=1$aM15713r3Xsvxbi31lqr1Q$nFNh2CVHVjNldFVKDHDlm4CbdRSCdEBsjjJxD+iCs5E"), ErrUnknownHash)
+}
+
+func TestNewHasher(t *testing.T) {
+	h, err := NewHasher(AlgorithmArgon2id)
+	require.NoError(t, err)
+	require.Equal(t, DefaultArgon2id(), h)
+
+	h, err = NewHasher(AlgorithmBcrypt)
+	require.NoError(t, err)
+	require.Equal(t, DefaultBcrypt(), h)
+
+	_, err = NewHasher("md5")
+	require.Error(t, err)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	l := newMemoryLimit(100)
+
+	var mu sync.Mutex
+	var inUse, peak uint64
+	var wg sync.WaitGroup
+	for _, kib := range []uint64{40, 40, 40, 40, 250, 10, 60} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			reserved := l.acquire(kib)
+			mu.Lock()
+			inUse += reserved
+			peak = max(peak, inUse)
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			inUse -= reserved
+			mu.Unlock()
+			l.release(reserved)
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, peak, uint64(100))
+	require.Zero(t, l.used)
+
+	// without a budget nothing waits
+	l.setBudget(0)
+	require.Zero(t, l.acquire(1000))
+}
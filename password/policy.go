@@ -0,0 +1,97 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// commonPasswords are passwords found most often in breaches. They are
+// always rejected; LoadBreached adds longer lists.
+//
+//go:embed common.txt
+var commonPasswords string
+
+// Policy decides which passwords users may choose.
+type Policy struct {
+	// MinLength and MaxLength count characters. A MaxLength of 0 allows any
+	// length.
+	MinLength int
+	MaxLength int
+	// Breached holds known breached passwords, lower cased.
+	Breached map[string]struct{}
+}
+
+// DefaultPolicy requires 8 to 128 characters and rejects common passwords.
+func DefaultPolicy() Policy {
+	p := Policy{
+		MinLength: 8,
+		MaxLength: 128,
+		Breached:  map[string]struct{}{},
+	}
+	p.addBreached(strings.NewReader(commonPasswords))
+
+	return p
+}
+
+// LoadBreached adds the passwords in the file, one per line, to the
+// breached passwords.
+func (p *Policy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	if err := p.addBreached(f); err != nil {
+		return fmt.Errorf("error reading breached password list: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Policy) addBreached(r io.Reader) error {
+	if p.Breached == nil {
+		p.Breached = map[string]struct{}{}
+	}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			p.Breached[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return s.Err()
+}
+
+// Check returns an error describing why password may not be chosen by the
+// user with the email address.
+func (p Policy) Check(password, email string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters long", p.MaxLength)
+	}
+
+	lower := strings.ToLower(password)
+	if _, ok := p.Breached[lower]; ok {
+		return fmt.Errorf("password is too common, it appears in known data breaches")
+	}
+
+	// the part before the @ is what people reuse, but short ones like "al"
+	// occur in too many passwords to reject them
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, _, _ := strings.Cut(email, "@")
+	if email != "" && (strings.Contains(lower, email) || len(local) >= 3 && strings.Contains(lower, local)) {
+		return fmt.Errorf("password must not contain the email address")
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	p := DefaultPolicy()
+
+	tcs := []struct {
+		name     string
+		password string
+		wantErr  string
+	}{
+		{name: "ok", password: "correct horse battery"},
+		{name: "empty", password: "", wantErr: "at least 8 characters"},
+		{name: "too short", password: "s3cr3t!", wantErr: "at least 8 characters"},
+		{name: "counts characters", password: "pässwörd€", wantErr: ""},
+		{name: "too long", password: string(make([]byte, 129)), wantErr: "at most 128 characters"},
+		{name: "breached", password: "password123", wantErr: "too common"},
+		{name: "breached ignoring case", password: "PassWord123", wantErr: "too common"},
+		{name: "email", password: "john@example.com", wantErr: "email address"},
+		{name: "local part", password: "JohnJohn2024", wantErr: "email address"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Check(tc.password, "john@example.com")
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	// short local parts are not checked
+	require.NoError(t, p.Check("alpaca-paddock", "al@example.com"))
+}
+
+func TestLoadBreached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Tr0ub4dor&3\n\n  correct horse battery staple  \n"), 0o600))
+
+	p := DefaultPolicy()
+	require.NoError(t, p.LoadBreached(path))
+	require.ErrorContains(t, p.Check("tr0ub4dor&3", ""), "too common")
+	require.ErrorContains(t, p.Check("correct horse battery staple", ""), "too common")
+	require.ErrorContains(t, p.Check("password123", ""), "too common")
+
+	require.Error(t, p.LoadBreached(filepath.Join(t.TempDir(), "missing.txt")))
+}
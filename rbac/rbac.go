@@ -0,0 +1,48 @@
+// Package rbac names the permissions that roles grant. The gateway routes and
+// the gRPC access policies check the same names, and the migrations seed them
+// into the permissions table.
+package rbac
+
+import "slices"
+
+// Permissions.
+const (
+	ProductsWrite         = "products:write"
+	OrdersReadAll         = "orders:read_all"
+	OrdersUpdateStatus    = "orders:update_status"
+	UsersRead             = "users:read"
+	UsersDelete           = "users:delete"
+	UsersUnlock           = "users:unlock"
+	UsersRevokeSessions   = "users:revoke_sessions"
+	RolesManage           = "roles:manage"
+	WebhooksManage        = "webhooks:manage"
+	APIKeysManage         = "api_keys:manage"
+	APIKeysIssueForOthers = "api_keys:issue_for_others"
+)
+
+// All lists every permission.
+var All = []string{
+	ProductsWrite,
+	OrdersReadAll,
+	OrdersUpdateStatus,
+	UsersRead,
+	UsersDelete,
+	UsersUnlock,
+	UsersRevokeSessions,
+	RolesManage,
+	WebhooksManage,
+	APIKeysManage,
+	APIKeysIssueForOthers,
+}
+
+// Roles seeded by the migrations. Existing admins were given RoleSuperuser,
+// which grants every permission.
+const (
+	RoleSuperuser = "superuser"
+	RoleWarehouse = "warehouse"
+)
+
+// Has reports whether permission is among granted.
+func Has(granted []string, permission string) bool {
+	return slices.Contains(granted, permission)
+}
@@ -0,0 +1,13 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHas(t *testing.T) {
+	require.True(t, Has([]string{OrdersReadAll, UsersDelete}, UsersDelete))
+	require.False(t, Has([]string{OrdersReadAll}, UsersDelete))
+	require.False(t, Has(nil, UsersDelete))
+}
@@ -0,0 +1,205 @@
+// Package sso lets users log in with an OpenID Connect provider, using the
+// authorization code flow with PKCE.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Config configures a provider users can log in with.
+type Config struct {
+	// Name identifies the provider in URLs and linked identities. It must not
+	// change once users logged in with it.
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+// LoadConfig reads a JSON list of provider configurations.
+func LoadConfig(path string) ([]Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sso config: %w", err)
+	}
+
+	var cfgs []Config
+	if err := json.Unmarshal(b, &cfgs); err != nil {
+		return nil, fmt.Errorf("error decoding sso config: %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, cfg := range cfgs {
+		if cfg.Name == "" || strings.ContainsAny(cfg.Name, "/?#") {
+			return nil, fmt.Errorf("invalid sso provider name %q", cfg.Name)
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("duplicate sso provider %q", cfg.Name)
+		}
+		names[cfg.Name] = true
+	}
+
+	return cfgs, nil
+}
+
+// Provider is an OpenID Connect provider.
+type Provider struct {
+	name     string
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewProvider discovers the endpoints and keys of the provider from its
+// issuer URL. Keys are fetched with ctx later on too, so it has to live as
+// long as the provider.
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	p, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering sso provider %s: %w", cfg.Name, err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+
+	return &Provider{
+		name: cfg.Name,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     p.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+// Login holds the values an authorization request is made with. They have
+// to be kept by the client, usually in a cookie, until the provider
+// redirects back with the code.
+type Login struct {
+	// State ties the redirect back to the request, against login CSRF.
+	State string
+	// Nonce ties the ID token to the request, against replays.
+	Nonce string
+	// Verifier proves that the code is redeemed by whoever requested it
+	// (PKCE).
+	Verifier string
+}
+
+// NewLogin returns random values for a new authorization request.
+func NewLogin() (Login, error) {
+	state, err := randomString()
+	if err != nil {
+		return Login{}, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return Login{}, err
+	}
+
+	return Login{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}, nil
+}
+
+// String encodes l as a single value for a cookie, see ParseLogin.
+func (l Login) String() string {
+	return l.State + "." + l.Nonce + "." + l.Verifier
+}
+
+// ParseLogin decodes a login encoded with String.
+func ParseLogin(s string) (Login, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return Login{}, fmt.Errorf("malformed login")
+	}
+
+	return Login{State: parts[0], Nonce: parts[1], Verifier: parts[2]}, nil
+}
+
+// CheckState reports whether state is the one l was requested with.
+func (l Login) CheckState(state string) bool {
+	return subtle.ConstantTimeCompare([]byte(l.State), []byte(state)) == 1
+}
+
+// AuthCodeURL returns the URL of the provider to send the user to.
+func (p *Provider) AuthCodeURL(l Login) string {
+	return p.oauth.AuthCodeURL(l.State, oidc.Nonce(l.Nonce), oauth2.S256ChallengeOption(l.Verifier))
+}
+
+// Identity is the account of a user at a provider.
+type Identity struct {
+	Provider string
+	// Subject identifies the account at the provider, unlike the email
+	// address it never changes.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Exchange redeems the code the provider redirected back with and returns
+// the identity its ID token asserts. The token's signature, issuer,
+// audience, expiry and nonce are checked.
+func (p *Provider) Exchange(ctx context.Context, l Login, code string) (*Identity, error) {
+	tok, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(l.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging code: %w", err)
+	}
+
+	raw, ok := tok.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying id token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(l.Nonce)) != 1 {
+		return nil, fmt.Errorf("id token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("error decoding id token claims: %w", err)
+	}
+
+	return &Identity{
+		Provider:      p.name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating random value: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package sso
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abedsully/golang-microservice/sso/ssotest"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *ssotest.Provider) {
+	t.Helper()
+
+	idp := ssotest.NewProvider(t)
+	p, err := NewProvider(context.Background(), Config{
+		Name:         "test",
+		Issuer:       idp.URL,
+		ClientID:     ssotest.ClientID,
+		ClientSecret: ssotest.ClientSecret,
+		RedirectURL:  "http://localhost/callback",
+	})
+	require.NoError(t, err)
+
+	return p, idp
+}
+
+// authorize starts a login and returns it with the code the provider
+// redirected back with.
+func authorize(t *testing.T, p *Provider, idp *ssotest.Provider) (Login, string) {
+	t.Helper()
+
+	l, err := NewLogin()
+	require.NoError(t, err)
+
+	authURL, err := url.Parse(p.AuthCodeURL(l))
+	require.NoError(t, err)
+	require.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	require.Equal(t, "openid email profile", authURL.Query().Get("scope"))
+
+	callback, err := idp.Authorize(authURL.String())
+	require.NoError(t, err)
+	require.Equal(t, l.State, callback.Query().Get("state"))
+
+	return l, callback.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		p, idp := newTestProvider(t)
+		l, code := authorize(t, p, idp)
+
+		id, err := p.Exchange(context.Background(), l, code)
+		require.NoError(t, err)
+		require.Equal(t, &Identity{Provider: "test", Subject: "1234567890", Email: "john@example.com", EmailVerified: true, Name: "John"}, id)
+
+		// codes are redeemed once
+		_, err = p.Exchange(context.Background(), l, code)
+		require.Error(t, err)
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		p, idp := newTestProvider(t)
+		l, code := authorize(t, p, idp)
+
+		other, err := NewLogin()
+		require.NoError(t, err)
+		l.Verifier = other.Verifier
+
+		_, err = p.Exchange(context.Background(), l, code)
+		require.Error(t, err)
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		p, idp := newTestProvider(t)
+		idp.SetNonce("replayed")
+		l, code := authorize(t, p, idp)
+
+		_, err := p.Exchange(context.Background(), l, code)
+		require.ErrorContains(t, err, "nonce")
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		p, idp := newTestProvider(t)
+		idp.SetClaims(jwt.MapClaims{"sub": "1234567890", "email": "john@example.com"})
+		l, code := authorize(t, p, idp)
+
+		id, err := p.Exchange(context.Background(), l, code)
+		require.NoError(t, err)
+		require.False(t, id.EmailVerified)
+	})
+
+}
+
+func TestLoginString(t *testing.T) {
+	l, err := NewLogin()
+	require.NoError(t, err)
+
+	parsed, err := ParseLogin(l.String())
+	require.NoError(t, err)
+	require.Equal(t, l, parsed)
+	require.True(t, parsed.CheckState(l.State))
+	require.False(t, parsed.CheckState(l.Nonce))
+
+	for _, s := range []string{"", "a.b", "a..c", "a.b.c.d"} {
+		_, err := ParseLogin(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "sso.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	cfgs, err := LoadConfig(write(`[{"name":"google","issuer":"https://accounts.google.com","client_id":"id","client_secret":"secret","redirect_url":"https://example.com/users/login/sso/google/callback"}]`))
+	require.NoError(t, err)
+	require.Len(t, cfgs, 1)
+	require.Equal(t, "google", cfgs[0].Name)
+	require.Equal(t, "secret", cfgs[0].ClientSecret)
+
+	_, err = LoadConfig(write(`[{"name":"a"},{"name":"a"}]`))
+	require.Error(t, err)
+
+	_, err = LoadConfig(write(`[{"name":"a/b"}]`))
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepEvery is the number of writes after which expired entries are removed
+// from a MemoryStore.
+const sweepEvery = 1024
+
+type memoryEntry struct {
+	Attempts
+	expiresAt time.Time
+	// previousFailure is LastFailure before the latest reservation, which
+	// Release puts back.
+	previousFailure time.Time
+}
+
+// MemoryStore is a Store keeping attempts in the memory of the process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	writes  int
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !s.now().Before(e.expiresAt) {
+		return Attempts{}, nil
+	}
+	return e.Attempts, nil
+}
+
+func (s *MemoryStore) AddFailure(ctx context.Context, key string, now time.Time, ttl time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = memoryEntry{}
+	}
+	e.Failures++
+	e.LastFailure = now
+	e.expiresAt = now.Add(ttl)
+	s.entries[key] = e
+
+	s.writes++
+	if s.writes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	return e.Attempts, nil
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key string, now time.Time, cfg Config) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || !now.Before(e.expiresAt) {
+		e = memoryEntry{}
+	}
+	if wait := cfg.Wait(e.Attempts, now); wait > 0 {
+		return wait, nil
+	}
+	e.previousFailure = e.LastFailure
+	e.Failures++
+	e.LastFailure = now
+	e.expiresAt = now.Add(cfg.Window)
+	s.entries[key] = e
+
+	s.writes++
+	if s.writes%sweepEvery == 0 {
+		s.sweep(now)
+	}
+
+	return 0, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.Failures == 0 {
+		return nil
+	}
+	e.Failures--
+	e.LastFailure = e.previousFailure
+	s.entries[key] = e
+
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Attempts is the failure history of one key, such as an IP address or an
+// email address.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Store keeps the failure history of keys. Entries are forgotten once ttl has
+// passed since their last failure. MemoryStore keeps them in the process; a
+// store shared between gateway instances can be plugged in instead.
+//
+// Reserve has to check the wait of key and record the attempt atomically, so
+// that concurrent attempts cannot all pass the same check. Release takes back
+// one attempt recorded by Reserve.
+type Store interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	AddFailure(ctx context.Context, key string, now time.Time, ttl time.Duration) (Attempts, error)
+	Reserve(ctx context.Context, key string, now time.Time, cfg Config) (time.Duration, error)
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Config struct {
+	// FreeAttempts is the number of failures allowed before delays start.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure past FreeAttempts. It
+	// doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+}
+
+// Delay returns how long a key has to wait after its last failure when it has
+// failed the given number of times.
+func (c Config) Delay(failures int) time.Duration {
+	if failures <= c.FreeAttempts {
+		return 0
+	}
+
+	d := c.BaseDelay
+	for i := c.FreeAttempts + 1; i < failures; i++ {
+		d *= 2
+		if d >= c.MaxDelay {
+			return c.MaxDelay
+		}
+	}
+	return min(d, c.MaxDelay)
+}
+
+// Wait returns how long a key with the given attempts has to wait at now.
+func (c Config) Wait(a Attempts, now time.Time) time.Duration {
+	wait := a.LastFailure.Add(c.Delay(a.Failures)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Limiter slows down keys that keep failing with progressively longer delays.
+type Limiter struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+}
+
+func NewLimiter(store Store, cfg Config) *Limiter {
+	return &Limiter{
+		store: store,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// Wait returns how long key has to wait before it may try again, zero if it
+// may try now.
+func (l *Limiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	a, err := l.store.Get(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("error getting attempts: %w", err)
+	}
+
+	return l.wait(a), nil
+}
+
+// Fail records a failed attempt of key and returns how long it has to wait
+// before trying again.
+func (l *Limiter) Fail(ctx context.Context, key string) (time.Duration, error) {
+	a, err := l.store.AddFailure(ctx, key, l.now(), l.cfg.Window)
+	if err != nil {
+		return 0, fmt.Errorf("error recording failed attempt: %w", err)
+	}
+
+	return l.wait(a), nil
+}
+
+// Reserve records an attempt of key as failed before it is made, unless key
+// has to wait, in which case it returns how long and records nothing. An
+// attempt that turns out not to fail is taken back with Release.
+func (l *Limiter) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	wait, err := l.store.Reserve(ctx, key, l.now(), l.cfg)
+	if err != nil {
+		return 0, fmt.Errorf("error reserving attempt: %w", err)
+	}
+
+	return wait, nil
+}
+
+// Release takes back an attempt of key recorded by Reserve.
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	if err := l.store.Release(ctx, key); err != nil {
+		return fmt.Errorf("error releasing attempt: %w", err)
+	}
+
+	return nil
+}
+
+// Reset forgets the failures of key, typically after it succeeded.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	if err := l.store.Reset(ctx, key); err != nil {
+		return fmt.Errorf("error resetting attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (l *Limiter) wait(a Attempts) time.Duration {
+	return l.cfg.Wait(a, l.now())
+}
@@ -0,0 +1,157 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDelay(t *testing.T) {
+	cfg := Config{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	tcs := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 7, want: 10 * time.Second},
+		{failures: 100, want: 10 * time.Second},
+	}
+
+	for _, tc := range tcs {
+		require.Equal(t, tc.want, cfg.Delay(tc.failures), "failures: %d", tc.failures)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	l := NewLimiter(store, Config{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	l.now = func() time.Time { return now }
+
+	wait, err := l.Fail(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	wait, err = l.Fail(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Equal(t, time.Second, wait)
+
+	wait, err = l.Fail(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Second, wait)
+
+	// other keys are not affected
+	wait, err = l.Wait(ctx, "email:b@example.com")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	now = now.Add(1500 * time.Millisecond)
+	wait, err = l.Wait(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Equal(t, 500*time.Millisecond, wait)
+
+	// failures are forgotten after the window
+	now = now.Add(time.Hour)
+	wait, err = l.Fail(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	wait, err = l.Fail(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Equal(t, time.Second, wait)
+
+	require.NoError(t, l.Reset(ctx, "email:a@example.com"))
+	wait, err = l.Wait(ctx, "email:a@example.com")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	s := NewMemoryStore()
+	for i := 0; i < sweepEvery-1; i++ {
+		_, err := s.AddFailure(ctx, fmt.Sprintf("ip:%d", i), now, time.Minute)
+		require.NoError(t, err)
+	}
+	require.Len(t, s.entries, sweepEvery-1)
+
+	_, err := s.AddFailure(ctx, "ip:last", now.Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, s.entries, 1)
+}
+
+func TestLimiterReserve(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	l := NewLimiter(store, Config{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: time.Minute, Window: time.Hour})
+	l.now = func() time.Time { return now }
+
+	// a released attempt does not count
+	wait, err := l.Reserve(ctx, "ip:1")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	require.NoError(t, l.Release(ctx, "ip:1"))
+
+	a, err := store.Get(ctx, "ip:1")
+	require.NoError(t, err)
+	require.Zero(t, a.Failures)
+	require.True(t, a.LastFailure.IsZero())
+
+	// reserved attempts count until released, so concurrent attempts are
+	// throttled before any of them failed
+	wait, err = l.Reserve(ctx, "ip:1")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	wait, err = l.Reserve(ctx, "ip:1")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	wait, err = l.Reserve(ctx, "ip:1")
+	require.NoError(t, err)
+	require.Equal(t, time.Second, wait)
+
+	// a throttled attempt is not recorded
+	wait, err = l.Wait(ctx, "ip:1")
+	require.NoError(t, err)
+	require.Equal(t, time.Second, wait)
+}
+
+func TestLimiterReserveConcurrent(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(NewMemoryStore(), Config{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour})
+
+	var wg sync.WaitGroup
+	var allowed atomic.Int64
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := l.Reserve(ctx, "email:a@example.com")
+			if err == nil && wait == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int64(4), allowed.Load())
+}
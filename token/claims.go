@@ -4,18 +4,35 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/abedsully/golang-microservice/rbac"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 type UserClaims struct {
-	ID      int64  `json:"id"`
-	Email   string `json:"email"`
-	IsAdmin bool   `json:"is_admin"`
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+	// Permissions are those granted by the user's roles when the token was
+	// issued.
+	Permissions []string `json:"permissions,omitempty"`
+	// SessionID names the login session, shared by every token issued for
+	// it, so that the session can be told apart from the user's others.
+	SessionID string `json:"sid,omitempty"`
+	// APIKeyPrefix identifies the API key the claims were resolved from, if
+	// the caller authenticated with one. It is never part of a token.
+	APIKeyPrefix string `json:"-"`
+	// Purpose is empty for access and refresh tokens. Tokens with a purpose
+	// only serve it and must not authenticate anything else.
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewUserClaim(id int64, email string, isAdmin bool, duration time.Duration) (*UserClaims, error) {
+// PurposeMFA tokens prove that the password of a user with two-factor
+// authentication was checked, and are exchanged for access and refresh
+// tokens along with a second factor.
+const PurposeMFA = "mfa"
+
+func NewUserClaim(id int64, email string, permissions []string, sessionID string, duration time.Duration) (*UserClaims, error) {
 	tokenID, err := uuid.NewRandom()
 
 	if err != nil {
@@ -23,9 +40,10 @@ func NewUserClaim(id int64, email string, isAdmin bool, duration time.Duration)
 	}
 
 	return &UserClaims{
-		Email:   email,
-		ID:      id,
-		IsAdmin: isAdmin,
+		Email:       email,
+		ID:          id,
+		Permissions: permissions,
+		SessionID:   sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        tokenID.String(),
 			Subject:   email,
@@ -33,4 +51,9 @@ func NewUserClaim(id int64, email string, isAdmin bool, duration time.Duration)
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 		},
 	}, nil
-}
\ No newline at end of file
+}
+
+// HasPermission reports whether the token grants permission.
+func (c *UserClaims) HasPermission(permission string) bool {
+	return rbac.Has(c.Permissions, permission)
+}
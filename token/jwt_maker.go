@@ -8,24 +8,68 @@ import (
 )
 
 type JWTMaker struct {
-	secretKey string
+	keys *KeySet
+	opts Options
 }
 
+// NewJWTMaker returns a maker signing and verifying HS256 tokens with
+// secretKey. Its tokens carry no kid header.
 func NewJWTMaker(secretKey string) *JWTMaker {
+	return NewJWTMakerWithKeys(NewKeySet(0, NewHMACKey("", []byte(secretKey))), Options{})
+}
+
+// NewJWTMakerWithKeys returns a maker signing with the signing key of keys
+// and verifying with the key named by the kid header of a token.
+func NewJWTMakerWithKeys(keys *KeySet, opts Options) *JWTMaker {
 	return &JWTMaker{
-		secretKey: secretKey,
+		keys: keys,
+		opts: opts,
+	}
+}
+
+// Keys returns the keys of the maker.
+func (maker *JWTMaker) Keys() *KeySet {
+	return maker.keys
+}
+
+// JWKS returns the public keys tokens are verified with.
+func (maker *JWTMaker) JWKS() JWKS {
+	return maker.keys.JWKS()
+}
+
+func (maker *JWTMaker) CreateToken(id int64, email string, permissions []string, sessionID string, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaim(id, email, permissions, sessionID, duration)
+
+	if err != nil {
+		return "", nil, err
 	}
+
+	return maker.sign(claims)
 }
 
-func (maker *JWTMaker) CreateToken(id int64, email string, isAdmin bool, duration time.Duration) (string, *UserClaims, error) {
-	claims, err := NewUserClaim(id, email, isAdmin, duration)
+func (maker *JWTMaker) CreateMFAToken(id int64, email string, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaim(id, email, nil, "", duration)
 
 	if err != nil {
 		return "", nil, err
 	}
+	claims.Purpose = PurposeMFA
+
+	return maker.sign(claims)
+}
+
+func (maker *JWTMaker) sign(claims *UserClaims) (string, *UserClaims, error) {
+	key := maker.keys.SigningKey()
+	if key == nil {
+		return "", nil, fmt.Errorf("no signing key configured")
+	}
+	maker.opts.apply(claims)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString([]byte(maker.secretKey))
+	token := jwt.NewWithClaims(key.method(), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	tokenStr, err := token.SignedString(key.signKey)
 
 	if err != nil {
 		return "", nil, fmt.Errorf("error signing token: %w", err)
@@ -34,16 +78,21 @@ func (maker *JWTMaker) CreateToken(id int64, email string, isAdmin bool, duratio
 	return tokenStr, claims, nil
 }
 
-func(maker *JWTMaker) VerifyToken(tokenStr string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &UserClaims{}, func (token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-
+func (maker *JWTMaker) VerifyToken(tokenStr string) (*UserClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := maker.keys.VerificationKey(kid)
 		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		// the algorithm is fixed by the key, never by the token
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("invalid token signing method")
 		}
 
-		return []byte(maker.secretKey), nil
-	})
+		return key.verifyKey, nil
+	}, maker.parserOptions()...)
 
 	if err != nil {
 		return nil, fmt.Errorf("error parsing token: %w", err)
@@ -55,4 +104,20 @@ func(maker *JWTMaker) VerifyToken(tokenStr string) (*UserClaims, error) {
 	}
 
 	return claims, nil
-}
\ No newline at end of file
+}
+
+func (maker *JWTMaker) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(maker.opts.Leeway),
+	}
+	if maker.opts.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(maker.opts.Issuer))
+	}
+	if maker.opts.Audience != "" {
+		opts = append(opts, jwt.WithAudience(maker.opts.Audience))
+	}
+
+	return opts
+}
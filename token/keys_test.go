@@ -0,0 +1,194 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func generatePEM(t *testing.T, algorithm string) (private, public []byte) {
+	t.Helper()
+
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			privatePEM, publicPEM := generatePEM(t, algorithm)
+
+			private, err := ParsePEMKey(privatePEM)
+			require.NoError(t, err)
+			require.Equal(t, algorithm, private.Algorithm)
+			require.True(t, private.CanSign())
+
+			public, err := ParsePEMKey(publicPEM)
+			require.NoError(t, err)
+			require.False(t, public.CanSign())
+			require.Equal(t, private.ID, public.ID)
+
+			signer := NewJWTMakerWithKeys(NewKeySet(0, private), Options{})
+			verifier := NewJWTMakerWithKeys(NewKeySet(0, nil, public), Options{})
+
+			tokenStr, _, err := signer.CreateToken(1, "john@example.com", nil, "s1", time.Minute)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(tokenStr, &UserClaims{})
+			require.NoError(t, err)
+			require.Equal(t, private.ID, parsed.Header["kid"])
+			require.Equal(t, algorithm, parsed.Header["alg"])
+
+			claims, err := verifier.VerifyToken(tokenStr)
+			require.NoError(t, err)
+			require.Equal(t, "john@example.com", claims.Email)
+
+			_, _, err = verifier.CreateToken(1, "john@example.com", nil, "s1", time.Minute)
+			require.Error(t, err)
+
+			jwks := verifier.Keys().JWKS()
+			require.Len(t, jwks.Keys, 1)
+			require.Equal(t, private.ID, jwks.Keys[0].KeyID)
+			require.Equal(t, algorithm, jwks.Keys[0].Algorithm)
+		})
+	}
+}
+
+func TestVerifyTokenRejectsOtherKeys(t *testing.T) {
+	privatePEM, publicPEM := generatePEM(t, AlgorithmRS256)
+	key, err := ParsePEMKey(privatePEM)
+	require.NoError(t, err)
+	maker := NewJWTMakerWithKeys(NewKeySet(0, key), Options{})
+
+	t.Run("unknown kid", func(t *testing.T) {
+		otherPEM, _ := generatePEM(t, AlgorithmRS256)
+		other, err := ParsePEMKey(otherPEM)
+		require.NoError(t, err)
+
+		tokenStr, _, err := NewJWTMakerWithKeys(NewKeySet(0, other), Options{}).CreateToken(1, "john@example.com", nil, "", time.Minute)
+		require.NoError(t, err)
+
+		_, err = maker.VerifyToken(tokenStr)
+		require.Error(t, err)
+	})
+
+	t.Run("public key used as HMAC secret", func(t *testing.T) {
+		claims, err := NewUserClaim(1, "john@example.com", nil, "", time.Minute)
+		require.NoError(t, err)
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		forged.Header["kid"] = key.ID
+		tokenStr, err := forged.SignedString(publicPEM)
+		require.NoError(t, err)
+
+		_, err = maker.VerifyToken(tokenStr)
+		require.Error(t, err)
+	})
+
+	t.Run("HMAC token", func(t *testing.T) {
+		tokenStr, _, err := NewJWTMaker("01234567890123456789012345678901").CreateToken(1, "john@example.com", nil, "", time.Minute)
+		require.NoError(t, err)
+
+		_, err = maker.VerifyToken(tokenStr)
+		require.Error(t, err)
+	})
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldPEM, _ := generatePEM(t, AlgorithmES256)
+	newPEM, _ := generatePEM(t, AlgorithmES256)
+	oldKey, err := ParsePEMKey(oldPEM)
+	require.NoError(t, err)
+	newKey, err := ParsePEMKey(newPEM)
+	require.NoError(t, err)
+
+	now := time.Now()
+	set := NewKeySet(time.Hour, oldKey)
+	set.now = func() time.Time { return now }
+	maker := NewJWTMakerWithKeys(set, Options{})
+
+	oldToken, _, err := maker.CreateToken(1, "john@example.com", nil, "", 2*time.Hour)
+	require.NoError(t, err)
+
+	set.Update(newKey)
+	require.Equal(t, newKey.ID, set.SigningKey().ID)
+	require.Len(t, set.JWKS().Keys, 2)
+
+	newToken, _, err := maker.CreateToken(1, "john@example.com", nil, "", 2*time.Hour)
+	require.NoError(t, err)
+
+	_, err = maker.VerifyToken(oldToken)
+	require.NoError(t, err)
+
+	// after the grace period only the new key is left
+	now = now.Add(time.Hour)
+	_, err = maker.VerifyToken(oldToken)
+	require.Error(t, err)
+	_, err = maker.VerifyToken(newToken)
+	require.NoError(t, err)
+	require.Len(t, set.JWKS().Keys, 1)
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	signingFile := filepath.Join(dir, "signing.key")
+	keysDir := filepath.Join(dir, "keys")
+	require.NoError(t, os.Mkdir(keysDir, 0o700))
+
+	firstPEM, _ := generatePEM(t, AlgorithmEdDSA)
+	secondPEM, _ := generatePEM(t, AlgorithmEdDSA)
+	_, nextPublicPEM := generatePEM(t, AlgorithmRS256)
+	require.NoError(t, os.WriteFile(signingFile, firstPEM, 0o600))
+
+	files, err := NewKeyFiles(signingFile, keysDir, time.Hour)
+	require.NoError(t, err)
+	first := files.KeySet().SigningKey()
+
+	changed, err := files.Reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(keysDir, "next.pem"), nextPublicPEM, 0o600))
+	require.NoError(t, os.WriteFile(signingFile, secondPEM, 0o600))
+	changed, err = files.Reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.NotEqual(t, first.ID, files.KeySet().SigningKey().ID)
+
+	// the replaced signing key is retired, not dropped
+	_, ok := files.KeySet().VerificationKey(first.ID)
+	require.True(t, ok)
+	require.Len(t, files.KeySet().JWKS().Keys, 3)
+
+	require.NoError(t, os.WriteFile(signingFile, nextPublicPEM, 0o600))
+	_, err = files.Reload()
+	require.Error(t, err)
+}
@@ -0,0 +1,261 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeySet holds the key new tokens are signed with and the keys tokens are
+// verified with. Keys dropped by Update are still accepted for the grace
+// period, so that tokens signed before a rotation keep working until they
+// would have expired anyway.
+type KeySet struct {
+	grace time.Duration
+	now   func() time.Time
+
+	mu      sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+	retired map[string]retiredKey
+}
+
+type retiredKey struct {
+	key   *Key
+	until time.Time
+}
+
+// NewKeySet returns a set signing with signing, which may be nil for sets that
+// only verify, and accepting it and verification.
+func NewKeySet(grace time.Duration, signing *Key, verification ...*Key) *KeySet {
+	s := &KeySet{
+		grace:   grace,
+		now:     time.Now,
+		retired: map[string]retiredKey{},
+	}
+	s.Update(signing, verification...)
+
+	return s
+}
+
+// Update replaces the keys of the set. Keys that were accepted before but are
+// missing now are retired: they are still accepted, and published, for the
+// grace period.
+func (s *KeySet) Update(signing *Key, verification ...*Key) {
+	keys := map[string]*Key{}
+	for _, k := range verification {
+		keys[k.ID] = k
+	}
+	if signing != nil {
+		keys[signing.ID] = signing
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for id, k := range s.keys {
+		if _, ok := keys[id]; !ok && s.grace > 0 {
+			s.retired[id] = retiredKey{key: k, until: now.Add(s.grace)}
+		}
+	}
+	for id, r := range s.retired {
+		if _, ok := keys[id]; ok || !now.Before(r.until) {
+			delete(s.retired, id)
+		}
+	}
+
+	s.signing = signing
+	s.keys = keys
+}
+
+// SigningKey returns the key new tokens are signed with, or nil if the set
+// can only verify.
+func (s *KeySet) SigningKey() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.signing
+}
+
+// VerificationKey returns the accepted key with the given ID.
+func (s *KeySet) VerificationKey(id string) (*Key, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if k, ok := s.keys[id]; ok {
+		return k, true
+	}
+	if r, ok := s.retired[id]; ok && s.now().Before(r.until) {
+		return r.key, true
+	}
+
+	return nil, false
+}
+
+// JWKS returns the public parts of the accepted keys, retired ones included,
+// ordered by ID. HMAC keys are left out.
+func (s *KeySet) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	keys := make([]*Key, 0, len(s.keys)+len(s.retired))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	for _, r := range s.retired {
+		if now.Before(r.until) {
+			keys = append(keys, r.key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range keys {
+		if jwk, err := k.JWK(); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set
+}
+
+// KeyFiles keeps a KeySet in sync with PEM files on disk, so that keys can be
+// rotated without restarting. Replacing the signing key file switches signing
+// to the new key while the old one is retired, and keys added to the
+// verification directory are accepted from the next reload on.
+type KeyFiles struct {
+	signingFile     string
+	verificationDir string
+	set             *KeySet
+
+	mu  sync.Mutex
+	raw []byte
+}
+
+// NewKeyFiles loads the private key in signingFile, if set, and every *.pem
+// file in verificationDir, if set. Either may hold private or public keys.
+func NewKeyFiles(signingFile, verificationDir string, grace time.Duration) (*KeyFiles, error) {
+	f := &KeyFiles{
+		signingFile:     signingFile,
+		verificationDir: verificationDir,
+		set:             NewKeySet(grace, nil),
+	}
+
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// KeySet returns the set kept in sync with the files.
+func (f *KeyFiles) KeySet() *KeySet {
+	return f.set
+}
+
+// Reload reads the files again and reports whether anything changed. On error
+// the previously loaded keys are kept.
+func (f *KeyFiles) Reload() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var files []string
+	if f.verificationDir != "" {
+		matches, err := filepath.Glob(filepath.Join(f.verificationDir, "*.pem"))
+		if err != nil {
+			return false, fmt.Errorf("error listing %s: %w", f.verificationDir, err)
+		}
+		sort.Strings(matches)
+		files = matches
+	}
+
+	// file names are part of what is compared, so that renaming a key counts
+	// as a change
+	var contents [][]byte
+	var joined bytes.Buffer
+	for _, file := range append([]string{f.signingFile}, files...) {
+		if file == "" {
+			contents = append(contents, nil)
+			continue
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return false, fmt.Errorf("error reading %s: %w", file, err)
+		}
+		contents = append(contents, b)
+		joined.WriteString(file)
+		joined.WriteByte(0)
+		joined.Write(b)
+		joined.WriteByte(0)
+	}
+
+	if f.raw != nil && bytes.Equal(joined.Bytes(), f.raw) {
+		return false, nil
+	}
+
+	var signing *Key
+	if f.signingFile != "" {
+		k, err := ParsePEMKey(contents[0])
+		if err != nil {
+			return false, fmt.Errorf("error parsing %s: %w", f.signingFile, err)
+		}
+		if !k.CanSign() {
+			return false, fmt.Errorf("%s holds no private key", f.signingFile)
+		}
+		signing = k
+	}
+
+	var verification []*Key
+	for i, file := range files {
+		k, err := ParsePEMKey(contents[i+1])
+		if err != nil {
+			return false, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		verification = append(verification, k)
+	}
+
+	if signing == nil && len(verification) == 0 {
+		return false, fmt.Errorf("no keys found")
+	}
+
+	f.set.Update(signing, verification...)
+	f.raw = joined.Bytes()
+
+	return true, nil
+}
+
+// Watch reloads the files every interval until ctx is cancelled.
+func (f *KeyFiles) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := f.Reload()
+			if err != nil {
+				slog.ErrorContext(ctx, "error reloading jwt keys, keeping the current ones", "error", err)
+				continue
+			}
+			if changed {
+				attrs := []any{"keys", len(f.set.JWKS().Keys)}
+				if k := f.set.SigningKey(); k != nil {
+					attrs = append(attrs, "signing_key", k.ID)
+				}
+				slog.InfoContext(ctx, "reloaded jwt keys", attrs...)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package token
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token formats.
+const (
+	FormatJWT          = "jwt"
+	FormatPasetoLocal  = "paseto-local"
+	FormatPasetoPublic = "paseto-public"
+)
+
+// Maker issues the tokens of users and verifies them.
+type Maker interface {
+	CreateToken(id int64, email string, permissions []string, sessionID string, duration time.Duration) (string, *UserClaims, error)
+	// CreateMFAToken issues a PurposeMFA token.
+	CreateMFAToken(id int64, email string, duration time.Duration) (string, *UserClaims, error)
+	VerifyToken(token string) (*UserClaims, error)
+}
+
+// Options are shared by all makers.
+type Options struct {
+	// Issuer is set as the iss claim of new tokens and, if not empty,
+	// required of verified ones.
+	Issuer string
+	// Audience is set as the aud claim of new tokens and, if not empty,
+	// required of verified ones.
+	Audience string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+func (o Options) apply(claims *UserClaims) {
+	claims.Issuer = o.Issuer
+	if o.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{o.Audience}
+	}
+}
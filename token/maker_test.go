@@ -0,0 +1,161 @@
+package token
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testMakers(t *testing.T) map[string]func(opts Options) Maker {
+	t.Helper()
+
+	edPEM, edPublicPEM := generatePEM(t, AlgorithmEdDSA)
+	edKey, err := ParsePEMKey(edPEM)
+	require.NoError(t, err)
+	edPublic, err := ParsePEMKey(edPublicPEM)
+	require.NoError(t, err)
+
+	localKey := make([]byte, 32)
+	_, err = rand.Read(localKey)
+	require.NoError(t, err)
+
+	return map[string]func(opts Options) Maker{
+		"jwt HS256": func(opts Options) Maker {
+			return NewJWTMakerWithKeys(NewKeySet(0, NewHMACKey("", []byte("01234567890123456789012345678901"))), opts)
+		},
+		"jwt EdDSA": func(opts Options) Maker {
+			return NewJWTMakerWithKeys(NewKeySet(0, edKey), opts)
+		},
+		"paseto local": func(opts Options) Maker {
+			m, err := NewPasetoLocalMaker(localKey, opts)
+			require.NoError(t, err)
+			return m
+		},
+		"paseto public": func(opts Options) Maker {
+			m, err := NewPasetoPublicMaker(edKey, opts)
+			require.NoError(t, err)
+			return m
+		},
+		"paseto public verify only": func(opts Options) Maker {
+			m, err := NewPasetoPublicMaker(edPublic, opts)
+			require.NoError(t, err)
+			return &signedBy{Maker: m, signer: func() Maker {
+				m, err := NewPasetoPublicMaker(edKey, opts)
+				require.NoError(t, err)
+				return m
+			}()}
+		},
+	}
+}
+
+// signedBy verifies with Maker tokens created by signer.
+type signedBy struct {
+	Maker
+	signer Maker
+}
+
+func (s *signedBy) CreateToken(id int64, email string, permissions []string, sessionID string, duration time.Duration) (string, *UserClaims, error) {
+	return s.signer.CreateToken(id, email, permissions, sessionID, duration)
+}
+
+func (s *signedBy) CreateMFAToken(id int64, email string, duration time.Duration) (string, *UserClaims, error) {
+	return s.signer.CreateMFAToken(id, email, duration)
+}
+
+func TestMakers(t *testing.T) {
+	opts := Options{Issuer: "issuer", Audience: "audience"}
+
+	for name, newMaker := range testMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			maker := newMaker(opts)
+
+			tokenStr, created, err := maker.CreateToken(7, "john@example.com", []string{"orders:read"}, "s1", time.Minute)
+			require.NoError(t, err)
+
+			claims, err := maker.VerifyToken(tokenStr)
+			require.NoError(t, err)
+			require.Equal(t, int64(7), claims.ID)
+			require.Equal(t, "john@example.com", claims.Email)
+			require.Equal(t, []string{"orders:read"}, claims.Permissions)
+			require.Equal(t, "s1", claims.SessionID)
+			require.Equal(t, created.RegisteredClaims.ID, claims.RegisteredClaims.ID)
+			require.Equal(t, "issuer", claims.Issuer)
+			require.Equal(t, created.ExpiresAt.Unix(), claims.ExpiresAt.Unix())
+			require.Empty(t, claims.Purpose)
+
+			_, err = maker.VerifyToken(tokenStr + "x")
+			require.Error(t, err)
+
+			mfaToken, _, err := maker.CreateMFAToken(7, "john@example.com", time.Minute)
+			require.NoError(t, err)
+			claims, err = maker.VerifyToken(mfaToken)
+			require.NoError(t, err)
+			require.Equal(t, PurposeMFA, claims.Purpose)
+			require.Empty(t, claims.Permissions)
+
+			_, err = newMaker(Options{Issuer: "other", Audience: "audience"}).VerifyToken(tokenStr)
+			require.Error(t, err, "issuer")
+
+			_, err = newMaker(Options{Issuer: "issuer", Audience: "other"}).VerifyToken(tokenStr)
+			require.Error(t, err, "audience")
+		})
+	}
+}
+
+func TestMakersLeeway(t *testing.T) {
+	for name, newMaker := range testMakers(t) {
+		t.Run(name, func(t *testing.T) {
+			tokenStr, _, err := newMaker(Options{}).CreateToken(7, "john@example.com", nil, "", -10*time.Second)
+			require.NoError(t, err)
+
+			_, err = newMaker(Options{}).VerifyToken(tokenStr)
+			require.Error(t, err)
+
+			_, err = newMaker(Options{Leeway: time.Minute}).VerifyToken(tokenStr)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMakersRejectOtherFormats(t *testing.T) {
+	makers := testMakers(t)
+
+	for name, newMaker := range makers {
+		tokenStr, _, err := newMaker(Options{}).CreateToken(7, "john@example.com", nil, "", time.Minute)
+		require.NoError(t, err)
+
+		for otherName, newOther := range makers {
+			if otherName == name || sameKeys(name, otherName) {
+				continue
+			}
+			_, err := newOther(Options{}).VerifyToken(tokenStr)
+			require.Error(t, err, "%s token verified by %s", name, otherName)
+		}
+	}
+}
+
+func sameKeys(a, b string) bool {
+	paseto := map[string]bool{"paseto public": true, "paseto public verify only": true}
+	return paseto[a] && paseto[b]
+}
+
+func TestPasetoPublicMakerKeys(t *testing.T) {
+	rsaPEM, _ := generatePEM(t, AlgorithmRS256)
+	rsaKey, err := ParsePEMKey(rsaPEM)
+	require.NoError(t, err)
+	_, err = NewPasetoPublicMaker(rsaKey, Options{})
+	require.Error(t, err)
+
+	_, publicPEM := generatePEM(t, AlgorithmEdDSA)
+	public, err := ParsePEMKey(publicPEM)
+	require.NoError(t, err)
+	maker, err := NewPasetoPublicMaker(public, Options{})
+	require.NoError(t, err)
+	_, _, err = maker.CreateToken(7, "john@example.com", nil, "", time.Minute)
+	require.Error(t, err)
+
+	_, err = NewPasetoLocalMaker([]byte("short"), Options{})
+	require.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PasetoMaker issues PASETO v4 tokens: encrypted with a shared key (local) or
+// signed with an Ed25519 key (public). Unlike JWTs, the algorithm of a PASETO
+// token follows from its version and purpose, so it can not be confused.
+type PasetoMaker struct {
+	opts Options
+
+	localKey  *paseto.V4SymmetricKey
+	secretKey *paseto.V4AsymmetricSecretKey
+	publicKey *paseto.V4AsymmetricPublicKey
+}
+
+// NewPasetoLocalMaker returns a maker encrypting and decrypting v4.local
+// tokens with the 32 byte key.
+func NewPasetoLocalMaker(key []byte, opts Options) (*PasetoMaker, error) {
+	k, err := paseto.V4SymmetricKeyFromBytes(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid paseto key: %w", err)
+	}
+
+	return &PasetoMaker{opts: opts, localKey: &k}, nil
+}
+
+// NewPasetoPublicMaker returns a maker signing and verifying v4.public tokens
+// with the Ed25519 key, see ParsePEMKey. Makers given a public key can only
+// verify.
+func NewPasetoPublicMaker(key *Key, opts Options) (*PasetoMaker, error) {
+	if key.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("paseto public tokens need an Ed25519 key, got %s", key.Algorithm)
+	}
+
+	m := &PasetoMaker{opts: opts}
+	if key.CanSign() {
+		secret, err := paseto.NewV4AsymmetricSecretKeyFromEd25519(key.signKey.(ed25519.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid paseto key: %w", err)
+		}
+		m.secretKey = &secret
+	}
+	public, err := paseto.NewV4AsymmetricPublicKeyFromEd25519(key.verifyKey.(ed25519.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid paseto key: %w", err)
+	}
+	m.publicKey = &public
+
+	return m, nil
+}
+
+func (maker *PasetoMaker) CreateToken(id int64, email string, permissions []string, sessionID string, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaim(id, email, permissions, sessionID, duration)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return maker.sign(claims)
+}
+
+func (maker *PasetoMaker) CreateMFAToken(id int64, email string, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaim(id, email, nil, "", duration)
+
+	if err != nil {
+		return "", nil, err
+	}
+	claims.Purpose = PurposeMFA
+
+	return maker.sign(claims)
+}
+
+func (maker *PasetoMaker) sign(claims *UserClaims) (string, *UserClaims, error) {
+	if maker.localKey == nil && maker.secretKey == nil {
+		return "", nil, fmt.Errorf("no signing key configured")
+	}
+	maker.opts.apply(claims)
+
+	t := paseto.NewToken()
+	t.SetJti(claims.RegisteredClaims.ID)
+	t.SetSubject(claims.Subject)
+	t.SetIssuedAt(claims.IssuedAt.Time)
+	t.SetNotBefore(claims.IssuedAt.Time)
+	t.SetExpiration(claims.ExpiresAt.Time)
+	if claims.Issuer != "" {
+		t.SetIssuer(claims.Issuer)
+	}
+	if len(claims.Audience) > 0 {
+		t.SetAudience(claims.Audience[0])
+	}
+	if err := t.Set("id", claims.ID); err != nil {
+		return "", nil, fmt.Errorf("error setting token claims: %w", err)
+	}
+	t.SetString("email", claims.Email)
+	if len(claims.Permissions) > 0 {
+		if err := t.Set("permissions", claims.Permissions); err != nil {
+			return "", nil, fmt.Errorf("error setting token claims: %w", err)
+		}
+	}
+	if claims.SessionID != "" {
+		t.SetString("sid", claims.SessionID)
+	}
+	if claims.Purpose != "" {
+		t.SetString("purpose", claims.Purpose)
+	}
+
+	if maker.localKey != nil {
+		return t.V4Encrypt(*maker.localKey, nil), claims, nil
+	}
+
+	return t.V4Sign(*maker.secretKey, nil), claims, nil
+}
+
+func (maker *PasetoMaker) VerifyToken(tokenStr string) (*UserClaims, error) {
+	parser := paseto.MakeParser(maker.rules())
+
+	var (
+		t   *paseto.Token
+		err error
+	)
+	if maker.localKey != nil {
+		t, err = parser.ParseV4Local(*maker.localKey, tokenStr, nil)
+	} else {
+		t, err = parser.ParseV4Public(*maker.publicKey, tokenStr, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing token: %w", err)
+	}
+
+	claims := &UserClaims{}
+	if err := t.Get("id", &claims.ID); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if claims.Email, err = t.GetString("email"); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	// optional claims are left empty when missing
+	_ = t.Get("permissions", &claims.Permissions)
+	claims.SessionID, _ = t.GetString("sid")
+	claims.Purpose, _ = t.GetString("purpose")
+	claims.RegisteredClaims.ID, _ = t.GetJti()
+	claims.Subject, _ = t.GetSubject()
+	claims.Issuer, _ = t.GetIssuer()
+	if aud, err := t.GetAudience(); err == nil {
+		claims.Audience = jwt.ClaimStrings{aud}
+	}
+	if iat, err := t.GetIssuedAt(); err == nil {
+		claims.IssuedAt = jwt.NewNumericDate(iat)
+	}
+	if nbf, err := t.GetNotBefore(); err == nil {
+		claims.NotBefore = jwt.NewNumericDate(nbf)
+	}
+	exp, _ := t.GetExpiration()
+	claims.ExpiresAt = jwt.NewNumericDate(exp)
+
+	return claims, nil
+}
+
+// rules mirror the checks of JWTMaker: the token must expire, times are
+// compared with the configured leeway, and iss and aud must match if set.
+func (maker *PasetoMaker) rules() []paseto.Rule {
+	leeway := maker.opts.Leeway
+	rules := []paseto.Rule{func(t paseto.Token) error {
+		now := time.Now()
+
+		exp, err := t.GetExpiration()
+		if err != nil {
+			return fmt.Errorf("token has no expiration: %w", err)
+		}
+		if now.After(exp.Add(leeway)) {
+			return fmt.Errorf("token is expired")
+		}
+		if nbf, err := t.GetNotBefore(); err == nil && now.Add(leeway).Before(nbf) {
+			return fmt.Errorf("token is not valid yet")
+		}
+		if iat, err := t.GetIssuedAt(); err == nil && now.Add(leeway).Before(iat) {
+			return fmt.Errorf("token used before issued")
+		}
+
+		return nil
+	}}
+	if maker.opts.Issuer != "" {
+		rules = append(rules, paseto.IssuedBy(maker.opts.Issuer))
+	}
+	if maker.opts.Audience != "" {
+		rules = append(rules, paseto.ForAudience(maker.opts.Audience))
+	}
+
+	return rules
+}
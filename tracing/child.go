@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// ChildSpansOnly wraps tp so that spans are only started inside an existing
+// trace. It keeps background pollers, such as the outbox relay, from starting
+// a new trace for every database query.
+func ChildSpansOnly(tp trace.TracerProvider) trace.TracerProvider {
+	return childOnlyProvider{TracerProvider: tp}
+}
+
+type childOnlyProvider struct {
+	trace.TracerProvider
+}
+
+func (p childOnlyProvider) Tracer(name string, opts ...trace.TracerOption) trace.Tracer {
+	return childOnlyTracer{Tracer: p.TracerProvider.Tracer(name, opts...)}
+}
+
+type childOnlyTracer struct {
+	trace.Tracer
+}
+
+func (t childOnlyTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return noop.NewTracerProvider().Tracer("").Start(ctx, name, opts...)
+	}
+
+	return t.Tracer.Start(ctx, name, opts...)
+}
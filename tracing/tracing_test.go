@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func setupRecorder(t *testing.T) (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	t.Helper()
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return sr, tp
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	sr, _ := setupRecorder(t)
+
+	var handlerSpan trace.SpanContext
+	r := chi.NewRouter()
+	r.Use(HTTPMiddleware)
+	r.Route("/orders", func(r chi.Router) {
+		r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+			handlerSpan = trace.SpanContextFromContext(r.Context())
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodDelete, "/orders/42", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+
+	require.Equal(t, "DELETE /orders/{id}", span.Name())
+	require.Equal(t, trace.SpanKindServer, span.SpanKind())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	require.Equal(t, codes.Error, span.Status().Code)
+	require.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+}
+
+func TestChildSpansOnly(t *testing.T) {
+	sr, tp := setupRecorder(t)
+	tracer := ChildSpansOnly(tp).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "db.Query")
+	span.End()
+	require.Empty(t, sr.Ended())
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "CreateOrder")
+	_, span = tracer.Start(ctx, "db.Query")
+	span.End()
+	parent.End()
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "db.Query", spans[0].Name())
+	require.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "jaeger"})
+	require.Error(t, err)
+
+	_, err = Setup(context.Background(), Config{Exporter: ExporterFile})
+	require.Error(t, err)
+}